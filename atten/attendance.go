@@ -4,13 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/open4go/p7/clock"
 	"github.com/open4go/r3time"
+	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"strconv"
 	"strings"
 	"time"
 )
 
+const expiration = 183 * 24 * time.Hour // 签到记录保留半年
+
 type Attendance struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty"`
 	UserID    string             `bson:"userId"`
@@ -18,17 +22,102 @@ type Attendance struct {
 	CreatedAt time.Time          `bson:"createdAt"`
 }
 
+// Checker 签到服务，按所在时区的日期记录签到
+// 每个用户每月一个 bitmap，第 N 天签到时设置第 N-1 位
+type Checker struct {
+	client   redis.Cmdable // 为空时使用 cache 连接池
+	clock    clock.Clock
+	location *time.Location // 为空时使用 r3time 的时区
+}
+
+// Option 签到服务配置项
+type Option func(*Checker)
+
+// WithClient 设置 Redis 客户端，默认使用 cache 连接池
+func WithClient(client redis.Cmdable) Option {
+	return func(c *Checker) {
+		if client != nil {
+			c.client = client
+		}
+	}
+}
+
+// WithClock 设置时钟，默认使用系统时间
+func WithClock(clk clock.Clock) Option {
+	return func(c *Checker) {
+		if clk != nil {
+			c.clock = clk
+		}
+	}
+}
+
+// WithLocation 设置签到日期所在的时区，默认使用 r3time 的时区
+func WithLocation(loc *time.Location) Option {
+	return func(c *Checker) {
+		if loc != nil {
+			c.location = loc
+		}
+	}
+}
+
+// NewChecker 创建签到服务
+func NewChecker(opts ...Option) *Checker {
+	c := &Checker{clock: clock.System}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// defaultChecker 包级函数使用的签到服务
+var defaultChecker = NewChecker()
+
+// now 获取签到时区的当前时间
+func (c *Checker) now() time.Time {
+	loc := c.location
+	if loc == nil {
+		loc = r3time.LocTime().Location()
+	}
+	return c.clock.Now().In(loc)
+}
+
+// redis 获取 Redis 客户端
+func (c *Checker) redis(ctx context.Context) redis.Cmdable {
+	if c.client != nil {
+		return c.client
+	}
+	return GetRedisCacheHandler(ctx)
+}
+
+// monthKey 用户某月的签到记录
+func monthKey(userID string, year int, month time.Month) string {
+	return fmt.Sprintf("attendance:%s:%d:%d", userID, year, month)
+}
+
 // CheckIn 签到
 func CheckIn(ctx context.Context, userId string) error {
-	now := r3time.LocTime()
-	year := now.Year()
-	month := now.Month()
-	day := now.Day()
+	return defaultChecker.CheckIn(ctx, userId)
+}
+
+// CheckStatus 查询签到状态
+func CheckStatus(ctx context.Context, userID string) ([]int, error) {
+	return defaultChecker.CheckStatus(ctx, userID)
+}
+
+// CheckStatusDetail 查询签到状态
+// ym: 2025:04
+func CheckStatusDetail(ctx context.Context, ym string, userID string) (AttendanceStatus, error) {
+	return defaultChecker.CheckStatusDetail(ctx, ym, userID)
+}
 
-	key := fmt.Sprintf("attendance:%s:%d:%d", userId, year, month)
+// CheckIn 签到
+func (c *Checker) CheckIn(ctx context.Context, userId string) error {
+	now := c.now()
+	key := monthKey(userId, now.Year(), now.Month())
+	day := now.Day()
 
 	// 检查是否已经签到
-	checkedIn, err := GetRedisCacheHandler(ctx).GetBit(ctx, key, int64(day-1)).Result()
+	checkedIn, err := c.redis(ctx).GetBit(ctx, key, int64(day-1)).Result()
 	if err != nil {
 		return errors.New("签到失败")
 	}
@@ -38,14 +127,13 @@ func CheckIn(ctx context.Context, userId string) error {
 	}
 
 	// 签到
-	_, err = GetRedisCacheHandler(ctx).SetBit(ctx, key, int64(day-1), 1).Result()
+	_, err = c.redis(ctx).SetBit(ctx, key, int64(day-1), 1).Result()
 	if err != nil {
 		return errors.New("签到失败")
 	}
 
 	// 设置键的过期时间为半年
-	expiration := 183 * 24 * time.Hour // 半年
-	_, err = GetRedisCacheHandler(ctx).Expire(ctx, key, expiration).Result()
+	_, err = c.redis(ctx).Expire(ctx, key, expiration).Result()
 	if err != nil {
 		return errors.New("设置过期时间失败")
 	}
@@ -54,25 +142,22 @@ func CheckIn(ctx context.Context, userId string) error {
 	return nil
 }
 
-// CheckStatus 查询签到状态
-func CheckStatus(ctx context.Context, userID string) ([]int, error) {
-	now := r3time.LocTime()
-	year := now.Year()
-	month := now.Month()
-
-	key := fmt.Sprintf("attendance:%s:%d:%d", userID, year, month)
+// CheckStatus 查询本月签到状态
+func (c *Checker) CheckStatus(ctx context.Context, userID string) ([]int, error) {
+	now := c.now()
+	return c.monthBits(ctx, monthKey(userID, now.Year(), now.Month()))
+}
 
-	// 查询本月签到状态
+// monthBits 查询一个月的签到状态
+func (c *Checker) monthBits(ctx context.Context, key string) ([]int, error) {
 	status := make([]int, 31)
 	for day := 1; day <= 31; day++ {
-		bit, err := GetRedisCacheHandler(ctx).GetBit(ctx, key, int64(day-1)).Result()
+		bit, err := c.redis(ctx).GetBit(ctx, key, int64(day-1)).Result()
 		if err != nil {
 			return nil, errors.New("查询失败")
 		}
 		status[day-1] = int(bit)
 	}
-
-	// 查询状态
 	return status, nil
 }
 
@@ -82,46 +167,34 @@ type AttendanceStatus struct {
 	IsCheckToday bool // 当天是否已签到（新增字段）
 }
 
-// CheckStatusDetail 查询签到状态
+// CheckStatusDetail 查询某月签到状态
 // ym: 2025:04
-func CheckStatusDetail(ctx context.Context, ym string, userID string) (AttendanceStatus, error) {
-
+func (c *Checker) CheckStatusDetail(ctx context.Context, ym string, userID string) (AttendanceStatus, error) {
 	a := AttendanceStatus{}
 
 	key := fmt.Sprintf("attendance:%s:%s", userID, ym)
-	// 查询本月签到状态
-	status := make([]int, 31)
-	for day := 1; day <= 31; day++ {
-		bit, err := GetRedisCacheHandler(ctx).GetBit(ctx, key, int64(day-1)).Result()
-		if err != nil {
-			return a, errors.New("查询失败")
-		}
-		status[day-1] = int(bit)
+	status, err := c.monthBits(ctx, key)
+	if err != nil {
+		return a, err
 	}
-
 	a.Bits = status
 
 	// 统计签到次数
-	count, _ := GetRedisCacheHandler(ctx).BitCount(ctx, key, nil).Result()
+	count, _ := c.redis(ctx).BitCount(ctx, key, nil).Result()
 	a.Counter = count
 
-	// 5. 检查当天是否签到（新增）
-	// 1. 验证日期格式
+	// 验证日期格式
 	parts := strings.Split(ym, ":")
 	if len(parts) != 2 {
 		return a, errors.New("日期格式错误，应为 year:month")
 	}
-	now := r3time.LocTime()
-	currentYear, currentMonth, currentDay := now.Date()
+	currentYear, currentMonth, currentDay := c.now().Date()
 	inputYear, _ := strconv.Atoi(parts[0])
 	inputMonth, _ := strconv.Atoi(parts[1])
 
 	// 只有当查询的是当前年月时才检查当天
 	if inputYear == currentYear && inputMonth == int(currentMonth) {
 		a.IsCheckToday = a.Bits[currentDay-1] == 1
-	} else {
-		a.IsCheckToday = false
 	}
-	// 查询状态
 	return a, nil
 }
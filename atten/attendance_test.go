@@ -0,0 +1,158 @@
+package atten
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/open4go/p7/clock"
+	"github.com/redis/go-redis/v9"
+	"testing"
+	"time"
+)
+
+var (
+	east8 = time.FixedZone("UTC+8", 8*60*60)  // 无夏令时的东八区
+	west5 = time.FixedZone("UTC-5", -5*60*60) // 无夏令时的西五区
+)
+
+// newClient 创建连接到 miniredis 的客户端
+func newClient(t *testing.T) (*miniredis.Miniredis, redis.Cmdable) {
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return m, client
+}
+
+// checkIn 签到，失败时终止测试
+func checkIn(t *testing.T, checker *Checker, userID string) {
+	t.Helper()
+	if err := checker.CheckIn(context.Background(), userID); err != nil {
+		t.Fatalf("check in %s: %v", userID, err)
+	}
+}
+
+// assertCheckedDays 校验某月已签到的日期
+func assertCheckedDays(t *testing.T, checker *Checker, ym, userID string, days ...int) AttendanceStatus {
+	t.Helper()
+	status, err := checker.CheckStatusDetail(context.Background(), ym, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[int]bool, len(days))
+	for _, day := range days {
+		want[day] = true
+	}
+	for i, bit := range status.Bits {
+		if (bit == 1) != want[i+1] {
+			t.Fatalf("%s days of %s = %v, want %v", ym, userID, status.Bits, days)
+		}
+	}
+	if status.Counter != int64(len(days)) {
+		t.Fatalf("%s counter of %s = %d, want %d", ym, userID, status.Counter, len(days))
+	}
+	return status
+}
+
+// TestCheckStatusDetailKey 查询使用原样的 ym 拼接key，补零的月份与签到写入的key不同
+func TestCheckStatusDetailKey(t *testing.T) {
+	m, client := newClient(t)
+	checker := NewChecker(WithClient(client), WithClock(clock.NewFake(time.Date(2025, 4, 3, 12, 0, 0, 0, east8))), WithLocation(east8))
+	checkIn(t, checker, "u")
+	if !m.Exists("attendance:u:2025:4") {
+		t.Fatalf("keys = %v", m.Keys())
+	}
+	if detail := assertCheckedDays(t, checker, "2025:4", "u", 3); !detail.IsCheckToday {
+		t.Fatal("today not checked")
+	}
+
+	if _, err := client.SetBit(context.Background(), "attendance:u:2025:04", 0, 1).Result(); err != nil {
+		t.Fatal(err)
+	}
+	if detail := assertCheckedDays(t, checker, "2025:04", "u", 1); detail.IsCheckToday {
+		t.Fatal("today checked in attendance:u:2025:04")
+	}
+
+	if _, err := checker.CheckStatusDetail(context.Background(), "2025-04", "u"); err == nil {
+		t.Fatal("invalid ym accepted")
+	}
+}
+
+// TestCheckInMidnight 同一天只能签到一次，零点后可再次签到
+func TestCheckInMidnight(t *testing.T) {
+	ctx := context.Background()
+	_, client := newClient(t)
+	fake := clock.NewFake(time.Date(2026, 3, 10, 23, 59, 59, 0, east8))
+	checker := NewChecker(WithClient(client), WithClock(fake), WithLocation(east8))
+
+	checkIn(t, checker, "u1")
+	if err := checker.CheckIn(ctx, "u1"); err == nil {
+		t.Fatal("checked in twice on the same day")
+	}
+	fake.Advance(time.Second)
+	checkIn(t, checker, "u1")
+
+	status, err := checker.CheckStatus(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status[9] != 1 || status[10] != 1 {
+		t.Fatalf("status = %v", status)
+	}
+	if detail := assertCheckedDays(t, checker, "2026:3", "u1", 10, 11); !detail.IsCheckToday {
+		t.Fatal("today not checked")
+	}
+
+	// 时钟返回其他时区的时间时按签到时区的日期
+	fake.Set(time.Date(2026, 3, 11, 16, 0, 0, 0, time.UTC))
+	checkIn(t, checker, "u1")
+	assertCheckedDays(t, checker, "2026:3", "u1", 10, 11, 12)
+}
+
+// TestCheckInMonthBoundary 跨月与跨年后签到记录到新的月份
+func TestCheckInMonthBoundary(t *testing.T) {
+	_, client := newClient(t)
+	fake := clock.NewFake(time.Date(2026, 2, 28, 23, 59, 59, 0, east8))
+	checker := NewChecker(WithClient(client), WithClock(fake), WithLocation(east8))
+
+	checkIn(t, checker, "u1")
+	fake.Advance(time.Second)
+	checkIn(t, checker, "u1")
+
+	status, err := checker.CheckStatus(context.Background(), "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status[0] != 1 || status[27] != 0 {
+		t.Fatalf("status of march = %v", status)
+	}
+	if detail := assertCheckedDays(t, checker, "2026:2", "u1", 28); detail.IsCheckToday {
+		t.Fatal("previous month checked today")
+	}
+	if detail := assertCheckedDays(t, checker, "2026:3", "u1", 1); !detail.IsCheckToday {
+		t.Fatal("today not checked")
+	}
+
+	fake.Set(time.Date(2026, 12, 31, 12, 0, 0, 0, east8))
+	checkIn(t, checker, "u1")
+	fake.Set(time.Date(2027, 1, 1, 0, 0, 0, 0, east8))
+	checkIn(t, checker, "u1")
+	assertCheckedDays(t, checker, "2026:12", "u1", 31)
+	if detail := assertCheckedDays(t, checker, "2027:1", "u1", 1); !detail.IsCheckToday {
+		t.Fatal("today not checked")
+	}
+}
+
+// TestCheckInZones 同一时刻不同时区的签到日期不同
+func TestCheckInZones(t *testing.T) {
+	_, client := newClient(t)
+	// 东八区已是4月1日，西五区仍是3月31日
+	fake := clock.NewFake(time.Date(2026, 3, 31, 20, 0, 0, 0, time.UTC))
+	east := NewChecker(WithClient(client), WithClock(fake), WithLocation(east8))
+	west := NewChecker(WithClient(client), WithClock(fake), WithLocation(west5))
+
+	checkIn(t, east, "u1")
+	checkIn(t, west, "u2")
+	assertCheckedDays(t, east, "2026:4", "u1", 1)
+	assertCheckedDays(t, east, "2026:3", "u1")
+	assertCheckedDays(t, west, "2026:3", "u2", 31)
+	assertCheckedDays(t, west, "2026:4", "u2")
+}
@@ -0,0 +1,136 @@
+// Package clock 时钟抽象，业务代码通过注入的 Clock 获取当前时间，
+// 测试或回放时使用 Fake 控制时间，验证跨天、跨月、过期与等待时间等逻辑
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock 时钟
+type Clock interface {
+	Now() time.Time
+	// NewTicker 创建每隔 d 触发一次的定时器，d 须大于0
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker 定时器，与 time.Ticker 一样在接收方来不及处理时丢弃触发
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// System 系统时钟，各包未注入时钟时的默认值
+var System Clock = systemClock{}
+
+// systemClock 系统时钟
+type systemClock struct{}
+
+// Now 返回系统当前时间
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTicker 创建系统定时器
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+// systemTicker 系统定时器
+type systemTicker struct {
+	*time.Ticker
+}
+
+// C 返回触发时间的通道
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// Fake 手动控制的时钟，可并发使用
+// 其定时器只在 Set、Advance 使时间到达触发时间时触发
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+// NewFake 创建当前时间为 now 的时钟
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now 返回时钟的当前时间
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Set 将时钟设置到 t，允许回退
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = t
+	f.fire()
+}
+
+// Advance 将时钟推进 d，返回推进后的时间
+func (f *Fake) Advance(d time.Duration) time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	f.fire()
+	return f.now
+}
+
+// NewTicker 创建从当前时间开始每隔 d 触发一次的定时器
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := &fakeTicker{fake: f, c: make(chan time.Time, 1), period: d, next: f.now.Add(d)}
+	f.tickers = append(f.tickers, t)
+	return t
+}
+
+// fire 触发到达触发时间的定时器，一次推进跨越多个周期时只触发一次，调用方须持有锁
+func (f *Fake) fire() {
+	for _, t := range f.tickers {
+		if f.now.Before(t.next) {
+			continue
+		}
+		select {
+		case t.c <- f.now:
+		default:
+		}
+		t.next = t.next.Add((f.now.Sub(t.next)/t.period + 1) * t.period)
+	}
+}
+
+// fakeTicker Fake 的定时器
+type fakeTicker struct {
+	fake   *Fake
+	c      chan time.Time
+	period time.Duration
+	next   time.Time // 下次触发时间
+}
+
+// C 返回触发时间的通道
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop 停止定时器，之后不再触发
+func (t *fakeTicker) Stop() {
+	f := t.fake
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, other := range f.tickers {
+		if other == t {
+			f.tickers = append(f.tickers[:i], f.tickers[i+1:]...)
+			return
+		}
+	}
+}
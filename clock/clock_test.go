@@ -0,0 +1,86 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2026, 1, 31, 23, 59, 59, 0, time.UTC)
+	fake := NewFake(start)
+	if !fake.Now().Equal(start) {
+		t.Fatalf("now = %v, want %v", fake.Now(), start)
+	}
+	if next := fake.Advance(time.Second); !next.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)) || !fake.Now().Equal(next) {
+		t.Fatalf("advance = %v, now = %v", next, fake.Now())
+	}
+	fake.Set(start)
+	if !fake.Now().Equal(start) {
+		t.Fatalf("set back = %v", fake.Now())
+	}
+	if fake.Now().Location() != time.UTC {
+		t.Fatalf("location = %v", fake.Now().Location())
+	}
+}
+
+func TestSystem(t *testing.T) {
+	before := time.Now()
+	now := System.Now()
+	if now.Before(before) || now.After(time.Now()) {
+		t.Fatalf("system now = %v", now)
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	ticker := fake.NewTicker(time.Minute)
+
+	// fired 返回已触发的时间，未触发时返回零值
+	fired := func() time.Time {
+		select {
+		case at := <-ticker.C():
+			return at
+		default:
+			return time.Time{}
+		}
+	}
+
+	fake.Advance(59 * time.Second)
+	if at := fired(); !at.IsZero() {
+		t.Fatalf("fired early at %v", at)
+	}
+	fake.Advance(time.Second)
+	if at := fired(); !at.Equal(start.Add(time.Minute)) {
+		t.Fatalf("fired at %v", at)
+	}
+
+	// 一次跨越多个周期只触发一次，下次触发时间按周期对齐
+	fake.Advance(150 * time.Second)
+	if at := fired(); !at.Equal(start.Add(210 * time.Second)) {
+		t.Fatalf("fired at %v", at)
+	}
+	if at := fired(); !at.IsZero() {
+		t.Fatalf("fired twice at %v", at)
+	}
+	fake.Advance(30 * time.Second)
+	if at := fired(); !at.Equal(start.Add(4 * time.Minute)) {
+		t.Fatalf("fired at %v", at)
+	}
+
+	ticker.Stop()
+	fake.Advance(time.Hour)
+	if at := fired(); !at.IsZero() {
+		t.Fatalf("fired after stop at %v", at)
+	}
+}
+
+func TestSystemTicker(t *testing.T) {
+	ticker := System.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	select {
+	case <-ticker.C():
+	case <-time.After(time.Second):
+		t.Fatal("system ticker not fired")
+	}
+}
@@ -0,0 +1,184 @@
+// oqreplay 回放订单日志，输出 oqueue 预估等待时间与实际出餐时间的对比
+//
+//	oqreplay -log orders.jsonl -estimator parallel -base 90s -buffer 1.1
+//
+// 日志为每行一个JSON事件，格式见 replay.Event；未指定 -log 时从标准输入读取
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/open4go/p7/oqueue"
+	"github.com/open4go/p7/oqueue/replay"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// options 命令行参数
+type options struct {
+	logFile    string
+	configFile string
+	estimator  string
+	base       time.Duration
+	itemTime   time.Duration
+	buffer     float64
+	minOrders  int64
+	calibrate  bool
+	location   string
+	asJSON     bool
+	verbose    bool
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.logFile, "log", "", "订单日志文件(JSON行)，为空时读取标准输入")
+	flag.StringVar(&opts.configFile, "config", "", "商家队列配置文件，JSON格式的 商家ID -> MerchantConfig")
+	flag.StringVar(&opts.estimator, "estimator", "default", "预估器: default、ewma、hourly、parallel")
+	flag.DurationVar(&opts.base, "base", 0, "每单基础处理时间，为0时使用预估器默认值")
+	flag.DurationVar(&opts.itemTime, "item", 0, "历史数据不足时的每商品处理时间，为0时使用默认值")
+	flag.Float64Var(&opts.buffer, "buffer", 0, "缓冲系数，为0时使用默认值")
+	flag.Int64Var(&opts.minOrders, "min-orders", 0, "使用历史数据的最小样本数，为0时使用默认值")
+	flag.BoolVar(&opts.calibrate, "calibrate", false, "按历史误差自动校准缓冲系数")
+	flag.StringVar(&opts.location, "location", "", "默认时区(IANA名称)，用于营业日划分与分时段统计")
+	flag.BoolVar(&opts.asJSON, "json", false, "以JSON输出完整报告")
+	flag.BoolVar(&opts.verbose, "v", false, "输出每个订单的预估与实际时间")
+	flag.Parse()
+
+	if err := run(opts); err != nil {
+		fmt.Fprintln(os.Stderr, "oqreplay:", err)
+		os.Exit(1)
+	}
+}
+
+// run 读取日志并回放
+func run(opts options) error {
+	var in io.Reader = os.Stdin
+	if opts.logFile != "" {
+		f, err := os.Open(opts.logFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	events, err := replay.ReadEvents(in)
+	if err != nil {
+		return err
+	}
+
+	estimator, params, err := newEstimator(opts.estimator)
+	if err != nil {
+		return err
+	}
+	if opts.base > 0 {
+		params.BaseProcessTime = opts.base
+	}
+	if opts.itemTime > 0 {
+		params.DefaultItemTime = opts.itemTime
+	}
+	if opts.buffer > 0 {
+		params.BufferFactor = opts.buffer
+	}
+	if opts.minOrders > 0 {
+		params.MinProcessedOrders = opts.minOrders
+	}
+
+	cfg := replay.Config{Options: []oqueue.Option{oqueue.WithEstimator(estimator)}}
+	if opts.calibrate {
+		cfg.Options = append(cfg.Options, oqueue.WithBufferCalibration(oqueue.CalibrationPolicy{}))
+	}
+	if opts.location != "" {
+		loc, err := time.LoadLocation(opts.location)
+		if err != nil {
+			return err
+		}
+		cfg.Options = append(cfg.Options, oqueue.WithLocation(loc))
+	}
+	if opts.configFile != "" {
+		payload, err := os.ReadFile(opts.configFile)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(payload, &cfg.Merchants); err != nil {
+			return fmt.Errorf("invalid merchant config: %v", err)
+		}
+	}
+
+	report, err := replay.Replay(context.Background(), events, cfg)
+	if err != nil {
+		return err
+	}
+	if opts.asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	printReport(os.Stdout, report, opts.verbose)
+	return nil
+}
+
+// newEstimator 按名称创建预估器，同时返回其可调整的公共参数
+func newEstimator(name string) (oqueue.Estimator, *oqueue.DefaultEstimator, error) {
+	switch name {
+	case "default":
+		e := oqueue.NewDefaultEstimator()
+		return e, e, nil
+	case "ewma":
+		e := oqueue.NewEWMAEstimator()
+		return e, &e.DefaultEstimator, nil
+	case "hourly":
+		e := oqueue.NewHourlyEstimator()
+		return e, &e.DefaultEstimator, nil
+	case "parallel":
+		e := oqueue.NewParallelEstimator()
+		return e, &e.DefaultEstimator, nil
+	}
+	return nil, nil, fmt.Errorf("unknown estimator: %s", name)
+}
+
+// printReport 以表格输出报告
+func printReport(out io.Writer, report *replay.Report, verbose bool) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	if verbose {
+		fmt.Fprintln(w, "MERCHANT\tORDER\tITEMS\tPOSITION\tPREDICTED\tP90\tACTUAL\tDEVIATION")
+		for _, r := range report.Orders {
+			actual, deviation := "-", "-"
+			if r.Completed {
+				actual, deviation = r.Actual.Round(time.Second).String(), r.Deviation().Round(time.Second).String()
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\n", r.MerchantID, r.OrderID, r.NumOfItems, r.Position,
+				r.Predicted.Round(time.Second), r.P90.Round(time.Second), actual, deviation)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w, "MERCHANT\tORDERS\tCOMPLETED\tMAE\tBIAS\tRMSE\tP90 COVERAGE")
+	printSummary(w, "(all)", report.Summary)
+	merchants := make([]string, 0, len(report.ByMerchant))
+	for merchantID := range report.ByMerchant {
+		merchants = append(merchants, merchantID)
+	}
+	sort.Strings(merchants)
+	for _, merchantID := range merchants {
+		printSummary(w, merchantID, report.ByMerchant[merchantID])
+	}
+	w.Flush()
+
+	if len(report.Failures) > 0 {
+		fmt.Fprintf(out, "\n%d events failed:\n", len(report.Failures))
+		for _, f := range report.Failures {
+			fmt.Fprintf(out, "  #%d %s %s/%s: %s\n", f.Index, f.Event.Type, f.Event.MerchantID, f.Event.OrderID, f.Error)
+		}
+	}
+}
+
+// printSummary 输出一行汇总
+func printSummary(w io.Writer, name string, s replay.Summary) {
+	fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%.1f%%\n", name, s.Orders, s.Completed,
+		s.MeanAbsError.Round(time.Second), s.MeanError.Round(time.Second), s.RMSE.Round(time.Second), s.P90Coverage*100)
+}
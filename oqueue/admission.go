@@ -0,0 +1,218 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const defaultPickupSlot = 5 * time.Minute // 建议取餐时间默认按5分钟取整
+
+var (
+	// ErrQueueFull 队列已满，入队返回的 *QueueFullError 可通过 errors.Is 判断
+	ErrQueueFull = errors.New("queue full")
+	// ErrOrderingPaused 商家已暂停接单
+	ErrOrderingPaused = errors.New("ordering paused")
+)
+
+// AdmissionPolicy 商家准入策略，各上限为0时不限制
+// 准入检查与入队不是原子操作，并发入队时可能略微超出上限
+type AdmissionPolicy struct {
+	MaxOrders int           `json:"max_orders,omitempty"` // 队列中最多的订单数(含本单)
+	MaxItems  int           `json:"max_items,omitempty"`  // 队列中最多的商品数(含本单)
+	MaxWait   time.Duration `json:"max_wait,omitempty"`   // 本单预估等待时间的上限
+	// PickupSlot 建议取餐时间的取整粒度，为0时使用 defaultPickupSlot
+	PickupSlot time.Duration `json:"pickup_slot,omitempty"`
+	// Paused 暂停接单，ResumeAt 非零时到该时间自动恢复
+	Paused   bool      `json:"paused,omitempty"`
+	ResumeAt time.Time `json:"resume_at,omitempty"`
+}
+
+// limited 是否配置了队列上限
+func (p AdmissionPolicy) limited() bool {
+	return p.MaxOrders > 0 || p.MaxItems > 0 || p.MaxWait > 0
+}
+
+// pausedAt 在 now 时是否处于暂停接单
+func (p AdmissionPolicy) pausedAt(now time.Time) bool {
+	return p.Paused && (p.ResumeAt.IsZero() || now.Before(p.ResumeAt))
+}
+
+// pickupSlot 将时间向上取整到取餐时段
+func (p AdmissionPolicy) pickupSlot(t time.Time) time.Time {
+	slot := p.PickupSlot
+	if slot <= 0 {
+		slot = defaultPickupSlot
+	}
+	if rounded := t.Truncate(slot); rounded.Before(t) {
+		return rounded.Add(slot)
+	}
+	return t
+}
+
+// AdmissionLimit 触发拒单的限制
+type AdmissionLimit string
+
+const (
+	LimitPaused AdmissionLimit = "paused"     // 商家暂停接单
+	LimitOrders AdmissionLimit = "max_orders" // 订单数超出上限
+	LimitItems  AdmissionLimit = "max_items"  // 商品数超出上限
+	LimitWait   AdmissionLimit = "max_wait"   // 预估等待时间超出上限
+)
+
+// QueueFullError 订单因准入策略被拒绝
+// 暂停接单时 errors.Is(err, ErrOrderingPaused) 成立，其他情况 errors.Is(err, ErrQueueFull) 成立
+type QueueFullError struct {
+	MerchantID string
+	Limit      AdmissionLimit
+	Orders     int          // 队列中的订单数(不含本单)
+	Items      int          // 队列中的商品数(不含本单)
+	Wait       WaitEstimate // 本单的预估等待时间，仅 max_wait 时计算
+	// SuggestedPickup 建议的取餐时间，按 PickupSlot 取整；暂停接单且未设置恢复时间时为零值
+	SuggestedPickup time.Time
+}
+
+// Error 实现 error 接口
+func (e *QueueFullError) Error() string {
+	if e.Limit == LimitPaused {
+		return fmt.Sprintf("%v: merchant %s", ErrOrderingPaused, e.MerchantID)
+	}
+	return fmt.Sprintf("%v: merchant %s exceeds %s", ErrQueueFull, e.MerchantID, e.Limit)
+}
+
+// Unwrap 返回对应的哨兵错误
+func (e *QueueFullError) Unwrap() error {
+	if e.Limit == LimitPaused {
+		return ErrOrderingPaused
+	}
+	return ErrQueueFull
+}
+
+// admission 一次入队过程中某商家的准入状态
+// 批量入队时同一商家已准入的订单计入后续订单的检查
+type admission struct {
+	merchantID string
+	cfg        MerchantConfig
+	now        time.Time
+	items      []int // 队列中及本批已准入订单的商品数
+	data       estimateData
+}
+
+// newAdmission 读取准入检查所需的队列状态
+// 商家未配置上限时不读取队列，返回的 admission 只检查暂停状态
+func (q *QueueSystem) newAdmission(ctx context.Context, merchantID string, cfg MerchantConfig) (*admission, error) {
+	a := &admission{merchantID: merchantID, cfg: cfg, now: q.now()}
+	policy := cfg.Admission
+	if policy.pausedAt(a.now) || !policy.limited() {
+		return a, nil
+	}
+
+	day := q.currentDay(cfg)
+	items, err := q.queueItems(ctx, merchantID, day, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	a.items = items
+	// 拒单时需要预估建议的取餐时间，因此总是读取预估数据
+	if a.data, err = q.loadEstimateData(ctx, merchantID, day); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// admit 检查订单能否入队，通过时将其计入队列
+func (q *QueueSystem) admit(ctx context.Context, a *admission, lane Lane, orderItems int) error {
+	policy := a.cfg.Admission
+	if policy.pausedAt(a.now) {
+		return pausedError(a.merchantID, policy)
+	}
+	if !policy.limited() {
+		return nil
+	}
+
+	var total int
+	for _, n := range a.items {
+		total += n
+	}
+	e := &QueueFullError{MerchantID: a.merchantID, Orders: len(a.items), Items: total}
+	switch {
+	case policy.MaxOrders > 0 && len(a.items)+1 > policy.MaxOrders:
+		e.Limit = LimitOrders
+	case policy.MaxItems > 0 && total+orderItems > policy.MaxItems:
+		e.Limit = LimitItems
+	}
+
+	// 建议取餐时间为本单排在当前队列之后的预估出餐时间
+	if e.Limit != "" || policy.MaxWait > 0 {
+		estimate, err := q.estimateWithOvertakes(ctx, a.merchantID, a.cfg, a.data, lane, a.now, a.items, orderItems, false)
+		if err != nil {
+			return fmt.Errorf("failed to estimate wait time: %v", err)
+		}
+		if e.Limit == "" && estimate.Expected > policy.MaxWait {
+			e.Limit = LimitWait
+			e.Wait = estimate
+		}
+		if e.Limit != "" {
+			e.SuggestedPickup = policy.pickupSlot(a.now.Add(estimate.Expected))
+			return e
+		}
+	}
+
+	a.items = append(a.items, orderItems)
+	return nil
+}
+
+// pausedError 暂停接单的错误，设置了恢复时间时以其作为建议的取餐时间
+func pausedError(merchantID string, policy AdmissionPolicy) *QueueFullError {
+	e := &QueueFullError{MerchantID: merchantID, Limit: LimitPaused}
+	if !policy.ResumeAt.IsZero() {
+		e.SuggestedPickup = policy.pickupSlot(policy.ResumeAt)
+	}
+	return e
+}
+
+// CheckAdmission 检查商家当前能否接收 numOfItems 个商品的新订单
+// 可在下单前调用，被拒绝时返回 *QueueFullError，其中包含建议的取餐时间
+func (q *QueueSystem) CheckAdmission(ctx context.Context, merchantID string, numOfItems int) error {
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return err
+	}
+	a, err := q.newAdmission(ctx, merchantID, cfg)
+	if err != nil {
+		return err
+	}
+	return q.admit(ctx, a, LaneNormal, numOfItems)
+}
+
+// PauseOrdering 暂停商家接单，until 非零时到该时间自动恢复
+// 暂停期间入队返回 ErrOrderingPaused，已在队列中的订单不受影响
+func (q *QueueSystem) PauseOrdering(ctx context.Context, merchantID string, until time.Time) error {
+	return q.setPaused(ctx, merchantID, true, until, EventPaused)
+}
+
+// ResumeOrdering 恢复商家接单
+func (q *QueueSystem) ResumeOrdering(ctx context.Context, merchantID string) error {
+	return q.setPaused(ctx, merchantID, false, time.Time{}, EventResumed)
+}
+
+// setPaused 修改商家配置中的暂停状态并发布事件
+func (q *QueueSystem) setPaused(ctx context.Context, merchantID string, paused bool, until time.Time, event EventType) error {
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return err
+	}
+	cfg.Admission.Paused = paused
+	cfg.Admission.ResumeAt = until
+	if err := q.store.SetConfig(ctx, merchantID, cfg); err != nil {
+		return err
+	}
+
+	q.publishEvents(ctx, merchantID, QueueEvent{
+		Type:       event,
+		MerchantID: merchantID,
+		Time:       q.now().UnixMilli(),
+	})
+	return nil
+}
@@ -0,0 +1,119 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPickupSlot(t *testing.T) {
+	at := func(hour, min, sec int) time.Time { return time.Date(2026, 3, 2, hour, min, sec, 0, time.UTC) }
+	tests := []struct {
+		slot time.Duration
+		t    time.Time
+		want time.Time
+	}{
+		{0, at(10, 0, 0), at(10, 0, 0)},
+		{0, at(10, 0, 1), at(10, 5, 0)},
+		{0, at(10, 4, 59), at(10, 5, 0)},
+		{15 * time.Minute, at(10, 16, 0), at(10, 30, 0)},
+	}
+	for _, tt := range tests {
+		if got := (AdmissionPolicy{PickupSlot: tt.slot}).pickupSlot(tt.t); !got.Equal(tt.want) {
+			t.Errorf("pickupSlot(%v, %s) = %s, want %s", tt.slot, tt.t.Format("15:04:05"), got.Format("15:04:05"), tt.want.Format("15:04:05"))
+		}
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	tests := []struct {
+		name   string
+		policy AdmissionPolicy
+		items  []int // 依次入队的订单商品数
+		limit  AdmissionLimit
+	}{
+		{"unlimited", AdmissionPolicy{}, []int{5, 5, 5}, ""},
+		{"max orders", AdmissionPolicy{MaxOrders: 2}, []int{1, 1, 1}, LimitOrders},
+		{"max items", AdmissionPolicy{MaxItems: 5}, []int{2, 3, 1}, LimitItems},
+		{"max wait", AdmissionPolicy{MaxWait: 5 * time.Minute}, []int{1, 1}, LimitWait},
+		{"paused", AdmissionPolicy{Paused: true}, []int{1}, LimitPaused},
+		{"resumed", AdmissionPolicy{Paused: true, ResumeAt: now}, []int{1, 1}, ""},
+	}
+	for _, tt := range tests {
+		q := NewQueueSystemWithStore(NewMemoryStore(), WithLocation(time.UTC))
+		if err := q.SetMerchantConfig(ctx, "m1", MerchantConfig{Admission: tt.policy}); err != nil {
+			t.Fatal(err)
+		}
+
+		var err error
+		for i, n := range tt.items {
+			if err = q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: string(rune('a' + i)), NumOfItems: n}); err != nil {
+				break
+			}
+		}
+		if tt.limit == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		var full *QueueFullError
+		if !errors.As(err, &full) || full.Limit != tt.limit {
+			t.Errorf("%s: err = %v, want %s", tt.name, err, tt.limit)
+			continue
+		}
+		wantErr := ErrQueueFull
+		if tt.limit == LimitPaused {
+			wantErr = ErrOrderingPaused
+		}
+		if !errors.Is(err, wantErr) {
+			t.Errorf("%s: %v is not %v", tt.name, err, wantErr)
+		}
+		if tt.limit != LimitPaused && (!full.SuggestedPickup.After(now) || full.SuggestedPickup.Minute()%5 != 0) {
+			t.Errorf("%s: suggested pickup = %s", tt.name, full.SuggestedPickup)
+		}
+		if n, _, _ := q.GetMerchantQueueStatus(ctx, "m1"); n != len(tt.items)-1 {
+			t.Errorf("%s: queue = %d", tt.name, n)
+		}
+	}
+}
+
+func TestPauseOrdering(t *testing.T) {
+	ctx := context.Background()
+	q := NewQueueSystemWithStore(NewMemoryStore(), WithLocation(time.UTC))
+
+	resumeAt := time.Now().Add(12 * time.Minute)
+	if err := q.PauseOrdering(ctx, "m1", resumeAt); err != nil {
+		t.Fatal(err)
+	}
+	var full *QueueFullError
+	if err := q.CheckAdmission(ctx, "m1", 1); !errors.As(err, &full) || !errors.Is(err, ErrOrderingPaused) {
+		t.Fatalf("check while paused: %v", err)
+	}
+	if want := (AdmissionPolicy{}).pickupSlot(resumeAt); !full.SuggestedPickup.Equal(want) {
+		t.Errorf("suggested pickup = %s, want %s", full.SuggestedPickup, want)
+	}
+
+	// 已过恢复时间时不再拒单
+	if err := q.PauseOrdering(ctx, "m1", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.CheckAdmission(ctx, "m1", 1); err != nil {
+		t.Fatalf("check after resume time: %v", err)
+	}
+	if err := q.PauseOrdering(ctx, "m1", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 1}); !errors.Is(err, ErrOrderingPaused) {
+		t.Fatalf("enqueue while paused: %v", err)
+	}
+	if err := q.ResumeOrdering(ctx, "m1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 1}); err != nil {
+		t.Fatal(err)
+	}
+}
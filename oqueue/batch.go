@@ -0,0 +1,255 @@
+package oqueue
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// BatchResult 批量操作中单个订单的结果
+type BatchResult struct {
+	OrderID string
+	Ticket  string // 分配的取餐号，仅批量入队时返回
+	Err     error  // 该订单的错误，如 ErrOrderAlreadyQueued、ErrTicketTaken、ErrOrderNotFound
+}
+
+// ArchivedOrder 清空队列时归档的订单
+type ArchivedOrder struct {
+	OrderRecord
+	EnqueueAt  int64     `json:"enqueue_at"` // 入队时间(纳秒)
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// EnqueueOrders 批量入队，Redis 存储中所有订单的入队脚本在一个管道中执行
+// 返回结果与 orders 一一对应；只有读取商家配置、队列状态或存储整体失败时返回 error
+// 准入检查时同一商家本批已准入的订单计入队列，超出上限的订单返回 *QueueFullError
+func (q *QueueSystem) EnqueueOrders(ctx context.Context, orders []OrderInfo) ([]BatchResult, error) {
+	results := make([]BatchResult, len(orders))
+	configs := make(map[string]MerchantConfig)
+	admissions := make(map[string]*admission)
+	reqs := make([]EnqueueRequest, 0, len(orders))
+	index := make([]int, 0, len(orders)) // 各请求对应的订单下标
+
+	orders = append([]OrderInfo(nil), orders...)
+	for i := range orders {
+		results[i].OrderID = orders[i].OrderID
+
+		cfg, ok := configs[orders[i].MerchantID]
+		if !ok {
+			var err error
+			cfg, err = q.GetMerchantConfig(ctx, orders[i].MerchantID)
+			if err != nil {
+				return nil, err
+			}
+			configs[orders[i].MerchantID] = cfg
+			if admissions[orders[i].MerchantID], err = q.newAdmission(ctx, orders[i].MerchantID, cfg); err != nil {
+				return nil, err
+			}
+		}
+
+		req, err := q.enqueueRequest(cfg, &orders[i])
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		if err := q.admit(ctx, admissions[orders[i].MerchantID], orders[i].Lane, orders[i].NumOfItems); err != nil {
+			results[i].Err = err
+			continue
+		}
+		reqs = append(reqs, req)
+		index = append(index, i)
+	}
+
+	stored, err := q.store.Enqueue(ctx, reqs)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(map[string][]QueueEvent)
+	enqueued := make(map[string][]string)
+	var merchants []string
+	var lookups []OrderInfo
+	for j, result := range stored {
+		i := index[j]
+		results[i].Ticket, results[i].Err = result.Ticket, result.Err
+		if results[i].Err == nil {
+			if _, ok := events[orders[i].MerchantID]; !ok {
+				merchants = append(merchants, orders[i].MerchantID)
+			}
+			events[orders[i].MerchantID] = append(events[orders[i].MerchantID], enqueuedEvent(orders[i], result.Position, q.now()))
+			enqueued[orders[i].MerchantID] = append(enqueued[orders[i].MerchantID], orders[i].OrderID)
+			lookups = append(lookups, orders[i])
+		}
+	}
+	if len(merchants) > 0 {
+		q.markActive(ctx, merchants...)
+		q.setOrderMerchants(ctx, lookups)
+	}
+	for merchantID, list := range events {
+		q.publishEvents(ctx, merchantID, list...)
+	}
+	// 每个商家只读取一次统计与队列来记录入队预估
+	for merchantID, orderIDs := range enqueued {
+		q.recordEnqueueEstimates(ctx, configs[merchantID], merchantID, orderIDs)
+	}
+	return results, nil
+}
+
+// CompleteOrders 批量完成同一商家的订单，结果与 orderIDs 一一对应
+func (q *QueueSystem) CompleteOrders(ctx context.Context, merchantID string, orderIDs []string) ([]BatchResult, error) {
+	return q.TransitionOrders(ctx, merchantID, orderIDs, StateReady)
+}
+
+// TransitionOrders 批量将同一商家的订单流转到目标状态，结果与 orderIDs 一一对应
+func (q *QueueSystem) TransitionOrders(ctx context.Context, merchantID string, orderIDs []string, target OrderState) ([]BatchResult, error) {
+	if _, ok := transitions[target]; !ok {
+		return nil, fmt.Errorf("%w: -> %s", ErrInvalidTransition, target)
+	}
+
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	days, err := q.locateOrders(ctx, merchantID, cfg, orderIDs)
+	if err != nil {
+		return nil, err
+	}
+	return q.transitionBatch(ctx, merchantID, cfg, orderIDs, days, target)
+}
+
+// transitionBatch 批量流转订单，days 为各订单所在营业日
+func (q *QueueSystem) transitionBatch(ctx context.Context, merchantID string, cfg MerchantConfig, orderIDs []string, days map[string]string, target OrderState) ([]BatchResult, error) {
+	results := make([]BatchResult, len(orderIDs))
+	reqs := make([]TransitionRequest, 0, len(orderIDs))
+	index := make([]int, 0, len(orderIDs))
+	for i, orderID := range orderIDs {
+		results[i].OrderID = orderID
+		day, ok := days[orderID]
+		if !ok {
+			results[i].Err = ErrOrderNotFound
+			continue
+		}
+		reqs = append(reqs, q.transitionRequest(cfg, merchantID, day, orderID, target))
+		index = append(index, i)
+	}
+
+	stored, err := q.store.Transition(ctx, reqs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := q.now()
+	var events []QueueEvent
+	var history []historyEntry
+	var transitioned []string
+	pending := make(map[string]map[string][]Station) // 营业日 -> 订单ID -> 未完成的工位
+	for j, result := range stored {
+		i := index[j]
+		if result.Err != nil {
+			results[i].Err = result.Err
+			continue
+		}
+		if len(result.Pending) > 0 {
+			day := days[orderIDs[i]]
+			if pending[day] == nil {
+				pending[day] = make(map[string][]Station)
+			}
+			pending[day][orderIDs[i]] = result.Pending
+		}
+		events = append(events, transitionEvents(merchantID, orderIDs[i], result.Previous, target, result.Position, now)...)
+		history = append(history, historyEntry{orderID: orderIDs[i], day: days[orderIDs[i]]})
+		transitioned = append(transitioned, orderIDs[i])
+	}
+	for day, tickets := range pending {
+		q.removeStationTickets(ctx, merchantID, day, tickets)
+	}
+	if !target.IsLive() && len(transitioned) > 0 {
+		q.releaseOrderMerchants(ctx, merchantID, transitioned)
+	}
+	if len(events) > 0 {
+		q.publishEvents(ctx, merchantID, events...)
+	}
+	if q.archiver != nil && !target.IsLive() && len(history) > 0 {
+		q.recordHistory(ctx, merchantID, history)
+	}
+	return results, nil
+}
+
+// ClearMerchantQueue 清空商家队列，返回清除的订单数
+// 当前及上一营业日仍在排队或制作中的订单会被取消，并归档供 GetArchivedOrders 查询
+// 期间已被其他操作完成或取消的订单会被跳过
+func (q *QueueSystem) ClearMerchantQueue(ctx context.Context, merchantID string) (int, error) {
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return 0, err
+	}
+
+	var cleared int
+	for _, day := range []string{q.previousDay(cfg), q.currentDay(cfg)} {
+		n, err := q.clearQueueDay(ctx, merchantID, cfg, day)
+		cleared += n
+		if err != nil {
+			return cleared, err
+		}
+	}
+	return cleared, nil
+}
+
+// clearQueueDay 清空商家某营业日的队列
+func (q *QueueSystem) clearQueueDay(ctx context.Context, merchantID string, cfg MerchantConfig, day string) (int, error) {
+	queued, err := q.store.QueueOrders(ctx, merchantID, day, 0, -1)
+	if err != nil {
+		return 0, err
+	}
+
+	orderIDs := make([]string, 0, len(queued))
+	days := make(map[string]string, len(queued))
+	for _, info := range queued {
+		orderIDs = append(orderIDs, info.OrderID)
+		days[info.OrderID] = day
+	}
+	if len(orderIDs) == 0 {
+		return 0, nil
+	}
+
+	// 先读取记录再取消，归档取消前的完整信息
+	records, err := q.store.OrderRecords(ctx, merchantID, day, orderIDs)
+	if err != nil {
+		return 0, err
+	}
+	results, err := q.transitionBatch(ctx, merchantID, cfg, orderIDs, days, StateCancelled)
+	if err != nil {
+		return 0, err
+	}
+
+	cancelled := make(map[string]bool, len(results))
+	for _, result := range results {
+		if result.Err == nil {
+			cancelled[result.OrderID] = true
+		}
+	}
+
+	now := q.now()
+	archive := make([]ArchivedOrder, 0, len(cancelled))
+	for _, record := range records {
+		if !cancelled[record.OrderID] {
+			continue
+		}
+		record.State = StateCancelled
+		record.Transitions[StateCancelled] = now
+		archive = append(archive, ArchivedOrder{
+			OrderRecord: *record,
+			EnqueueAt:   record.EnqueueTime.UnixNano(),
+			ArchivedAt:  now,
+		})
+	}
+	if err := q.store.ArchiveOrders(ctx, merchantID, day, archive); err != nil {
+		return len(cancelled), err
+	}
+	return len(cancelled), nil
+}
+
+// GetArchivedOrders 获取商家某营业日(2006-01-02)清空队列时归档的订单
+func (q *QueueSystem) GetArchivedOrders(ctx context.Context, merchantID, day string) ([]ArchivedOrder, error) {
+	return q.store.ArchivedOrders(ctx, merchantID, day)
+}
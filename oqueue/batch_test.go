@@ -0,0 +1,137 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEnqueueOrders(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+	if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: "o0", NumOfItems: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := q.EnqueueOrders(ctx, []OrderInfo{
+		{MerchantID: "m1", OrderID: "o1", NumOfItems: 1},
+		{MerchantID: "m2", OrderID: "o1", NumOfItems: 2},
+		{MerchantID: "m1", OrderID: "o0", NumOfItems: 1},
+		{MerchantID: "m1", OrderID: "o2", NumOfItems: 1, Ticket: "A001"},
+		{MerchantID: "m1", OrderID: "o3", NumOfItems: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		orderID string
+		ticket  string
+		wantErr error
+	}{
+		{"o1", "A002", nil},
+		{"o1", "A001", nil},
+		{"o0", "", ErrOrderAlreadyQueued},
+		{"o2", "", ErrTicketTaken},
+		{"o3", "A003", nil},
+	}
+	for i, tt := range tests {
+		r := results[i]
+		if r.OrderID != tt.orderID || r.Ticket != tt.ticket || !errors.Is(r.Err, tt.wantErr) {
+			t.Errorf("result %d = %+v, want %s %s %v", i, r, tt.orderID, tt.ticket, tt.wantErr)
+		}
+	}
+	for merchantID, want := range map[string]int{"m1": 3, "m2": 1} {
+		if n, _, err := q.GetMerchantQueueStatus(ctx, merchantID); err != nil || n != want {
+			t.Errorf("%s: queue = %d, %v", merchantID, n, err)
+		}
+	}
+}
+
+func TestCompleteOrders(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+	for _, id := range []string{"o1", "o2", "o3"} {
+		order := OrderInfo{MerchantID: "m1", OrderID: id, NumOfItems: 1, EnqueueTime: time.Now().Add(-3 * time.Minute)}
+		if err := q.EnqueueOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.CancelOrder(ctx, "m1", "o2"); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := q.CompleteOrders(ctx, "m1", []string{"o1", "o2", "missing", "o3", "o1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []error{nil, ErrOrderAlreadyDequeued, ErrOrderNotFound, nil, ErrOrderAlreadyCompleted}
+	for i, r := range results {
+		if !errors.Is(r.Err, want[i]) {
+			t.Errorf("result %d = %+v, want %v", i, r, want[i])
+		}
+	}
+	stats, err := q.GetMerchantStats(ctx, "m1")
+	if err != nil || stats.ProcessedOrders != 2 {
+		t.Fatalf("processed = %d, %v", stats.ProcessedOrders, err)
+	}
+}
+
+func TestClearMerchantQueue(t *testing.T) {
+	ctx := context.Background()
+	q, m := newTestQueue(t)
+	if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: "yesterday", NumOfItems: 1}); err != nil {
+		t.Fatal(err)
+	}
+	moveToPreviousDay(t, q, "m1", "yesterday")
+	for _, id := range []string{"o1", "o2", "done"} {
+		if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: id, NumOfItems: 2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.CompleteMerchantOrder(ctx, "m1", "done"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m2", OrderID: "o1", NumOfItems: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	cleared, err := q.ClearMerchantQueue(ctx, "m1")
+	if err != nil || cleared != 3 {
+		t.Fatalf("cleared = %d, %v", cleared, err)
+	}
+	if n, _, _ := q.GetMerchantQueueStatus(ctx, "m1"); n != 0 {
+		t.Fatalf("queue after clear = %d", n)
+	}
+	if n, _, _ := q.GetMerchantQueueStatus(ctx, "m2"); n != 1 {
+		t.Fatalf("queue of other merchant = %d", n)
+	}
+
+	tests := []struct {
+		day  string
+		want []string
+	}{
+		{q.previousDay(MerchantConfig{}), []string{"yesterday"}},
+		{q.currentDay(MerchantConfig{}), []string{"o1", "o2"}},
+	}
+	for _, tt := range tests {
+		archived, err := q.GetArchivedOrders(ctx, "m1", tt.day)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(archived) != len(tt.want) {
+			t.Fatalf("%s: archived = %+v", tt.day, archived)
+		}
+		for i, order := range archived {
+			if order.OrderID != tt.want[i] || order.State != StateCancelled || order.ArchivedAt.IsZero() {
+				t.Errorf("%s: archived %d = %+v", tt.day, i, order)
+			}
+		}
+	}
+	if m.Exists("order_merchant:o2") || !m.Exists("order_merchant:o1") {
+		t.Fatal("merchant lookup after clear")
+	}
+	if cleared, err := q.ClearMerchantQueue(ctx, "m1"); err != nil || cleared != 0 {
+		t.Fatalf("clear again = %d, %v", cleared, err)
+	}
+}
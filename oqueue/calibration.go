@@ -0,0 +1,34 @@
+package oqueue
+
+// CalibrationPolicy 缓冲系数自动校准策略
+// 每单出餐后计算使其预估恰好准确的缓冲系数，按统计半衰期衰减加权平均作为商家的校准值
+type CalibrationPolicy struct {
+	MinSamples    float64 // 参与校准的订单数达到该值后才使用校准值
+	MinBuffer     float64 // 校准值下限
+	MaxBuffer     float64 // 校准值上限
+	InitialBuffer float64 // 样本不足时使用的缓冲系数
+}
+
+// defaultCalibrationPolicy 默认校准策略
+var defaultCalibrationPolicy = CalibrationPolicy{
+	MinSamples:    20,
+	MinBuffer:     1.0,
+	MaxBuffer:     2.0,
+	InitialBuffer: defaultBufferFactor,
+}
+
+// bufferFactor 根据商家统计获取校准后的缓冲系数
+func (p CalibrationPolicy) bufferFactor(stats MerchantStats) float64 {
+	if stats.CalibrationWeight < p.MinSamples || stats.CalibratedBuffer <= 0 {
+		return p.InitialBuffer
+	}
+
+	buffer := stats.CalibratedBuffer
+	if buffer < p.MinBuffer {
+		buffer = p.MinBuffer
+	}
+	if buffer > p.MaxBuffer {
+		buffer = p.MaxBuffer
+	}
+	return buffer
+}
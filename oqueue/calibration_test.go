@@ -0,0 +1,119 @@
+package oqueue
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCalibrationBufferFactor(t *testing.T) {
+	policy := CalibrationPolicy{MinSamples: 10, MinBuffer: 1, MaxBuffer: 2, InitialBuffer: 1.2}
+	tests := []struct {
+		name  string
+		stats MerchantStats
+		want  float64
+	}{
+		{"no samples", MerchantStats{}, 1.2},
+		{"too few samples", MerchantStats{CalibrationWeight: 9, CalibratedBuffer: 1.5}, 1.2},
+		{"calibrated", MerchantStats{CalibrationWeight: 10, CalibratedBuffer: 1.5}, 1.5},
+		{"below minimum", MerchantStats{CalibrationWeight: 10, CalibratedBuffer: 0.6}, 1},
+		{"above maximum", MerchantStats{CalibrationWeight: 10, CalibratedBuffer: 3}, 2},
+	}
+	for _, tt := range tests {
+		if got := policy.bufferFactor(tt.stats); got != tt.want {
+			t.Errorf("%s: bufferFactor = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateAccuracy(t *testing.T) {
+	ctx := context.Background()
+	q, m := newTestQueue(t, WithBufferCalibration(CalibrationPolicy{MinSamples: 2}))
+	day := q.currentDay(MerchantConfig{})
+	rs := q.store.(*RedisStore)
+
+	// 队列为空时 1 件商品预估 (1m + 2m) × 1.2，每单实际用时为预估的2倍
+	estimate := 3*time.Minute + 36*time.Second
+	for _, id := range []string{"o1", "o2", "o3"} {
+		enqueued := time.Now().Add(-2 * estimate)
+		if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: id, NumOfItems: 1, EnqueueTime: enqueued}); err != nil {
+			t.Fatal(err)
+		}
+		record, err := q.GetOrderRecord(ctx, "m1", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.EstimatedWait.Expected != estimate {
+			t.Fatalf("%s: estimate = %v", id, record.EstimatedWait.Expected)
+		}
+		m.HSet(rs.getOrderKey("m1", day, id), "queued_at", strconv.FormatInt(enqueued.UnixMilli(), 10))
+		if err := q.CompleteMerchantOrder(ctx, "m1", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := q.GetMerchantStats(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 实际用时包含测试执行时间，允许少量误差
+	if stats.EstimatedOrders < 2.9 || (stats.Bias-estimate).Abs() > time.Second || (stats.MeanAbsError-estimate).Abs() > time.Second {
+		t.Fatalf("accuracy = %v orders, bias %v, mae %v", stats.EstimatedOrders, stats.Bias, stats.MeanAbsError)
+	}
+	if math.Abs(stats.CalibratedBuffer-2.4) > 1e-2 {
+		t.Fatalf("calibrated buffer = %v", stats.CalibratedBuffer)
+	}
+
+	// 校准值超过上限时按上限 2.0 预估
+	wait, err := q.EstimateNewOrderWait(ctx, "m1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait.Expected != 6*time.Minute {
+		t.Fatalf("calibrated estimate = %v", wait.Expected)
+	}
+}
+
+func TestEnqueueOrdersRecordsEstimates(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+
+	// 批量入队与逐单入队记录的位置及预估一致
+	var batch []OrderInfo
+	for i, items := range []int{1, 3, 2} {
+		id := "o" + strconv.Itoa(i+1)
+		batch = append(batch, OrderInfo{MerchantID: "batch", OrderID: id, NumOfItems: items})
+		if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "single", OrderID: id, NumOfItems: items}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	results, err := q.EnqueueOrders(ctx, batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var last time.Duration
+	for i, result := range results {
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		got, err := q.GetOrderRecord(ctx, "batch", result.OrderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := q.GetOrderRecord(ctx, "single", result.OrderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.EnqueuePosition != int64(i) || got.EstimatedWait != want.EstimatedWait {
+			t.Errorf("%s: batch %d %+v, single %d %+v", result.OrderID,
+				got.EnqueuePosition, got.EstimatedWait, want.EnqueuePosition, want.EstimatedWait)
+		}
+		if got.EstimatedWait.Expected <= last {
+			t.Errorf("%s: estimate %v not after %v", result.OrderID, got.EstimatedWait.Expected, last)
+		}
+		last = got.EstimatedWait.Expected
+	}
+}
@@ -0,0 +1,139 @@
+package oqueue
+
+import (
+	"container/heap"
+	"context"
+	"time"
+)
+
+const defaultP90Factor = 1.5 // 默认P90相对平均处理时间的倍数
+
+// CapacityConfig 商家出餐产能配置
+type CapacityConfig struct {
+	Stations int              `json:"stations,omitempty"` // 默认并行工位数(咖啡师/厨师人数)
+	Windows  []CapacityWindow `json:"windows,omitempty"`  // 按时段覆盖工位数
+}
+
+// CapacityWindow 某时段的工位数
+// Start/End 为商家所在时区的 15:04 格式，End 小于 Start 时表示跨越零点
+type CapacityWindow struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Stations int    `json:"stations"`
+}
+
+// StationsAt 获取指定时间的工位数，未配置时为1
+func (c CapacityConfig) StationsAt(t time.Time) int {
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range c.Windows {
+		start, err1 := time.Parse("15:04", w.Start)
+		end, err2 := time.Parse("15:04", w.End)
+		if err1 != nil || err2 != nil || w.Stations <= 0 {
+			continue
+		}
+		from := start.Hour()*60 + start.Minute()
+		to := end.Hour()*60 + end.Minute()
+
+		var in bool
+		if from <= to {
+			in = minute >= from && minute < to
+		} else {
+			in = minute >= from || minute < to
+		}
+		if in {
+			return w.Stations
+		}
+	}
+
+	if c.Stations > 0 {
+		return c.Stations
+	}
+	return 1
+}
+
+// ParallelEstimator 多工位并行预估器
+// 按队列顺序将前面的订单分配给最先空闲的工位，模拟出本单的出餐时间
+// 已在队列中的订单与 DefaultEstimator 一致，预估的是轮到本单开始制作的时间，不计缓冲
+type ParallelEstimator struct {
+	DefaultEstimator
+	P90Factor float64 // 历史样本不足时，P90每单处理时间相对平均值的倍数
+}
+
+// NewParallelEstimator 创建多工位并行预估器
+func NewParallelEstimator() *ParallelEstimator {
+	return &ParallelEstimator{
+		DefaultEstimator: *NewDefaultEstimator(),
+		P90Factor:        defaultP90Factor,
+	}
+}
+
+// Estimate 预估本单的出餐时间
+func (e *ParallelEstimator) Estimate(ctx context.Context, in EstimateInput) (time.Duration, error) {
+	estimate, err := e.EstimateRange(ctx, in)
+	return estimate.Expected, err
+}
+
+// EstimateRange 预估本单的出餐时间及其P90
+func (e *ParallelEstimator) EstimateRange(_ context.Context, in EstimateInput) (WaitEstimate, error) {
+	itemTime := e.itemTime(in)
+
+	expected := e.simulate(in, itemTime, 1)
+	if !in.Queued {
+		expected = time.Duration(float64(expected) * e.bufferFactor(in))
+	}
+
+	// 样本足够时直接使用历史P90，否则按倍数放大
+	var p90 time.Duration
+	if in.Stats.SampleWeight >= float64(e.MinProcessedOrders) && in.Stats.P90ItemTime > 0 {
+		p90 = e.simulate(in, in.Stats.P90ItemTime, 1)
+	} else {
+		p90 = e.simulate(in, itemTime, e.P90Factor)
+	}
+	if p90 < expected {
+		p90 = expected
+	}
+
+	return WaitEstimate{Expected: expected, P90: p90}, nil
+}
+
+// simulate 模拟多个工位并行处理，返回本单完成的时间，已在队列中的订单返回开始制作的时间
+// factor 为每单处理时间的放大倍数
+func (e *ParallelEstimator) simulate(in EstimateInput, itemTime time.Duration, factor float64) time.Duration {
+	stations := in.Stations
+	if stations < 1 {
+		stations = 1
+	}
+
+	duration := func(items int) time.Duration {
+		d := time.Duration(items)*itemTime + e.BaseProcessTime
+		return time.Duration(float64(d) * factor)
+	}
+
+	// 各工位的空闲时间
+	free := make(stationHeap, stations)
+	for _, items := range in.PrecedingOrderItems {
+		start := heap.Pop(&free).(time.Duration)
+		heap.Push(&free, start+duration(items))
+	}
+
+	start := heap.Pop(&free).(time.Duration)
+	if in.Queued {
+		return start
+	}
+	return start + duration(in.OrderItems)
+}
+
+// stationHeap 工位空闲时间小顶堆
+type stationHeap []time.Duration
+
+func (h stationHeap) Len() int            { return len(h) }
+func (h stationHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h stationHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *stationHeap) Push(x interface{}) { *h = append(*h, x.(time.Duration)) }
+func (h *stationHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
@@ -0,0 +1,162 @@
+package oqueue
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStationsAt(t *testing.T) {
+	cfg := CapacityConfig{
+		Stations: 2,
+		Windows: []CapacityWindow{
+			{Start: "11:00", End: "13:30", Stations: 4},
+			{Start: "22:00", End: "02:00", Stations: 1},
+			{Start: "bad", End: "09:00", Stations: 9},
+			{Start: "08:00", End: "09:00", Stations: 0},
+		},
+	}
+	at := func(hour, min int) time.Time { return time.Date(2026, 3, 2, hour, min, 0, 0, time.UTC) }
+	tests := []struct {
+		cfg  CapacityConfig
+		t    time.Time
+		want int
+	}{
+		{cfg, at(10, 59), 2},
+		{cfg, at(11, 0), 4},
+		{cfg, at(13, 29), 4},
+		{cfg, at(13, 30), 2},
+		{cfg, at(23, 0), 1},
+		{cfg, at(1, 59), 1},
+		{cfg, at(2, 0), 2},
+		{cfg, at(8, 30), 2},
+		{CapacityConfig{}, at(12, 0), 1},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.StationsAt(tt.t); got != tt.want {
+			t.Errorf("StationsAt(%s) = %d, want %d", tt.t.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestParallelEstimator(t *testing.T) {
+	tests := []struct {
+		name          string
+		in            EstimateInput
+		expected, p90 time.Duration
+	}{
+		{
+			"single station",
+			EstimateInput{PrecedingOrderItems: []int{2, 1}, OrderItems: 2, Stations: 1},
+			13*time.Minute + 12*time.Second, 16*time.Minute + 30*time.Second,
+		},
+		{
+			"two stations",
+			EstimateInput{PrecedingOrderItems: []int{2, 1}, OrderItems: 2, Stations: 2},
+			8*time.Minute + 24*time.Second, 10*time.Minute + 30*time.Second,
+		},
+		{
+			"more stations than orders",
+			EstimateInput{PrecedingOrderItems: []int{2, 1}, OrderItems: 1, Stations: 4},
+			3*time.Minute + 36*time.Second, 4*time.Minute + 30*time.Second,
+		},
+		{
+			"no stations configured",
+			EstimateInput{OrderItems: 1},
+			3*time.Minute + 36*time.Second, 4*time.Minute + 30*time.Second,
+		},
+		{
+			"historical p90",
+			EstimateInput{
+				OrderItems: 1,
+				Stations:   1,
+				Stats:      MerchantStats{ProcessedOrders: 10, SampleWeight: 10, AvgItemTime: time.Minute, P90ItemTime: 3 * time.Minute},
+			},
+			3*time.Minute + 36*time.Second, 5 * time.Minute,
+		},
+		{
+			"queued head",
+			EstimateInput{OrderItems: 3, Stations: 1, Queued: true},
+			0, 0,
+		},
+		{
+			"queued single station",
+			EstimateInput{PrecedingOrderItems: []int{2, 1}, OrderItems: 2, Stations: 1, Queued: true},
+			7 * time.Minute, 10*time.Minute + 30*time.Second,
+		},
+		{
+			"queued two stations",
+			EstimateInput{PrecedingOrderItems: []int{2, 1}, OrderItems: 2, Stations: 2, Queued: true},
+			3 * time.Minute, 4*time.Minute + 30*time.Second,
+		},
+	}
+	e := NewParallelEstimator()
+	for _, tt := range tests {
+		got, err := e.EstimateRange(context.Background(), tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Expected != tt.expected || got.P90 != tt.p90 {
+			t.Errorf("%s: estimate = %v / %v, want %v / %v", tt.name, got.Expected, got.P90, tt.expected, tt.p90)
+		}
+	}
+}
+
+func TestQueuedEstimatorsAgree(t *testing.T) {
+	// 单工位时并行预估器与默认预估器对已在队列中订单的预估一致，队首订单均为0
+	tests := [][]int{nil, {1}, {2, 1, 3}}
+	for _, preceding := range tests {
+		in := EstimateInput{PrecedingOrders: len(preceding), PrecedingOrderItems: preceding, OrderItems: 2, Stations: 1, Queued: true}
+		for _, n := range preceding {
+			in.PrecedingItems += n
+		}
+		want, err := NewDefaultEstimator().Estimate(context.Background(), in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := NewParallelEstimator().Estimate(context.Background(), in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("preceding %v: parallel = %v, default = %v", preceding, got, want)
+		}
+		if len(preceding) == 0 && got != 0 {
+			t.Errorf("head of queue = %v", got)
+		}
+	}
+}
+
+func TestParallelEstimatorInQueue(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t, WithEstimator(NewParallelEstimator()))
+	if err := q.SetMerchantConfig(ctx, "m1", MerchantConfig{Capacity: CapacityConfig{Stations: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	for i, items := range []int{2, 1, 1} {
+		order := OrderInfo{MerchantID: "m1", OrderID: fmt.Sprintf("o%d", i+1), NumOfItems: items}
+		if err := q.EnqueueOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 两个工位: o1、o2 立即开始，o3 等 o2 完成(3分钟)
+	tests := []struct {
+		orderID string
+		want    time.Duration
+	}{
+		{"o1", 0},
+		{"o2", 0},
+		{"o3", 3 * time.Minute},
+	}
+	for _, tt := range tests {
+		_, wait, _, err := q.GetMerchantOrderPosition(ctx, "m1", tt.orderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait != tt.want {
+			t.Errorf("wait of %s = %v, want %v", tt.orderID, wait, tt.want)
+		}
+	}
+}
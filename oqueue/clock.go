@@ -0,0 +1,14 @@
+package oqueue
+
+import (
+	"github.com/open4go/p7/clock"
+	"time"
+)
+
+// Clock 时钟，默认使用系统时间，回放或测试时可通过 WithClock 替换为 clock.Fake
+type Clock = clock.Clock
+
+// now 获取队列系统的当前时间
+func (q *QueueSystem) now() time.Time {
+	return q.clock.Now()
+}
@@ -0,0 +1,305 @@
+package oqueue_test
+
+import (
+	"context"
+	"errors"
+	"github.com/open4go/p7/clock"
+	"github.com/open4go/p7/oqueue"
+	"testing"
+	"time"
+	_ "time/tzdata" // 商家时区使用 IANA 名称，不依赖运行环境的时区数据
+)
+
+// east8 无夏令时的东八区
+var east8 = time.FixedZone("UTC+8", 8*60*60)
+
+// at 构造 loc 时区的时间
+func at(loc *time.Location, year int, month time.Month, day, hour, min, sec int) time.Time {
+	return time.Date(year, month, day, hour, min, sec, 0, loc)
+}
+
+// newQueue 创建使用内存存储与 fake 时钟的队列系统，默认时区为 loc
+func newQueue(fake *clock.Fake, loc *time.Location) *oqueue.QueueSystem {
+	return oqueue.NewQueueSystemWithStore(oqueue.NewMemoryStore(), oqueue.WithClock(fake), oqueue.WithLocation(loc))
+}
+
+// enqueue 入队订单并返回取餐号，失败时终止测试
+func enqueue(t *testing.T, q *oqueue.QueueSystem, merchantID, orderID string, items int) string {
+	t.Helper()
+	ticket, err := q.EnqueueOrderWithTicket(context.Background(), oqueue.OrderInfo{MerchantID: merchantID, OrderID: orderID, NumOfItems: items})
+	if err != nil {
+		t.Fatalf("enqueue %s: %v", orderID, err)
+	}
+	return ticket
+}
+
+// assertDay 校验商家当前的营业日
+func assertDay(t *testing.T, q *oqueue.QueueSystem, merchantID, want string) {
+	t.Helper()
+	snapshot, err := q.GetQueueSnapshot(context.Background(), merchantID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Day != want {
+		t.Fatalf("day of %s = %s, want %s", merchantID, snapshot.Day, want)
+	}
+}
+
+// TestQueueMidnight 零点后进入新的营业日，取餐号重新编号，前一天的订单仍可完成
+func TestQueueMidnight(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(at(east8, 2026, 3, 10, 23, 59, 59))
+	q := newQueue(fake, east8)
+
+	if ticket := enqueue(t, q, "m1", "o1", 1); ticket != "A001" {
+		t.Fatalf("ticket = %s", ticket)
+	}
+	assertDay(t, q, "m1", "2026-03-10")
+
+	fake.Advance(time.Second)
+	assertDay(t, q, "m1", "2026-03-11")
+	if ticket := enqueue(t, q, "m1", "o2", 1); ticket != "A001" {
+		t.Fatalf("ticket after midnight = %s", ticket)
+	}
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o1"); err != nil {
+		t.Fatalf("complete order of previous day: %v", err)
+	}
+
+	// 超过一天后前一营业日的订单不再查找
+	fake.Advance(48 * time.Hour)
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o2"); !errors.Is(err, oqueue.ErrOrderNotFound) {
+		t.Fatalf("complete order two days ago: %v", err)
+	}
+}
+
+// TestQueueDayCutover 营业日切换时间之前的订单仍归属前一营业日
+func TestQueueDayCutover(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(at(east8, 2026, 3, 10, 23, 30, 0))
+	q := newQueue(fake, east8)
+	if err := q.SetMerchantConfig(ctx, "m1", oqueue.MerchantConfig{DayCutover: 4 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	enqueue(t, q, "m1", "o1", 1)
+	fake.Set(at(east8, 2026, 3, 11, 3, 59, 59))
+	assertDay(t, q, "m1", "2026-03-10")
+	if ticket := enqueue(t, q, "m1", "o2", 1); ticket != "A002" {
+		t.Fatalf("ticket before cutover = %s", ticket)
+	}
+
+	fake.Advance(time.Second)
+	assertDay(t, q, "m1", "2026-03-11")
+	if ticket := enqueue(t, q, "m1", "o3", 1); ticket != "A001" {
+		t.Fatalf("ticket after cutover = %s", ticket)
+	}
+}
+
+// TestQueueMonthBoundary 跨月、跨年与闰年2月的营业日
+func TestQueueMonthBoundary(t *testing.T) {
+	tests := []struct {
+		last, next time.Time
+		want       [2]string
+	}{
+		{at(east8, 2026, 1, 31, 23, 59, 59), at(east8, 2026, 2, 1, 0, 0, 0), [2]string{"2026-01-31", "2026-02-01"}},
+		{at(east8, 2026, 2, 28, 23, 59, 59), at(east8, 2026, 3, 1, 0, 0, 0), [2]string{"2026-02-28", "2026-03-01"}},
+		{at(east8, 2028, 2, 28, 23, 59, 59), at(east8, 2028, 2, 29, 0, 0, 0), [2]string{"2028-02-28", "2028-02-29"}},
+		{at(east8, 2026, 12, 31, 23, 59, 59), at(east8, 2027, 1, 1, 0, 0, 0), [2]string{"2026-12-31", "2027-01-01"}},
+	}
+	for _, tt := range tests {
+		fake := clock.NewFake(tt.last)
+		q := newQueue(fake, east8)
+		enqueue(t, q, "m1", "o1", 1)
+		assertDay(t, q, "m1", tt.want[0])
+
+		fake.Set(tt.next)
+		assertDay(t, q, "m1", tt.want[1])
+		if ticket := enqueue(t, q, "m1", "o2", 1); ticket != "A001" {
+			t.Fatalf("%s: ticket = %s", tt.want[1], ticket)
+		}
+	}
+}
+
+// TestQueueZones 同一时刻不同时区的商家按各自的本地日期划分营业日，分时段统计使用本地小时
+func TestQueueZones(t *testing.T) {
+	ctx := context.Background()
+	// 东八区已是3月1日凌晨，UTC 与西五区仍是2月28日
+	fake := clock.NewFake(time.Date(2026, 2, 28, 17, 30, 0, 0, time.UTC))
+	q := newQueue(fake, time.UTC)
+	if err := q.SetMerchantConfig(ctx, "east", oqueue.MerchantConfig{Location: "Etc/GMT-8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.SetMerchantConfig(ctx, "west", oqueue.MerchantConfig{Location: "Etc/GMT+5"}); err != nil {
+		t.Fatal(err)
+	}
+	assertDay(t, q, "east", "2026-03-01")
+	assertDay(t, q, "west", "2026-02-28")
+	assertDay(t, q, "utc", "2026-02-28")
+
+	enqueue(t, q, "east", "o1", 1)
+	enqueue(t, q, "west", "o1", 1)
+	fake.Advance(5 * time.Minute)
+	for merchantID, hour := range map[string]int{"east": 1, "west": 12} {
+		if err := q.CompleteMerchantOrder(ctx, merchantID, "o1"); err != nil {
+			t.Fatal(err)
+		}
+		stats, err := q.GetMerchantStats(ctx, merchantID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stats.HourlyOrders) != 1 || stats.HourlyOrders[hour] != 1 {
+			t.Fatalf("hourly orders of %s = %v, want hour %d", merchantID, stats.HourlyOrders, hour)
+		}
+	}
+}
+
+// TestQueueWaitTime 等待时间与统计按时钟精确计算
+func TestQueueWaitTime(t *testing.T) {
+	ctx := context.Background()
+	start := at(east8, 2026, 3, 10, 12, 0, 0)
+	fake := clock.NewFake(start)
+	q := newQueue(fake, east8)
+
+	enqueue(t, q, "m1", "o1", 2)
+	enqueue(t, q, "m1", "o2", 1)
+	fake.Advance(7 * time.Minute)
+	snapshot, err := q.GetQueueSnapshot(ctx, "m1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.LongestWaiting == nil || snapshot.LongestWaiting.OrderID != "o1" || snapshot.LongestWaiting.Age != 7*time.Minute {
+		t.Fatalf("longest waiting = %+v", snapshot.LongestWaiting)
+	}
+	if !snapshot.Time.Equal(start.Add(7 * time.Minute)) {
+		t.Fatalf("snapshot time = %v", snapshot.Time)
+	}
+
+	fake.Advance(3 * time.Minute)
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	record, err := q.GetOrderRecord(ctx, "m1", "o1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if waited := record.Transitions[oqueue.StateReady].Sub(record.Transitions[oqueue.StateQueued]); waited != 10*time.Minute {
+		t.Fatalf("waited = %v", waited)
+	}
+	stats, err := q.GetMerchantStats(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.ProcessedOrders != 1 || stats.AvgItemTime != 5*time.Minute {
+		t.Fatalf("processed = %d, avg item time = %v", stats.ProcessedOrders, stats.AvgItemTime)
+	}
+}
+
+// TestQueueExpiry 超时未完成的订单过期，暂停接单与预约订单按时钟到期
+func TestQueueExpiry(t *testing.T) {
+	ctx := context.Background()
+	start := at(east8, 2026, 3, 10, 23, 50, 0)
+	fake := clock.NewFake(start)
+	q := newQueue(fake, east8)
+	if err := q.SetMerchantConfig(ctx, "m1", oqueue.MerchantConfig{StaleAfter: 30 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 跨越零点的订单同样按入队时间过期，等待时间达到 StaleAfter 即过期
+	enqueue(t, q, "m1", "o1", 1)
+	fake.Advance(30*time.Minute - time.Millisecond)
+	expired, err := q.ReapStaleOrders(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 0 {
+		t.Fatalf("expired too early: %v", expired)
+	}
+	fake.Advance(time.Millisecond)
+	if expired, err = q.ReapStaleOrders(ctx, "m1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0] != "o1" {
+		t.Fatalf("expired = %v", expired)
+	}
+
+	resumeAt := fake.Now().Add(10 * time.Minute)
+	if err := q.PauseOrdering(ctx, "m1", resumeAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.EnqueueOrder(ctx, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o2", NumOfItems: 1}); !errors.Is(err, oqueue.ErrOrderingPaused) {
+		t.Fatalf("enqueue while paused: %v", err)
+	}
+	fake.Set(resumeAt)
+	enqueue(t, q, "m1", "o2", 1)
+
+	scheduled, err := q.ScheduleOrder(ctx, oqueue.OrderInfo{MerchantID: "m1", OrderID: "s1", NumOfItems: 1}, fake.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Set(scheduled.ReleaseAt.Add(-time.Millisecond))
+	released, err := q.ReleaseScheduledOrders(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(released) != 0 {
+		t.Fatalf("released too early: %v", released)
+	}
+	fake.Set(scheduled.ReleaseAt)
+	if released, err = q.ReleaseScheduledOrders(ctx, "m1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(released) != 1 || released[0] != "s1" {
+		t.Fatalf("released = %v", released)
+	}
+}
+
+// eventually 等待后台协程处理完成，超时后终止测试
+func eventually(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestBackgroundLoops 后台清理与预约放入的定时器由注入的时钟驱动
+func TestBackgroundLoops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fake := clock.NewFake(at(east8, 2026, 3, 10, 12, 0, 0))
+	q := newQueue(fake, east8)
+	if err := q.SetMerchantConfig(ctx, "m1", oqueue.MerchantConfig{StaleAfter: 30 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	enqueue(t, q, "m1", "o1", 1)
+	scheduled, err := q.ScheduleOrder(ctx, oqueue.OrderInfo{MerchantID: "m1", OrderID: "s1", NumOfItems: 1}, fake.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q.StartReaper(ctx, time.Minute)
+	q.StartScheduler(ctx, time.Minute)
+	state := func(orderID string) oqueue.OrderState {
+		record, err := q.GetOrderRecord(ctx, "m1", orderID)
+		if err != nil {
+			return ""
+		}
+		return record.State
+	}
+
+	// 推进到 StaleAfter 后清理协程将订单过期，预约订单尚未到放入时间
+	fake.Advance(30 * time.Minute)
+	eventually(t, "reaper", func() bool { return state("o1") == oqueue.StateExpired })
+	if pending, _ := q.GetScheduledOrders(ctx, "m1"); len(pending) != 1 {
+		t.Fatalf("released before release time: %+v", pending)
+	}
+
+	fake.Set(scheduled.ReleaseAt)
+	eventually(t, "scheduler", func() bool { return state("s1") == oqueue.StateQueued })
+	if pending, _ := q.GetScheduledOrders(ctx, "m1"); len(pending) != 0 {
+		t.Fatalf("pending = %+v", pending)
+	}
+}
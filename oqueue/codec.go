@@ -0,0 +1,84 @@
+package oqueue
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// memberVersion 队列成员编码版本
+const memberVersion = 1
+
+// orderMember 队列成员的JSON编码
+// 成员值即订单的完整信息，新增字段只需在 OrderInfo 中添加json标签
+type orderMember struct {
+	Version   int   `json:"v"`
+	EnqueueAt int64 `json:"enqueue_at"` // 入队时间(纳秒)
+	OrderInfo
+}
+
+// encodeOrderInfo 将订单编码为队列成员
+func encodeOrderInfo(order OrderInfo) (string, error) {
+	payload, err := json.Marshal(orderMember{
+		Version:   memberVersion,
+		EnqueueAt: order.EnqueueTime.UnixNano(),
+		OrderInfo: order,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
+
+// parseOrderInfo 解析队列成员，兼容旧版冒号分隔格式
+func parseOrderInfo(s string) (*OrderInfo, error) {
+	if !strings.HasPrefix(s, "{") {
+		return parseLegacyOrderInfo(s)
+	}
+
+	var m orderMember
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return nil, fmt.Errorf("invalid order info: %v", err)
+	}
+	if m.Version != memberVersion {
+		return nil, fmt.Errorf("unsupported order info version: %d", m.Version)
+	}
+
+	info := m.OrderInfo
+	info.EnqueueTime = time.Unix(0, m.EnqueueAt)
+	return &info, nil
+}
+
+// parseLegacyOrderInfo 解析旧版 merchant:order:items:unix 格式
+// 旧格式不包含 Timestamp，且订单ID中不能含有冒号
+func parseLegacyOrderInfo(s string) (*OrderInfo, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 4 {
+		return nil, fmt.Errorf("invalid order info format")
+	}
+
+	// The merchant ID might contain colons, so we need to handle that
+	// The last 3 parts are orderID, numOfItems, enqueueTime
+	// Everything before that is merchantID
+	merchantID := strings.Join(parts[:len(parts)-3], ":")
+	orderID := parts[len(parts)-3]
+
+	numOfItems, err := strconv.Atoi(parts[len(parts)-2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid numOfItems: %v", err)
+	}
+
+	enqueueTimeUnix, err := strconv.ParseInt(parts[len(parts)-1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %v", err)
+	}
+
+	return &OrderInfo{
+		MerchantID:  merchantID,
+		OrderID:     orderID,
+		NumOfItems:  numOfItems,
+		EnqueueTime: time.Unix(enqueueTimeUnix, 0),
+	}, nil
+}
@@ -0,0 +1,93 @@
+package oqueue
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrderInfoRoundTrip(t *testing.T) {
+	enqueued := time.Date(2026, 3, 2, 10, 0, 0, 123456789, time.UTC)
+	tests := []OrderInfo{
+		{MerchantID: "m1", OrderID: "o1", NumOfItems: 2, Timestamp: enqueued.UnixNano(), EnqueueTime: enqueued},
+		{MerchantID: "m:1", OrderID: "o:1", NumOfItems: 1, EnqueueTime: enqueued, Lane: LaneVIP, Channel: ChannelDelivery},
+		{MerchantID: "m1", OrderID: "o2", EnqueueTime: enqueued, Ticket: "A042"},
+	}
+	for _, order := range tests {
+		member, err := encodeOrderInfo(order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(member, `"v":1`) {
+			t.Fatalf("member = %s", member)
+		}
+		got, err := parseOrderInfo(member)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.EnqueueTime.Equal(order.EnqueueTime) {
+			t.Fatalf("enqueue time = %v, want %v", got.EnqueueTime, order.EnqueueTime)
+		}
+		got.EnqueueTime = order.EnqueueTime
+		if !reflect.DeepEqual(*got, order) {
+			t.Errorf("parsed = %+v, want %+v", *got, order)
+		}
+	}
+}
+
+func TestLegacyMemberInQueue(t *testing.T) {
+	ctx := context.Background()
+	q, m := newTestQueue(t)
+	day := q.currentDay(MerchantConfig{})
+	enqueued := time.Now().Add(-2 * time.Minute).Unix()
+	member := fmt.Sprintf("m1:o1:2:%d", enqueued)
+	if _, err := m.ZAdd("queue:{m1}:"+day, 1, member); err != nil {
+		t.Fatal(err)
+	}
+	m.HSet("queue_index:{m1}:"+day, "o1", member)
+	if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: "o2", NumOfItems: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	position, _, info, err := q.GetMerchantOrderPosition(ctx, "m1", "o2")
+	if err != nil || position != 1 || info.NumOfItems != 1 {
+		t.Fatalf("position of o2 = %d, %+v, %v", position, info, err)
+	}
+	if n, items, err := q.GetMerchantQueueStatus(ctx, "m1"); err != nil || n != 2 || items != 3 {
+		t.Fatalf("status = %d orders, %d items, %v", n, items, err)
+	}
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err := q.GetMerchantStats(ctx, "m1"); err != nil || stats.ProcessedOrders != 1 || stats.AvgItemTime < 59*time.Second {
+		t.Fatalf("stats = %+v, %v", stats, err)
+	}
+}
+
+func TestParseOrderInfo(t *testing.T) {
+	tests := []struct {
+		member  string
+		want    OrderInfo
+		wantErr bool
+	}{
+		{"m1:o1:3:1700000000", OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 3, EnqueueTime: time.Unix(1700000000, 0)}, false},
+		{"m:1:o1:2:1700000000", OrderInfo{MerchantID: "m:1", OrderID: "o1", NumOfItems: 2, EnqueueTime: time.Unix(1700000000, 0)}, false},
+		{"m1:o1:3", OrderInfo{}, true},
+		{"m1:o1:x:1700000000", OrderInfo{}, true},
+		{"m1:o1:3:x", OrderInfo{}, true},
+		{`{"v":2,"merchant_id":"m1"}`, OrderInfo{}, true},
+		{`{"v":1,`, OrderInfo{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseOrderInfo(tt.member)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseOrderInfo(%q) error = %v", tt.member, err)
+		}
+		if err == nil && !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("parseOrderInfo(%q) = %+v, want %+v", tt.member, *got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package oqueue
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// MerchantConfig 商家队列配置
+type MerchantConfig struct {
+	// LaneWeights 各通道的优先权重，订单按 入队时间-权重 排序
+	// 未配置时使用 defaultLaneWeights
+	LaneWeights map[Lane]time.Duration `json:"lane_weights,omitempty"`
+	// Capacity 出餐产能(并行工位数)，用于 ParallelEstimator
+	Capacity CapacityConfig `json:"capacity,omitempty"`
+	// Location 商家所在时区(IANA名称，如 Asia/Shanghai)，未配置时使用 WithLocation 设置的时区
+	Location string `json:"location,omitempty"`
+	// DayCutover 营业日切换时间(相对零点)，如 4h 表示凌晨4点前的订单仍归属前一营业日
+	DayCutover time.Duration `json:"day_cutover,omitempty"`
+	// TicketPrefixes 取餐号前缀，key 为渠道(dine_in/takeaway/delivery)或通道名，渠道优先
+	// 未配置时堂食、自取、外卖分别为 A、B、C
+	TicketPrefixes map[string]string `json:"ticket_prefixes,omitempty"`
+	// StaleAfter 订单排队或制作超过该时长仍未完成时由清理任务标记为过期
+	// 为0时使用 defaultStaleAfter，小于0时不清理
+	StaleAfter time.Duration `json:"stale_after,omitempty"`
+	// Admission 准入策略：队列上限与暂停接单
+	Admission AdmissionPolicy `json:"admission,omitempty"`
+}
+
+// GetMerchantConfig 获取商家队列配置，未配置时返回默认配置
+func (q *QueueSystem) GetMerchantConfig(ctx context.Context, merchantID string) (MerchantConfig, error) {
+	return q.store.GetConfig(ctx, merchantID)
+}
+
+// SetMerchantConfig 保存商家队列配置
+func (q *QueueSystem) SetMerchantConfig(ctx context.Context, merchantID string, cfg MerchantConfig) error {
+	if cfg.Location != "" {
+		if _, err := loadLocation(cfg.Location); err != nil {
+			return fmt.Errorf("invalid merchant location: %v", err)
+		}
+	}
+	if cfg.DayCutover < 0 || cfg.DayCutover >= 24*time.Hour {
+		return fmt.Errorf("invalid day cutover: %v", cfg.DayCutover)
+	}
+	if a := cfg.Admission; a.MaxOrders < 0 || a.MaxItems < 0 || a.MaxWait < 0 || a.PickupSlot < 0 {
+		return fmt.Errorf("invalid admission policy: %+v", a)
+	}
+	for key, prefix := range cfg.TicketPrefixes {
+		if !validTicketPrefix(prefix) {
+			return fmt.Errorf("invalid ticket prefix for %s: %q", key, prefix)
+		}
+	}
+
+	return q.store.SetConfig(ctx, merchantID, cfg)
+}
@@ -0,0 +1,92 @@
+package oqueue
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	dateLayout      = "2006-01-02"
+	defaultTimeZone = "Asia/Shanghai"
+)
+
+// defaultLocation 默认时区，加载失败时使用东八区固定时区
+func defaultLocation() *time.Location {
+	loc, err := time.LoadLocation(defaultTimeZone)
+	if err != nil {
+		return time.FixedZone("CST", 8*60*60)
+	}
+	return loc
+}
+
+// locations 已加载的时区，时区名称 -> *time.Location
+var locations sync.Map
+
+// loadLocation 加载时区，每个名称只解析一次
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// merchantLocation 获取商家所在时区，未配置时使用系统默认时区
+func (q *QueueSystem) merchantLocation(cfg MerchantConfig) *time.Location {
+	if cfg.Location != "" {
+		// 保存配置时已校验，这里忽略错误
+		if loc, err := loadLocation(cfg.Location); err == nil {
+			return loc
+		}
+	}
+	return q.location
+}
+
+// merchantNow 获取商家所在时区的当前时间
+func (q *QueueSystem) merchantNow(cfg MerchantConfig) time.Time {
+	return q.now().In(q.merchantLocation(cfg))
+}
+
+// businessDay 获取某时刻所属的营业日
+// 营业日在 DayCutover 时切换，例如 DayCutover 为 4h 时凌晨 2 点仍属于前一天
+func (q *QueueSystem) businessDay(cfg MerchantConfig, t time.Time) string {
+	return t.In(q.merchantLocation(cfg)).Add(-cfg.DayCutover).Format(dateLayout)
+}
+
+// currentDay 获取商家当前营业日
+func (q *QueueSystem) currentDay(cfg MerchantConfig) string {
+	return q.businessDay(cfg, q.now())
+}
+
+// previousDay 获取商家上一营业日
+func (q *QueueSystem) previousDay(cfg MerchantConfig) string {
+	return q.businessDay(cfg, q.now().Add(-24*time.Hour))
+}
+
+// locateOrder 查找订单所在的营业日
+// 依次查找当前与上一营业日，使跨越切换时间的订单仍可查询和完成
+func (q *QueueSystem) locateOrder(ctx context.Context, merchantID string, cfg MerchantConfig, orderID string) (string, error) {
+	days, err := q.locateOrders(ctx, merchantID, cfg, []string{orderID})
+	if err != nil {
+		return "", err
+	}
+	day, ok := days[orderID]
+	if !ok {
+		return "", ErrOrderNotFound
+	}
+	return day, nil
+}
+
+// locateOrders 批量查找订单所在的营业日，返回 订单ID -> 营业日，找不到的订单不包含在内
+func (q *QueueSystem) locateOrders(ctx context.Context, merchantID string, cfg MerchantConfig, orderIDs []string) (map[string]string, error) {
+	if len(orderIDs) == 0 {
+		return make(map[string]string), nil
+	}
+	// 当前营业日优先
+	return q.store.LocateOrders(ctx, merchantID, []string{q.currentDay(cfg), q.previousDay(cfg)}, orderIDs)
+}
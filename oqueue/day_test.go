@@ -0,0 +1,114 @@
+package oqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestBusinessDay(t *testing.T) {
+	q, _ := newTestQueue(t, WithLocation(time.UTC))
+	tests := []struct {
+		name string
+		cfg  MerchantConfig
+		at   time.Time
+		want string
+	}{
+		{"default location", MerchantConfig{}, time.Date(2026, 3, 1, 23, 30, 0, 0, time.UTC), "2026-03-01"},
+		{"merchant location", MerchantConfig{Location: "Asia/Shanghai"}, time.Date(2026, 3, 1, 16, 30, 0, 0, time.UTC), "2026-03-02"},
+		{"before cutover", MerchantConfig{DayCutover: 4 * time.Hour}, time.Date(2026, 3, 2, 3, 59, 0, 0, time.UTC), "2026-03-01"},
+		{"at cutover", MerchantConfig{DayCutover: 4 * time.Hour}, time.Date(2026, 3, 2, 4, 0, 0, 0, time.UTC), "2026-03-02"},
+		{"cutover across month", MerchantConfig{Location: "America/New_York", DayCutover: 2 * time.Hour}, time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC), "2026-02-28"},
+	}
+	for _, tt := range tests {
+		if got := q.businessDay(tt.cfg, tt.at); got != tt.want {
+			t.Errorf("%s: businessDay = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadLocation(t *testing.T) {
+	first, err := loadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := loadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatal("location parsed again")
+	}
+	if _, err := loadLocation("Mars/Olympus"); err == nil {
+		t.Fatal("invalid location loaded")
+	}
+}
+
+func TestSetMerchantConfigValidation(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+	tests := []struct {
+		name    string
+		cfg     MerchantConfig
+		wantErr bool
+	}{
+		{"default", MerchantConfig{}, false},
+		{"location", MerchantConfig{Location: "Asia/Tokyo", DayCutover: 3 * time.Hour}, false},
+		{"invalid location", MerchantConfig{Location: "Mars/Olympus"}, true},
+		{"negative cutover", MerchantConfig{DayCutover: -time.Hour}, true},
+		{"cutover of a full day", MerchantConfig{DayCutover: 24 * time.Hour}, true},
+		{"invalid ticket prefix", MerchantConfig{TicketPrefixes: map[string]string{"dine_in": "A1"}}, true},
+	}
+	for _, tt := range tests {
+		if err := q.SetMerchantConfig(ctx, "m1", tt.cfg); (err != nil) != tt.wantErr {
+			t.Errorf("%s: SetMerchantConfig error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPreviousBusinessDay(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+	if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := MerchantConfig{}
+	yesterday := q.previousDay(cfg)
+	moveToPreviousDay(t, q, "m1", "o1")
+
+	if day, err := q.locateOrder(ctx, "m1", cfg, "o1"); err != nil || day != yesterday {
+		t.Fatalf("located = %s, %v", day, err)
+	}
+	if position, _, _, err := q.GetMerchantOrderPosition(ctx, "m1", "o1"); err != nil || position != 0 {
+		t.Fatalf("position = %d, %v", position, err)
+	}
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o1"); err != nil {
+		t.Fatalf("complete order of previous day: %v", err)
+	}
+	record, err := q.GetOrderRecord(ctx, "m1", "o1")
+	if err != nil || record.State != StateReady {
+		t.Fatalf("record = %+v, %v", record, err)
+	}
+}
+
+// moveToPreviousDay 将当前营业日入队的订单移到上一营业日，模拟跨越切换时间仍未完成的订单
+func moveToPreviousDay(t *testing.T, q *QueueSystem, merchantID, orderID string) {
+	t.Helper()
+	ctx := context.Background()
+	cfg := MerchantConfig{}
+	today, yesterday := q.currentDay(cfg), q.previousDay(cfg)
+	rs := q.store.(*RedisStore)
+	keys := []struct{ from, to string }{
+		{rs.getQueueKey(merchantID, today), rs.getQueueKey(merchantID, yesterday)},
+		{rs.getIndexKey(merchantID, today), rs.getIndexKey(merchantID, yesterday)},
+		{rs.getOrderKey(merchantID, today, orderID), rs.getOrderKey(merchantID, yesterday, orderID)},
+		{rs.getStateKey(merchantID, today, StateQueued), rs.getStateKey(merchantID, yesterday, StateQueued)},
+	}
+	for _, k := range keys {
+		if err := rs.client.Rename(ctx, k.from, k.to).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
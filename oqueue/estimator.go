@@ -0,0 +1,235 @@
+package oqueue
+
+import (
+	"context"
+	"time"
+)
+
+// EstimateInput 预估等待时间的输入
+type EstimateInput struct {
+	MerchantID      string
+	PrecedingOrders int // 排在前面的订单数
+	PrecedingItems  int // 排在前面的商品总数
+	OrderItems      int // 本单商品数
+	Stats           MerchantStats
+	Now             time.Time // 商家所在时区的当前时间
+
+	PrecedingOrderItems []int // 按队列顺序排在前面的各订单商品数
+	Stations            int   // 当前可并行处理订单的工位数
+
+	// Queued 为 true 时查询的是已在队列中的订单，为 false 时预估新订单从现在到出餐的时间
+	Queued       bool
+	BufferFactor float64 // 商家校准后的缓冲系数，为0时使用预估器自身的缓冲系数
+}
+
+// WaitEstimate 预估等待时间及其P90
+type WaitEstimate struct {
+	Expected time.Duration // 预估等待时间
+	P90      time.Duration // 90%的订单可在该时间内出餐
+
+	buffer float64 // 预估时传入的校准缓冲系数，用于出餐后校准
+}
+
+// Estimator 等待时间预估器
+// 返回订单从现在起到出餐的预估时间
+type Estimator interface {
+	Estimate(ctx context.Context, in EstimateInput) (time.Duration, error)
+}
+
+// RangeEstimator 可同时给出P90的预估器
+// 未实现该接口的预估器 P90 与预估时间相同
+type RangeEstimator interface {
+	Estimator
+	EstimateRange(ctx context.Context, in EstimateInput) (WaitEstimate, error)
+}
+
+// DefaultEstimator 默认预估器
+// 新订单: 预估时间 = (前面及本单商品数 × 平均每商品时间 + 前面及本单订单数 × 基础处理时间) × 缓冲系数
+// 已在队列中的订单: 预估时间 = 前面商品数 × 平均每商品时间 + 前面订单数 × 基础处理时间
+type DefaultEstimator struct {
+	BaseProcessTime    time.Duration // 每单基础处理时间
+	DefaultItemTime    time.Duration // 历史数据不足时的每商品处理时间
+	MinProcessedOrders int64         // 最小样本数才使用历史数据
+	BufferFactor       float64       // 缓冲系数
+}
+
+// NewDefaultEstimator 创建默认预估器
+func NewDefaultEstimator() *DefaultEstimator {
+	return &DefaultEstimator{
+		BaseProcessTime:    baseProcessTime,
+		DefaultItemTime:    defaultItemTime,
+		MinProcessedOrders: minProcessedOrders,
+		BufferFactor:       defaultBufferFactor,
+	}
+}
+
+// Estimate 按历史平均每商品时间预估
+func (e *DefaultEstimator) Estimate(_ context.Context, in EstimateInput) (time.Duration, error) {
+	return e.estimate(in, e.itemTime(in)), nil
+}
+
+// itemTime 获取历史平均每商品时间，样本不足时使用默认值
+func (e *DefaultEstimator) itemTime(in EstimateInput) time.Duration {
+	if in.Stats.ProcessedOrders < e.MinProcessedOrders {
+		return e.DefaultItemTime
+	}
+	return in.Stats.AvgItemTime
+}
+
+// estimate 按给定的每商品时间计算预估时间
+func (e *DefaultEstimator) estimate(in EstimateInput, itemTime time.Duration) time.Duration {
+	if in.Queued {
+		return time.Duration(in.PrecedingItems)*itemTime + time.Duration(in.PrecedingOrders)*e.BaseProcessTime
+	}
+
+	items := in.PrecedingItems + in.OrderItems
+	orders := in.PrecedingOrders + 1
+
+	total := time.Duration(items)*itemTime + time.Duration(orders)*e.BaseProcessTime
+	return time.Duration(float64(total) * e.bufferFactor(in))
+}
+
+// bufferFactor 获取生效的缓冲系数，商家已校准时使用校准值
+func (e *DefaultEstimator) bufferFactor(in EstimateInput) float64 {
+	if in.BufferFactor > 0 {
+		return in.BufferFactor
+	}
+	return e.BufferFactor
+}
+
+// EWMAEstimator 指数加权移动平均预估器
+// 使用近期订单权重更高的每商品时间，对效率变化反应更快
+type EWMAEstimator struct {
+	DefaultEstimator
+}
+
+// NewEWMAEstimator 创建指数加权移动平均预估器
+func NewEWMAEstimator() *EWMAEstimator {
+	return &EWMAEstimator{DefaultEstimator: *NewDefaultEstimator()}
+}
+
+// Estimate 按指数加权平均每商品时间预估
+func (e *EWMAEstimator) Estimate(_ context.Context, in EstimateInput) (time.Duration, error) {
+	itemTime := in.Stats.EWMAItemTime
+	if in.Stats.ProcessedOrders < e.MinProcessedOrders || itemTime == 0 {
+		itemTime = e.DefaultItemTime
+	}
+	return e.estimate(in, itemTime), nil
+}
+
+// HourlyEstimator 分时段预估器
+// 使用当前小时的历史平均每商品时间，样本不足时退回整体平均
+type HourlyEstimator struct {
+	DefaultEstimator
+}
+
+// NewHourlyEstimator 创建分时段预估器
+func NewHourlyEstimator() *HourlyEstimator {
+	return &HourlyEstimator{DefaultEstimator: *NewDefaultEstimator()}
+}
+
+// Estimate 按当前小时的平均每商品时间预估
+func (e *HourlyEstimator) Estimate(ctx context.Context, in EstimateInput) (time.Duration, error) {
+	hour := in.Now.Hour()
+	if in.Stats.HourlyOrders[hour] < e.MinProcessedOrders {
+		return e.DefaultEstimator.Estimate(ctx, in)
+	}
+	return e.estimate(in, in.Stats.HourlyItemTime[hour]), nil
+}
+
+// estimatorFor 获取商家使用的预估器
+func (q *QueueSystem) estimatorFor(merchantID string) Estimator {
+	if e, ok := q.merchantEstimators[merchantID]; ok {
+		return e
+	}
+	return q.estimator
+}
+
+// estimateData 预估所需的商家统计、当天各通道的到达统计及即将放入队列的预约订单，同一商家的多个订单可共用
+type estimateData struct {
+	stats     MerchantStats
+	lanes     map[string]string
+	scheduled []ScheduledOrder
+}
+
+// loadEstimateData 读取商家某营业日预估所需的统计
+func (q *QueueSystem) loadEstimateData(ctx context.Context, merchantID, day string) (estimateData, error) {
+	stats, err := q.GetMerchantStats(ctx, merchantID)
+	if err != nil {
+		return estimateData{}, err
+	}
+	lanes, err := q.store.LaneStats(ctx, merchantID, day)
+	if err != nil {
+		return estimateData{}, err
+	}
+	scheduled, err := q.store.ScheduledOrders(ctx, merchantID, q.now().Add(scheduleLookahead))
+	if err != nil {
+		return estimateData{}, err
+	}
+	return estimateData{stats: stats, lanes: lanes, scheduled: scheduled}, nil
+}
+
+// estimateWait 预估订单的等待时间
+// preceding 为排在前面的各订单商品数，queued 表示订单已在队列中，见 EstimateInput.Queued
+func (q *QueueSystem) estimateWait(ctx context.Context, merchantID string, cfg MerchantConfig, stats MerchantStats, preceding []int, orderItems int, queued bool) (WaitEstimate, error) {
+	var err error
+	now := q.merchantNow(cfg)
+	in := EstimateInput{
+		MerchantID:          merchantID,
+		PrecedingOrders:     len(preceding),
+		PrecedingOrderItems: preceding,
+		OrderItems:          orderItems,
+		Stations:            cfg.Capacity.StationsAt(now),
+		Stats:               stats,
+		Now:                 now,
+		Queued:              queued,
+	}
+	for _, n := range preceding {
+		in.PrecedingItems += n
+	}
+	if q.calibration != nil {
+		in.BufferFactor = q.calibration.bufferFactor(stats)
+	}
+
+	var estimate WaitEstimate
+	estimator := q.estimatorFor(merchantID)
+	if r, ok := estimator.(RangeEstimator); ok {
+		estimate, err = r.EstimateRange(ctx, in)
+	} else {
+		estimate.Expected, err = estimator.Estimate(ctx, in)
+		estimate.P90 = estimate.Expected
+	}
+	if err != nil {
+		return WaitEstimate{}, err
+	}
+	estimate.buffer = in.BufferFactor
+	return estimate, nil
+}
+
+// estimateWithOvertakes 预估等待时间，并计入之后可能从高优先通道插队的订单及即将放入队列的预约订单
+func (q *QueueSystem) estimateWithOvertakes(ctx context.Context, merchantID string, cfg MerchantConfig, data estimateData, lane Lane, enqueueTime time.Time, preceding []int, orderItems int, queued bool) (WaitEstimate, error) {
+	estimate, err := q.estimateWait(ctx, merchantID, cfg, data.stats, preceding, orderItems, queued)
+	if err != nil {
+		return WaitEstimate{}, err
+	}
+
+	now := q.now()
+	extraOrders, extraItems := expectedOvertakes(cfg, data.lanes, lane, enqueueTime, now, estimate.Expected)
+	scheduled := scheduledOvertakes(cfg, data.scheduled, lane, enqueueTime, now, estimate.Expected)
+	n := roundCount(extraOrders)
+	if n == 0 && len(scheduled) == 0 {
+		return estimate, nil
+	}
+
+	// 预约订单按实际商品数计入，插队订单按各通道平均商品数计入
+	extended := make([]int, 0, len(preceding)+len(scheduled)+n)
+	extended = append(extended, preceding...)
+	extended = append(extended, scheduled...)
+	if n > 0 {
+		perOrder := roundCount(extraItems / extraOrders)
+		for i := 0; i < n; i++ {
+			extended = append(extended, perOrder)
+		}
+	}
+	return q.estimateWait(ctx, merchantID, cfg, data.stats, extended, orderItems, queued)
+}
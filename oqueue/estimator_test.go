@@ -0,0 +1,66 @@
+package oqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDefaultEstimator(t *testing.T) {
+	history := MerchantStats{ProcessedOrders: 10, AvgItemTime: 30 * time.Second}
+	tests := []struct {
+		name string
+		in   EstimateInput
+		want time.Duration
+	}{
+		{"queued head", EstimateInput{OrderItems: 2, Queued: true}, 0},
+		{"queued behind two orders", EstimateInput{PrecedingOrders: 2, PrecedingItems: 3, OrderItems: 4, Queued: true}, 7 * time.Minute},
+		{"queued with history", EstimateInput{PrecedingOrders: 2, PrecedingItems: 4, Stats: history, Queued: true}, 6 * time.Minute},
+		{"new order on empty queue", EstimateInput{OrderItems: 3}, 6 * time.Minute},
+		{"new order behind two orders", EstimateInput{PrecedingOrders: 2, PrecedingItems: 3, OrderItems: 2}, 13*time.Minute + 12*time.Second},
+		{"new order with history", EstimateInput{PrecedingOrders: 1, PrecedingItems: 2, OrderItems: 2, Stats: history}, 7*time.Minute + 12*time.Second},
+		{"too few samples", EstimateInput{PrecedingOrders: 1, PrecedingItems: 1, Stats: MerchantStats{ProcessedOrders: 4, AvgItemTime: time.Hour}, Queued: true}, 3 * time.Minute},
+	}
+	e := NewDefaultEstimator()
+	for _, tt := range tests {
+		got, err := e.Estimate(context.Background(), tt.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: Estimate = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEWMAAndHourlyEstimator(t *testing.T) {
+	stats := MerchantStats{
+		ProcessedOrders: 10,
+		AvgItemTime:     time.Minute,
+		EWMAItemTime:    30 * time.Second,
+		HourlyItemTime:  map[int]time.Duration{9: 2 * time.Minute},
+		HourlyOrders:    map[int]int64{9: 10},
+	}
+	at := func(hour int) time.Time { return time.Date(2026, 3, 2, hour, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name string
+		e    Estimator
+		in   EstimateInput
+		want time.Duration
+	}{
+		{"ewma", NewEWMAEstimator(), EstimateInput{PrecedingOrders: 1, PrecedingItems: 2, Stats: stats, Queued: true}, 3 * time.Minute},
+		{"ewma without samples", NewEWMAEstimator(), EstimateInput{PrecedingOrders: 1, PrecedingItems: 2, Queued: true}, 4 * time.Minute},
+		{"hourly", NewHourlyEstimator(), EstimateInput{PrecedingOrders: 1, PrecedingItems: 2, Stats: stats, Now: at(9), Queued: true}, 6 * time.Minute},
+		{"hourly falls back to average", NewHourlyEstimator(), EstimateInput{PrecedingOrders: 1, PrecedingItems: 2, Stats: stats, Now: at(10), Queued: true}, 4 * time.Minute},
+	}
+	for _, tt := range tests {
+		got, err := tt.e.Estimate(context.Background(), tt.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: Estimate = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
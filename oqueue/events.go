@@ -0,0 +1,207 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"github.com/open4go/log"
+	"github.com/open4go/req5rsp/rsp"
+	"time"
+)
+
+// EventType 队列事件类型
+type EventType string
+
+const (
+	EventEnqueued  EventType = "enqueued"  // 订单入队
+	EventAdvanced  EventType = "advanced"  // 有订单离开队列，后面的订单位置前移
+	EventPreparing EventType = "preparing" // 订单开始制作
+	EventReady     EventType = "ready"     // 订单已出餐
+	EventPickedUp  EventType = "picked_up" // 订单已取餐
+	EventCancelled EventType = "cancelled" // 订单已取消
+	EventExpired   EventType = "expired"   // 订单已过期
+	EventReordered EventType = "reordered" // 订单被人工调整顺序(提前、延后、暂缓、恢复)
+	EventStation   EventType = "station"   // 订单某工位的小票已完成
+	EventPaused    EventType = "paused"    // 商家暂停接单，OrderID 为空
+	EventResumed   EventType = "resumed"   // 商家恢复接单，OrderID 为空
+)
+
+// QueueEvent 队列变化事件，Redis 存储中以JSON发布到 queue_events:<merchantID> 频道
+type QueueEvent struct {
+	Type       EventType  `json:"type"`
+	MerchantID string     `json:"merchant_id"`
+	OrderID    string     `json:"order_id"`
+	State      OrderState `json:"state"`
+	// Position 订单入队后或离开队列时的位置，仅 enqueued 与 advanced 事件，为-1时未知
+	Position int64   `json:"position"`
+	Station  Station `json:"station,omitempty"` // 完成的工位，仅 station 事件
+	Time     int64   `json:"time"`              // 事件时间(毫秒)
+}
+
+// OrderUpdate 推送给单个订单的位置及预估时间更新
+type OrderUpdate struct {
+	MerchantID string       `json:"merchant_id"`
+	OrderID    string       `json:"order_id"`
+	Event      EventType    `json:"event,omitempty"` // 触发本次更新的事件，首次推送为空
+	State      OrderState   `json:"state"`
+	Position   int64        `json:"position"` // 队列中的位置(从0开始)，订单离开队列后为0
+	Wait       WaitEstimate `json:"wait"`     // 预估等待时间，订单离开队列后为0
+	Time       time.Time    `json:"time"`
+}
+
+// WSEvent 转换为推送服务的消息，可直接交给 user.PublishEvent 推送
+func (u OrderUpdate) WSEvent(eventType int) rsp.WSEvent {
+	return rsp.WSEvent{
+		Value: u,
+		Type:  eventType,
+		Time:  u.Time.UnixMilli(),
+	}
+}
+
+// publishEvents 发布队列事件
+// 事件发布失败不影响订单操作本身，只记录日志
+func (q *QueueSystem) publishEvents(ctx context.Context, merchantID string, events ...QueueEvent) {
+	if err := q.store.Publish(ctx, merchantID, events); err != nil {
+		log.Log(ctx).Error(err)
+	}
+}
+
+// transitionEvents 生成订单状态变化事件
+// 订单离开队列时额外生成 advanced 事件，通知后面的订单位置已前移，position 为离开时的位置
+func transitionEvents(merchantID, orderID string, from, to OrderState, position int64, at time.Time) []QueueEvent {
+	now := at.UnixMilli()
+	events := []QueueEvent{{
+		Type:       EventType(to),
+		MerchantID: merchantID,
+		OrderID:    orderID,
+		State:      to,
+		Time:       now,
+	}}
+	if from.IsLive() && !to.IsLive() {
+		events = append(events, QueueEvent{
+			Type:       EventAdvanced,
+			MerchantID: merchantID,
+			OrderID:    orderID,
+			State:      to,
+			Position:   position,
+			Time:       now,
+		})
+	}
+	return events
+}
+
+// SubscribeOrder 订阅订单的位置及预估时间更新
+// 订阅后立即推送一次当前状态，之后在队列变化导致位置改变或订单自身状态变化时推送，
+// 订单离开队列(出餐、取消、过期)后推送最后一次更新并关闭通道，ctx 取消时也会关闭通道
+func (q *QueueSystem) SubscribeOrder(ctx context.Context, merchantID, orderID string) (<-chan OrderUpdate, error) {
+	// 订阅生效后再读取当前状态，避免漏掉其间的事件
+	sub, err := q.store.Subscribe(ctx, merchantID)
+	if err != nil {
+		return nil, err
+	}
+
+	first, err := q.orderUpdate(ctx, merchantID, orderID, "")
+	if err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	updates := make(chan OrderUpdate, 1)
+	go q.watchOrder(ctx, sub, first, updates)
+	return updates, nil
+}
+
+// watchOrder 监听商家队列事件并推送订单更新
+func (q *QueueSystem) watchOrder(ctx context.Context, sub Subscription, last OrderUpdate, updates chan<- OrderUpdate) {
+	defer close(updates)
+	defer sub.Close()
+
+	if !sendUpdate(ctx, updates, last) || !last.State.IsLive() {
+		return
+	}
+
+	events := sub.Events()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			// 其他订单只有入队(可能插队)、离开队列和人工调整顺序会影响本单位置
+			own := event.OrderID == last.OrderID
+			if !own && !affectsPosition(event, last.Position) {
+				continue
+			}
+
+			update, err := q.orderUpdate(ctx, last.MerchantID, last.OrderID, event.Type)
+			if err != nil {
+				log.Log(ctx).Error(err)
+				continue
+			}
+			if !own && update.Position == last.Position {
+				continue
+			}
+
+			last = update
+			if !sendUpdate(ctx, updates, last) || !last.State.IsLive() {
+				return
+			}
+		}
+	}
+}
+
+// affectsPosition 其他订单的事件是否可能改变位置为 position 的订单的位置
+// 只有入队(可能插队)、离开队列和人工调整顺序会影响位置；
+// 入队或离开的订单位于本单之后时不影响，避免每个订阅者在每个事件上都重新计算预估
+func affectsPosition(event QueueEvent, position int64) bool {
+	switch event.Type {
+	case EventEnqueued, EventAdvanced:
+		return event.Position < 0 || event.Position <= position
+	case EventReordered:
+		return true
+	}
+	return false
+}
+
+// sendUpdate 推送更新，ctx 取消时返回 false
+func sendUpdate(ctx context.Context, updates chan<- OrderUpdate, update OrderUpdate) bool {
+	select {
+	case updates <- update:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// orderUpdate 获取订单当前的状态、位置及预估时间
+func (q *QueueSystem) orderUpdate(ctx context.Context, merchantID, orderID string, event EventType) (OrderUpdate, error) {
+	record, err := q.GetOrderRecord(ctx, merchantID, orderID)
+	if err != nil {
+		return OrderUpdate{}, err
+	}
+
+	update := OrderUpdate{
+		MerchantID: merchantID,
+		OrderID:    orderID,
+		Event:      event,
+		State:      record.State,
+		Time:       q.now(),
+	}
+	if !record.State.IsLive() {
+		return update, nil
+	}
+
+	position, estimate, _, err := q.orderWait(ctx, merchantID, orderID)
+	// 读取状态后订单可能刚好离开队列，随后的状态事件会再次更新
+	if errors.Is(err, ErrOrderNotFound) {
+		return update, nil
+	}
+	if err != nil {
+		return OrderUpdate{}, err
+	}
+	update.Position = position
+	update.Wait = estimate
+	return update, nil
+}
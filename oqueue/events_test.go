@@ -0,0 +1,106 @@
+package oqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAffectsPosition(t *testing.T) {
+	tests := []struct {
+		name  string
+		event QueueEvent
+		want  bool
+	}{
+		{"enqueued ahead", QueueEvent{Type: EventEnqueued, Position: 1}, true},
+		{"enqueued at own position", QueueEvent{Type: EventEnqueued, Position: 3}, true},
+		{"enqueued behind", QueueEvent{Type: EventEnqueued, Position: 4}, false},
+		{"left ahead", QueueEvent{Type: EventAdvanced, Position: 0}, true},
+		{"left behind", QueueEvent{Type: EventAdvanced, Position: 5}, false},
+		{"left from unknown position", QueueEvent{Type: EventAdvanced, Position: -1}, true},
+		{"preparing", QueueEvent{Type: EventPreparing}, false},
+		{"reordered behind", QueueEvent{Type: EventReordered, Position: 5}, true},
+	}
+	for _, tt := range tests {
+		if got := affectsPosition(tt.event, 3); got != tt.want {
+			t.Errorf("%s: affectsPosition = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTransitionEvents(t *testing.T) {
+	at := time.UnixMilli(1700000000000)
+	tests := []struct {
+		from, to OrderState
+		want     []EventType
+	}{
+		{StateQueued, StatePreparing, []EventType{EventPreparing}},
+		{StatePreparing, StateReady, []EventType{EventReady, EventAdvanced}},
+		{StateQueued, StateCancelled, []EventType{EventCancelled, EventAdvanced}},
+		{StateReady, StatePickedUp, []EventType{EventPickedUp}},
+	}
+	for _, tt := range tests {
+		events := transitionEvents("m1", "o1", tt.from, tt.to, 2, at)
+		if len(events) != len(tt.want) {
+			t.Fatalf("%s -> %s: events = %+v", tt.from, tt.to, events)
+		}
+		for i, event := range events {
+			if event.Type != tt.want[i] || event.Time != at.UnixMilli() {
+				t.Fatalf("%s -> %s: events = %+v", tt.from, tt.to, events)
+			}
+			if event.Type == EventAdvanced && event.Position != 2 {
+				t.Fatalf("advanced position = %d", event.Position)
+			}
+		}
+	}
+}
+
+func TestSubscribeOrder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	q, _ := newTestQueue(t)
+	for _, id := range []string{"o1", "o2", "o3"} {
+		if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: id, NumOfItems: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	updates, err := q.SubscribeOrder(ctx, "m1", "o2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := <-updates; u.Position != 1 || u.Event != "" {
+		t.Fatalf("first update = %+v", u)
+	}
+
+	// 本单之后的入队与离开不推送，之前的订单离开时推送前移
+	if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: "o4", NumOfItems: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.CancelOrder(ctx, "m1", "o3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if u := <-updates; u.Position != 0 || u.Event != EventAdvanced {
+		t.Fatalf("advanced update = %+v", u)
+	}
+
+	if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: "v1", NumOfItems: 1, Lane: LaneVIP}); err != nil {
+		t.Fatal(err)
+	}
+	if u := <-updates; u.Position != 1 || u.Event != EventEnqueued {
+		t.Fatalf("enqueued update = %+v", u)
+	}
+
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o2"); err != nil {
+		t.Fatal(err)
+	}
+	if u := <-updates; u.State != StateReady || u.Event != EventReady {
+		t.Fatalf("ready update = %+v", u)
+	}
+	if _, ok := <-updates; ok {
+		t.Fatal("updates not closed after order left the queue")
+	}
+}
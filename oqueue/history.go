@@ -0,0 +1,450 @@
+package oqueue
+
+import (
+	"context"
+	"fmt"
+	xmongo "github.com/open4go/db/mongo"
+	"github.com/open4go/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync"
+	"time"
+)
+
+const (
+	historyCollection      = "order_queue_history" // 订单排队历史集合
+	defaultArchiveBatch    = 100                   // 每批写入的最大条数
+	defaultArchiveInterval = 5 * time.Second       // 未满一批时的最长等待时间
+	archiveBufferSize      = 10000                 // 待写入缓冲区大小，写满后丢弃并记录日志
+
+	positionField      = "position"       // 入队时的位置
+	estimateField      = "estimate_ms"    // 入队时的预估等待时间(毫秒)
+	p90Field           = "p90_ms"         // 入队时的P90等待时间(毫秒)
+	finalPositionField = "final_position" // 离开队列时的位置
+	bufferField        = "buffer"         // 入队预估时使用的校准缓冲系数，0表示未校准
+)
+
+// OrderHistory 订单排队历史
+// 同一商家同一营业日的订单只保留一条，后续状态变化(如出餐后取餐)会覆盖之前的记录
+type OrderHistory struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty"`
+	MerchantID      string             `bson:"merchantId"`
+	OrderID         string             `bson:"orderId"`
+	Day             string             `bson:"day"` // 营业日
+	Ticket          string             `bson:"ticket,omitempty"`
+	Lane            Lane               `bson:"lane"`
+	Channel         Channel            `bson:"channel,omitempty"`
+	NumOfItems      int                `bson:"numOfItems"`
+	State           OrderState         `bson:"state"` // 归档时的状态
+	EnqueuedAt      time.Time          `bson:"enqueuedAt"`
+	ReadyAt         time.Time          `bson:"readyAt,omitempty"`
+	FinishedAt      time.Time          `bson:"finishedAt"` // 进入当前状态的时间
+	EnqueuePosition int64              `bson:"enqueuePosition"`
+	FinalPosition   int64              `bson:"finalPosition"` // 离开队列时的位置
+	EstimatedWait   time.Duration      `bson:"estimatedWait"` // 入队时的预估等待时间(纳秒)
+	EstimatedP90    time.Duration      `bson:"estimatedP90"`
+	ActualWait      time.Duration      `bson:"actualWait,omitempty"` // 入队到出餐的实际时间，未出餐为0
+	UpdatedAt       time.Time          `bson:"updatedAt"`
+}
+
+// newOrderHistory 根据订单记录生成历史，now 为更新时间
+func newOrderHistory(record *OrderRecord, day string, now time.Time) OrderHistory {
+	h := OrderHistory{
+		MerchantID:      record.MerchantID,
+		OrderID:         record.OrderID,
+		Day:             day,
+		Ticket:          record.Ticket,
+		Lane:            orderLane(record.OrderInfo),
+		Channel:         record.Channel,
+		NumOfItems:      record.NumOfItems,
+		State:           record.State,
+		EnqueuedAt:      record.EnqueueTime,
+		ReadyAt:         record.Transitions[StateReady],
+		FinishedAt:      record.Transitions[record.State],
+		EnqueuePosition: record.EnqueuePosition,
+		FinalPosition:   record.FinalPosition,
+		EstimatedWait:   record.EstimatedWait.Expected,
+		EstimatedP90:    record.EstimatedWait.P90,
+		UpdatedAt:       now,
+	}
+	if queuedAt, ok := record.Transitions[StateQueued]; ok {
+		h.EnqueuedAt = queuedAt
+	}
+	if !h.ReadyAt.IsZero() {
+		h.ActualWait = h.ReadyAt.Sub(h.EnqueuedAt)
+	}
+	return h
+}
+
+// historyEntry 待归档的订单
+type historyEntry struct {
+	orderID string
+	day     string
+}
+
+// recordEnqueueEstimates 记录商家刚入队订单的位置及入队时的预估等待时间，失败只记录日志
+// 统计与队列只读取一次，在内存中按新订单计算各订单的预估后一次写入；出餐时存储据此计算预估误差并校准缓冲系数
+func (q *QueueSystem) recordEnqueueEstimates(ctx context.Context, cfg MerchantConfig, merchantID string, orderIDs []string) {
+	day := q.currentDay(cfg)
+	data, err := q.loadEstimateData(ctx, merchantID, day)
+	if err != nil {
+		log.Log(ctx).WithField("merchant", merchantID).Error(err)
+		return
+	}
+	orders, err := q.store.QueueOrders(ctx, merchantID, day, 0, -1)
+	if err != nil {
+		log.Log(ctx).WithField("merchant", merchantID).Error(err)
+		return
+	}
+
+	// 按队列顺序解析订单，items[i] 为第 i 个订单的商品数
+	positions := make(map[string]int, len(orders))
+	items := make([]int, len(orders))
+	for i, order := range orders {
+		positions[order.OrderID] = i
+		items[i] = order.NumOfItems
+	}
+
+	estimates := make([]EnqueueEstimate, 0, len(orderIDs))
+	for _, orderID := range orderIDs {
+		position, ok := positions[orderID]
+		if !ok {
+			continue
+		}
+		order := orders[position]
+		estimate, err := q.estimateWithOvertakes(ctx, merchantID, cfg, data, orderLane(order), order.EnqueueTime, items[:position], order.NumOfItems, false)
+		if err != nil {
+			log.Log(ctx).WithField("order", orderID).Error(err)
+			continue
+		}
+		estimates = append(estimates, EnqueueEstimate{OrderID: orderID, Position: int64(position), Estimate: estimate})
+	}
+	if len(estimates) == 0 {
+		return
+	}
+	if err := q.store.SetEnqueueEstimates(ctx, merchantID, day, estimates); err != nil {
+		log.Log(ctx).WithField("merchant", merchantID).Error(err)
+	}
+}
+
+// recordHistory 读取订单当前记录并交给归档器异步写入，失败只记录日志
+func (q *QueueSystem) recordHistory(ctx context.Context, merchantID string, entries []historyEntry) {
+	byDay := make(map[string][]string)
+	for _, entry := range entries {
+		byDay[entry.day] = append(byDay[entry.day], entry.orderID)
+	}
+
+	for day, orderIDs := range byDay {
+		records, err := q.store.OrderRecords(ctx, merchantID, day, orderIDs)
+		if err != nil {
+			log.Log(ctx).WithField("merchant", merchantID).Error(err)
+			continue
+		}
+		for _, record := range records {
+			q.archiver.Archive(ctx, newOrderHistory(record, day, q.now()))
+		}
+	}
+}
+
+// Archiver 订单历史归档器，异步批量写入 MongoDB
+type Archiver struct {
+	coll          *mongo.Collection
+	BatchSize     int           // 每批写入的最大条数，小于等于0时使用 defaultArchiveBatch
+	FlushInterval time.Duration // 未满一批时的最长等待时间，小于等于0时使用 defaultArchiveInterval
+
+	entries chan OrderHistory
+	mu      sync.RWMutex
+	started bool
+	closed  bool
+	done    chan struct{}
+}
+
+// NewArchiver 创建写入指定集合的归档器
+func NewArchiver(coll *mongo.Collection) *Archiver {
+	return &Archiver{
+		coll:          coll,
+		BatchSize:     defaultArchiveBatch,
+		FlushInterval: defaultArchiveInterval,
+		entries:       make(chan OrderHistory, archiveBufferSize),
+		done:          make(chan struct{}),
+	}
+}
+
+// NewMongoArchiver 使用 open4go/db 连接池中名为 dbName 的数据库创建归档器
+func NewMongoArchiver(dbName string) (*Archiver, error) {
+	db, err := xmongo.DBPool.GetHandler(dbName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mongo handler: %v", err)
+	}
+	return NewArchiver(db.Collection(historyCollection)), nil
+}
+
+// EnsureIndexes 创建历史集合所需的索引
+func (a *Archiver) EnsureIndexes(ctx context.Context) error {
+	_, err := a.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "merchantId", Value: 1}, {Key: "day", Value: 1}, {Key: "orderId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "merchantId", Value: 1}, {Key: "enqueuedAt", Value: -1}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create history indexes: %v", err)
+	}
+	return nil
+}
+
+// Start 启动后台写入协程，ctx 取消或调用 Close 时写入剩余数据后退出
+func (a *Archiver) Start(ctx context.Context) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.started {
+		return
+	}
+	a.started = true
+	if a.BatchSize <= 0 {
+		a.BatchSize = defaultArchiveBatch
+	}
+	if a.FlushInterval <= 0 {
+		a.FlushInterval = defaultArchiveInterval
+	}
+	go a.run(ctx)
+}
+
+// Close 停止接收新数据，并等待剩余数据写入完成
+func (a *Archiver) Close() {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return
+	}
+	a.closed = true
+	close(a.entries)
+	started := a.started
+	a.mu.Unlock()
+
+	if started {
+		<-a.done
+	}
+}
+
+// Archive 提交一条历史，不会阻塞；缓冲区已满或已关闭时丢弃并记录日志
+func (a *Archiver) Archive(ctx context.Context, h OrderHistory) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		log.Log(ctx).WithField("order", h.OrderID).Error("order history archiver closed")
+		return
+	}
+
+	select {
+	case a.entries <- h:
+	default:
+		log.Log(ctx).WithField("order", h.OrderID).Error("order history buffer full")
+	}
+}
+
+// run 批量写入，满 BatchSize 条或每隔 FlushInterval 写入一次
+func (a *Archiver) run(ctx context.Context) {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.FlushInterval)
+	defer ticker.Stop()
+
+	// 退出时 ctx 可能已取消，剩余数据使用不可取消的 ctx 写入
+	flushCtx := context.WithoutCancel(ctx)
+	batch := make([]OrderHistory, 0, a.BatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			a.mu.Lock()
+			a.closed = true
+			a.mu.Unlock()
+			a.flush(flushCtx, a.drain(batch))
+			return
+		case h, ok := <-a.entries:
+			if !ok {
+				a.flush(flushCtx, batch)
+				return
+			}
+			batch = append(batch, h)
+			if len(batch) >= a.BatchSize {
+				a.flush(ctx, batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			a.flush(ctx, batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// drain 取出缓冲区中剩余的数据
+func (a *Archiver) drain(batch []OrderHistory) []OrderHistory {
+	for {
+		select {
+		case h, ok := <-a.entries:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, h)
+		default:
+			return batch
+		}
+	}
+}
+
+// flush 按 商家+营业日+订单 覆盖写入一批历史
+func (a *Archiver) flush(ctx context.Context, batch []OrderHistory) {
+	if len(batch) == 0 {
+		return
+	}
+
+	models := make([]mongo.WriteModel, len(batch))
+	for i, h := range batch {
+		models[i] = mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"merchantId": h.MerchantID, "day": h.Day, "orderId": h.OrderID}).
+			SetReplacement(h).
+			SetUpsert(true)
+	}
+	if _, err := a.coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		log.Log(ctx).WithField("count", len(batch)).Error(err)
+	}
+}
+
+// HistoryQuery 历史查询条件
+type HistoryQuery struct {
+	MerchantID string
+	From       time.Time    // 入队时间下限(含)，零值表示不限
+	To         time.Time    // 入队时间上限(不含)，零值表示不限
+	States     []OrderState // 为空表示不限
+	Limit      int64        // 为0表示不限
+}
+
+// filter 生成查询条件
+func (hq HistoryQuery) filter() bson.M {
+	filter := bson.M{"merchantId": hq.MerchantID}
+	enqueued := bson.M{}
+	if !hq.From.IsZero() {
+		enqueued["$gte"] = hq.From
+	}
+	if !hq.To.IsZero() {
+		enqueued["$lt"] = hq.To
+	}
+	if len(enqueued) > 0 {
+		filter["enqueuedAt"] = enqueued
+	}
+	if len(hq.States) > 0 {
+		filter["state"] = bson.M{"$in": hq.States}
+	}
+	return filter
+}
+
+// QueryHistory 按入队时间倒序查询订单历史
+func (a *Archiver) QueryHistory(ctx context.Context, query HistoryQuery) ([]OrderHistory, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "enqueuedAt", Value: -1}})
+	if query.Limit > 0 {
+		opts.SetLimit(query.Limit)
+	}
+
+	cursor, err := a.coll.Find(ctx, query.filter(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order history: %v", err)
+	}
+	var history []OrderHistory
+	if err := cursor.All(ctx, &history); err != nil {
+		return nil, fmt.Errorf("failed to decode order history: %v", err)
+	}
+	return history, nil
+}
+
+// GetOrderHistory 获取订单最近一次的排队历史
+func (a *Archiver) GetOrderHistory(ctx context.Context, merchantID, orderID string) (*OrderHistory, error) {
+	var h OrderHistory
+	err := a.coll.FindOne(ctx,
+		bson.M{"merchantId": merchantID, "orderId": orderID},
+		options.FindOne().SetSort(bson.D{{Key: "enqueuedAt", Value: -1}}),
+	).Decode(&h)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order history: %v", err)
+	}
+	return &h, nil
+}
+
+// HistorySummary 历史汇总
+type HistorySummary struct {
+	Orders           int64         // 订单数
+	CompletedOrders  int64         // 已出餐订单数
+	AvgItems         float64       // 平均商品数
+	AvgActualWait    time.Duration // 已出餐订单的平均实际等待时间
+	AvgEstimatedWait time.Duration // 已出餐订单入队时的平均预估等待时间
+	MeanAbsError     time.Duration // 已出餐订单预估与实际等待时间的平均绝对误差
+}
+
+// SummarizeHistory 汇总订单历史，用于服务时长及预估准确度报表
+func (a *Archiver) SummarizeHistory(ctx context.Context, query HistoryQuery) (HistorySummary, error) {
+	completed := bson.M{"$gt": bson.A{"$actualWait", 0}}
+	estimated := bson.M{"$and": bson.A{completed, bson.M{"$gt": bson.A{"$estimatedWait", 0}}}}
+	onlyIf := func(cond bson.M, value interface{}) bson.M {
+		return bson.M{"$cond": bson.A{cond, value, nil}}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: query.filter()}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       nil,
+			"orders":    bson.M{"$sum": 1},
+			"completed": bson.M{"$sum": bson.M{"$cond": bson.A{completed, 1, 0}}},
+			"items":     bson.M{"$avg": "$numOfItems"},
+			"actual":    bson.M{"$avg": onlyIf(completed, "$actualWait")},
+			"estimated": bson.M{"$avg": onlyIf(estimated, "$estimatedWait")},
+			"absError": bson.M{"$avg": onlyIf(estimated,
+				bson.M{"$abs": bson.M{"$subtract": bson.A{"$actualWait", "$estimatedWait"}}})},
+		}}},
+	}
+
+	cursor, err := a.coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return HistorySummary{}, fmt.Errorf("failed to summarize order history: %v", err)
+	}
+	var rows []struct {
+		Orders    int64    `bson:"orders"`
+		Completed int64    `bson:"completed"`
+		Items     *float64 `bson:"items"`
+		Actual    *float64 `bson:"actual"`
+		Estimated *float64 `bson:"estimated"`
+		AbsError  *float64 `bson:"absError"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return HistorySummary{}, fmt.Errorf("failed to decode order history summary: %v", err)
+	}
+	if len(rows) == 0 {
+		return HistorySummary{}, nil
+	}
+
+	row := rows[0]
+	duration := func(v *float64) time.Duration {
+		if v == nil {
+			return 0
+		}
+		return time.Duration(*v)
+	}
+	summary := HistorySummary{
+		Orders:           row.Orders,
+		CompletedOrders:  row.Completed,
+		AvgActualWait:    duration(row.Actual),
+		AvgEstimatedWait: duration(row.Estimated),
+		MeanAbsError:     duration(row.AbsError),
+	}
+	if row.Items != nil {
+		summary.AvgItems = *row.Items
+	}
+	return summary, nil
+}
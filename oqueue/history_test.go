@@ -0,0 +1,207 @@
+package oqueue
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// archivedHistory 解析写入 mock 集合的历史
+func archivedHistory(t *testing.T, mt *mtest.T) map[string]OrderHistory {
+	t.Helper()
+	archived := make(map[string]OrderHistory)
+	for _, event := range mt.GetAllStartedEvents() {
+		if event.CommandName != "update" {
+			continue
+		}
+		updates, err := event.Command.LookupErr("updates")
+		if err != nil {
+			t.Fatal(err)
+		}
+		values, err := updates.Array().Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, value := range values {
+			var h OrderHistory
+			if err := bson.Unmarshal(value.Document().Lookup("u").Document(), &h); err != nil {
+				t.Fatal(err)
+			}
+			archived[h.OrderID] = h
+		}
+	}
+	return archived
+}
+
+func TestNewOrderHistory(t *testing.T) {
+	enqueued := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	now := enqueued.Add(time.Hour)
+	tests := []struct {
+		name       string
+		record     OrderRecord
+		wantState  OrderState
+		wantActual time.Duration
+	}{
+		{
+			name: "ready",
+			record: OrderRecord{
+				OrderInfo: OrderInfo{MerchantID: "m1", OrderID: "o1", EnqueueTime: enqueued},
+				State:     StateReady,
+				Transitions: map[OrderState]time.Time{
+					StateQueued: enqueued,
+					StateReady:  enqueued.Add(6 * time.Minute),
+				},
+			},
+			wantState:  StateReady,
+			wantActual: 6 * time.Minute,
+		},
+		{
+			name: "cancelled",
+			record: OrderRecord{
+				OrderInfo:   OrderInfo{MerchantID: "m1", OrderID: "o2", EnqueueTime: enqueued},
+				State:       StateCancelled,
+				Transitions: map[OrderState]time.Time{StateCancelled: enqueued.Add(time.Minute)},
+			},
+			wantState: StateCancelled,
+		},
+	}
+	for _, tt := range tests {
+		h := newOrderHistory(&tt.record, "20260302", now)
+		if h.State != tt.wantState || h.ActualWait != tt.wantActual || !h.EnqueuedAt.Equal(enqueued) {
+			t.Errorf("%s: history = %+v", tt.name, h)
+		}
+		if h.Lane != LaneNormal || h.Day != "20260302" || !h.UpdatedAt.Equal(now) {
+			t.Errorf("%s: history = %+v", tt.name, h)
+		}
+	}
+}
+
+func TestHistoryQueryFilter(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+	tests := []struct {
+		name  string
+		query HistoryQuery
+		want  bson.M
+	}{
+		{"merchant only", HistoryQuery{MerchantID: "m1"}, bson.M{"merchantId": "m1"}},
+		{
+			"time range",
+			HistoryQuery{MerchantID: "m1", From: from, To: to},
+			bson.M{"merchantId": "m1", "enqueuedAt": bson.M{"$gte": from, "$lt": to}},
+		},
+		{
+			"states",
+			HistoryQuery{MerchantID: "m1", States: []OrderState{StateReady}},
+			bson.M{"merchantId": "m1", "state": bson.M{"$in": []OrderState{StateReady}}},
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.query.filter(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: filter = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestArchiverDefaults(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("zero settings", func(mt *mtest.T) {
+		a := NewArchiver(mt.Coll)
+		a.BatchSize = 0
+		a.FlushInterval = 0
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		a.Start(context.Background())
+		a.Archive(context.Background(), OrderHistory{MerchantID: "m1", OrderID: "o1", Day: "20260302"})
+		a.Close()
+
+		if a.BatchSize != defaultArchiveBatch || a.FlushInterval != defaultArchiveInterval {
+			t.Fatalf("batch size = %d, flush interval = %v", a.BatchSize, a.FlushInterval)
+		}
+		if archived := archivedHistory(t, mt); len(archived) != 1 {
+			t.Fatalf("archived = %v", archived)
+		}
+	})
+}
+
+func TestArchiveFinishedOrders(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("complete and cancel", func(mt *mtest.T) {
+		ctx := context.Background()
+		archiver := NewArchiver(mt.Coll)
+		q, _ := newTestQueue(t, WithArchiver(archiver))
+		for _, id := range []string{"o1", "o2", "o3", "o4", "live"} {
+			if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: id, NumOfItems: 2}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := q.StartPreparing(ctx, "m1", "live"); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.CompleteMerchantOrder(ctx, "m1", "o1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.CancelOrder(ctx, "m1", "o2"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := q.CompleteOrders(ctx, "m1", []string{"o3", "o4"}); err != nil {
+			t.Fatal(err)
+		}
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		archiver.Start(ctx)
+		archiver.Close()
+
+		archived := archivedHistory(t, mt)
+		want := map[string]OrderState{"o1": StateReady, "o2": StateCancelled, "o3": StateReady, "o4": StateReady}
+		if len(archived) != len(want) {
+			t.Fatalf("archived = %v", archived)
+		}
+		for orderID, state := range want {
+			h := archived[orderID]
+			if h.MerchantID != "m1" || h.State != state || h.Day == "" {
+				t.Errorf("%s: history = %+v", orderID, h)
+			}
+		}
+		if archived["o1"].ActualWait <= 0 || archived["o3"].EstimatedWait <= 0 {
+			t.Errorf("history = %+v", archived)
+		}
+	})
+}
+
+func TestRecordEnqueueEstimate(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("positions", func(mt *mtest.T) {
+		ctx := context.Background()
+		q, _ := newTestQueue(t, WithArchiver(NewArchiver(mt.Coll)))
+		for _, id := range []string{"o1", "o2", "o3"} {
+			if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: id, NumOfItems: 2}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := q.CompleteMerchantOrder(ctx, "m1", "o2"); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			orderID        string
+			enqueue, final int64
+		}{
+			{"o1", 0, 0},
+			{"o2", 1, 1},
+			{"o3", 2, 0},
+		}
+		for _, tt := range tests {
+			record, err := q.GetOrderRecord(ctx, "m1", tt.orderID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record.EnqueuePosition != tt.enqueue || record.FinalPosition != tt.final || record.EstimatedWait.Expected <= 0 {
+				t.Errorf("%s: record = %+v", tt.orderID, record)
+			}
+		}
+	})
+}
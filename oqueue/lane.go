@@ -0,0 +1,107 @@
+package oqueue
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+const minRateWindow = 10 * time.Minute // 计算到达速率的最短统计时长
+
+// Lane 订单优先通道
+// 同一通道内按入队时间先进先出，权重更高的通道可插到低权重通道之前
+type Lane string
+
+const (
+	LaneNormal   Lane = "normal"   // 普通订单
+	LanePlatform Lane = "platform" // 外卖平台订单(有SLA要求)
+	LaneVIP      Lane = "vip"      // 会员订单
+	LaneRush     Lane = "rush"     // 加急订单
+	// LaneScheduled 预约订单，到放入时间后以该通道入队，需按预约时间出餐，默认权重最高
+	LaneScheduled Lane = "scheduled"
+)
+
+// defaultLaneWeights 默认通道权重
+var defaultLaneWeights = map[Lane]time.Duration{
+	LaneNormal:    0,
+	LanePlatform:  3 * time.Minute,
+	LaneVIP:       5 * time.Minute,
+	LaneRush:      10 * time.Minute,
+	LaneScheduled: 15 * time.Minute,
+}
+
+// orderLane 获取订单通道，未指定时为普通通道
+func orderLane(order OrderInfo) Lane {
+	if order.Lane == "" {
+		return LaneNormal
+	}
+	return order.Lane
+}
+
+// laneWeights 获取商家生效的通道权重
+func (c MerchantConfig) laneWeights() map[Lane]time.Duration {
+	if len(c.LaneWeights) == 0 {
+		return defaultLaneWeights
+	}
+	return c.LaneWeights
+}
+
+// laneWeight 获取指定通道的权重，未配置的通道权重为0
+func (c MerchantConfig) laneWeight(lane Lane) time.Duration {
+	return c.laneWeights()[lane]
+}
+
+// laneScore 计算队列分数: 入队时间 - 通道权重
+// 同一通道权重相同，因此通道内仍保持先进先出
+func laneScore(timestamp int64, weight time.Duration) int64 {
+	return timestamp - int64(weight)
+}
+
+// expectedOvertakes 预估之后还会插队到该订单之前的订单数与商品数
+// 高权重通道的订单只有在 入队时间 + (权重差) 之前到达才能排到前面，
+// 按当天各通道的到达速率(stats 为通道到达统计)估算该窗口内的到达量，窗口不超过 horizon(订单开始处理前的等待时间)
+func expectedOvertakes(cfg MerchantConfig, stats map[string]string, lane Lane, enqueueTime, now time.Time, horizon time.Duration) (orders, items float64) {
+	ownWeight := cfg.laneWeight(lane)
+
+	sinceMs, _ := strconv.ParseInt(stats["since"], 10, 64)
+	if sinceMs == 0 {
+		return 0, 0
+	}
+	elapsed := now.Sub(time.UnixMilli(sinceMs))
+	// 样本时间过短时速率不可靠，至少按 minRateWindow 计算
+	if elapsed < minRateWindow {
+		elapsed = minRateWindow
+	}
+
+	for l, weight := range cfg.laneWeights() {
+		// 预约订单的放入时间已知，由 scheduledOvertakes 逐单计入
+		if weight <= ownWeight || l == LaneScheduled {
+			continue
+		}
+
+		window := enqueueTime.Add(weight - ownWeight).Sub(now)
+		if window > horizon {
+			window = horizon
+		}
+		if window <= 0 {
+			continue
+		}
+
+		count, _ := strconv.ParseFloat(stats["count:"+string(l)], 64)
+		laneItems, _ := strconv.ParseFloat(stats["items:"+string(l)], 64)
+		if count == 0 {
+			continue
+		}
+
+		arrivals := count / elapsed.Seconds() * window.Seconds()
+		orders += arrivals
+		items += arrivals * laneItems / count
+	}
+
+	return orders, items
+}
+
+// roundCount 将预估数量四舍五入为整数
+func roundCount(v float64) int {
+	return int(math.Round(v))
+}
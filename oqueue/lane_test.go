@@ -0,0 +1,93 @@
+package oqueue
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLaneWeight(t *testing.T) {
+	custom := MerchantConfig{LaneWeights: map[Lane]time.Duration{LaneVIP: time.Minute}}
+	tests := []struct {
+		cfg  MerchantConfig
+		lane Lane
+		want time.Duration
+	}{
+		{MerchantConfig{}, LaneNormal, 0},
+		{MerchantConfig{}, LaneVIP, 5 * time.Minute},
+		{MerchantConfig{}, LaneRush, 10 * time.Minute},
+		{MerchantConfig{}, "unknown", 0},
+		{custom, LaneVIP, time.Minute},
+		{custom, LaneRush, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.laneWeight(tt.lane); got != tt.want {
+			t.Errorf("laneWeight(%s) = %v, want %v", tt.lane, got, tt.want)
+		}
+	}
+	if lane := orderLane(OrderInfo{}); lane != LaneNormal {
+		t.Errorf("default lane = %s", lane)
+	}
+}
+
+func TestExpectedOvertakes(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	since := func(ago time.Duration) string { return strconv.FormatInt(now.Add(-ago).UnixMilli(), 10) }
+	stats := map[string]string{"since": since(20 * time.Minute), "count:vip": "4", "items:vip": "8", "count:normal": "10"}
+
+	tests := []struct {
+		name        string
+		stats       map[string]string
+		lane        Lane
+		enqueueTime time.Time
+		horizon     time.Duration
+		orders      float64
+		items       float64
+	}{
+		{"vip arrivals within weight", stats, LaneNormal, now, time.Hour, 1, 2},
+		{"limited by horizon", stats, LaneNormal, now, 2 * time.Minute, 0.4, 0.8},
+		{"same lane", stats, LaneVIP, now, time.Hour, 0, 0},
+		{"window passed", stats, LaneNormal, now.Add(-6 * time.Minute), time.Hour, 0, 0},
+		{"no arrivals", map[string]string{}, LaneNormal, now, time.Hour, 0, 0},
+		{"short sample", map[string]string{"since": since(5 * time.Minute), "count:vip": "2", "items:vip": "2"}, LaneNormal, now, time.Hour, 1, 1},
+	}
+	for _, tt := range tests {
+		orders, items := expectedOvertakes(MerchantConfig{}, tt.stats, tt.lane, tt.enqueueTime, now, tt.horizon)
+		if math.Abs(orders-tt.orders) > 1e-9 || math.Abs(items-tt.items) > 1e-9 {
+			t.Errorf("%s: overtakes = %v orders, %v items, want %v, %v", tt.name, orders, items, tt.orders, tt.items)
+		}
+	}
+}
+
+func TestLaneOrdering(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+	base := time.Now().UnixNano()
+	orders := []OrderInfo{
+		{OrderID: "n1", Timestamp: base},
+		{OrderID: "n2", Timestamp: base + int64(2*time.Minute)},
+		{OrderID: "v1", Timestamp: base + int64(4*time.Minute), Lane: LaneVIP},
+		{OrderID: "v2", Timestamp: base + int64(6*time.Minute), Lane: LaneVIP},
+		{OrderID: "r1", Timestamp: base + int64(7*time.Minute), Lane: LaneRush},
+	}
+	for _, order := range orders {
+		order.MerchantID = "m1"
+		order.NumOfItems = 1
+		if err := q.EnqueueOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 分数: n1=0, n2=2m, v1=-1m, v2=1m, r1=-3m
+	for i, orderID := range []string{"r1", "v1", "n1", "v2", "n2"} {
+		position, _, _, err := q.GetMerchantOrderPosition(ctx, "m1", orderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if position != int64(i) {
+			t.Errorf("position of %s = %d, want %d", orderID, position, i)
+		}
+	}
+}
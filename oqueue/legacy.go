@@ -0,0 +1,62 @@
+package oqueue
+
+import (
+	"context"
+	"github.com/open4go/log"
+	"time"
+)
+
+// 队列按商家拆分之前的接口只传订单ID，以下方法保留原有签名，先通过全局索引查找订单所属商家再调用按商家的接口
+
+// GetOrderPosition 获取订单在队列中的位置及预估等待时间
+//
+// Deprecated: 需要额外查找订单所属商家且要求订单ID全局唯一，请使用 GetMerchantOrderPosition
+func (q *QueueSystem) GetOrderPosition(ctx context.Context, orderID string) (position int64, waitTime time.Duration, info *OrderInfo, err error) {
+	merchantID, err := q.GetOrderMerchant(ctx, orderID)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return q.GetMerchantOrderPosition(ctx, merchantID, orderID)
+}
+
+// CompleteOrder 订单完成处理，更新统计数据
+//
+// Deprecated: 需要额外查找订单所属商家且要求订单ID全局唯一，请使用 CompleteMerchantOrder
+func (q *QueueSystem) CompleteOrder(ctx context.Context, orderID string) error {
+	merchantID, err := q.GetOrderMerchant(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	return q.CompleteMerchantOrder(ctx, merchantID, orderID)
+}
+
+// DequeueOrder 将订单从队列中移除
+//
+// Deprecated: 需要额外查找订单所属商家且要求订单ID全局唯一，请使用 DequeueMerchantOrder
+func (q *QueueSystem) DequeueOrder(ctx context.Context, orderID string) error {
+	merchantID, err := q.GetOrderMerchant(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	return q.DequeueMerchantOrder(ctx, merchantID, orderID)
+}
+
+// GetOrderMerchant 通过全局索引查找订单所属的商家
+// 订单ID应全局唯一，不同商家使用相同订单ID时返回最后入队的商家
+func (q *QueueSystem) GetOrderMerchant(ctx context.Context, orderID string) (string, error) {
+	return q.store.OrderMerchant(ctx, orderID)
+}
+
+// setOrderMerchants 入队后写入订单所属商家的全局索引，失败只记录日志
+func (q *QueueSystem) setOrderMerchants(ctx context.Context, orders []OrderInfo) {
+	if err := q.store.SetOrderMerchants(ctx, orders); err != nil {
+		log.Log(ctx).Error(err)
+	}
+}
+
+// releaseOrderMerchants 订单离开队列后删除其所属商家的全局索引，失败只记录日志
+func (q *QueueSystem) releaseOrderMerchants(ctx context.Context, merchantID string, orderIDs []string) {
+	if err := q.store.ReleaseOrderMerchants(ctx, merchantID, orderIDs); err != nil {
+		log.Log(ctx).WithField("merchant", merchantID).Error(err)
+	}
+}
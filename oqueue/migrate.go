@@ -0,0 +1,264 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/open4go/log"
+	"github.com/redis/go-redis/v9"
+	"strings"
+)
+
+const legacyQueueKeyFormat = "queue:%s" // 旧版全局队列 queue:<date>
+
+// ErrRedisStoreRequired 迁移只适用于 Redis 存储
+var ErrRedisStoreRequired = errors.New("redis store required")
+
+// redisStore 获取 Redis 存储，使用其他存储时返回 ErrRedisStoreRequired
+func (q *QueueSystem) redisStore() (*RedisStore, error) {
+	rs, ok := q.store.(*RedisStore)
+	if !ok {
+		return nil, ErrRedisStoreRequired
+	}
+	return rs, nil
+}
+
+// MigrateLegacyQueue 将旧版全局队列 queue:<date> 按商家拆分到各自的队列
+// date 格式为 2006-01-02，返回迁移的订单数
+// 迁移成功后删除旧队列key，可重复执行
+func (q *QueueSystem) MigrateLegacyQueue(ctx context.Context, date string) (int, error) {
+	rs, err := q.redisStore()
+	if err != nil {
+		return 0, err
+	}
+	legacyKey := fmt.Sprintf(legacyQueueKeyFormat, date)
+
+	orders, err := rs.client.ZRangeWithScores(ctx, legacyKey, 0, -1).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get legacy queue: %v", err)
+	}
+	if len(orders) == 0 {
+		return 0, nil
+	}
+
+	// 按商家分组，保留原有score以维持先后顺序
+	grouped := make(map[string][]redis.Z)
+	indexes := make(map[string][]interface{})
+	var lookups []*OrderInfo
+	for _, order := range orders {
+		member, ok := order.Member.(string)
+		if !ok {
+			continue
+		}
+		info, err := parseOrderInfo(member)
+		if err != nil {
+			log.Log(ctx).Printf("Failed to parse legacy order %v: %v", member, err)
+			continue
+		}
+		grouped[info.MerchantID] = append(grouped[info.MerchantID], order)
+		indexes[info.MerchantID] = append(indexes[info.MerchantID], info.OrderID, member)
+		lookups = append(lookups, info)
+	}
+
+	// 各商家的key位于不同slot，集群中不能放在同一事务中；
+	// 先写入新队列，全部成功后再删除旧队列，失败时可重新执行
+	var migrated int
+	pipe := rs.client.Pipeline()
+	for merchantID, members := range grouped {
+		queueKey := rs.getQueueKey(merchantID, date)
+		indexKey := rs.getIndexKey(merchantID, date)
+		pipe.ZAdd(ctx, queueKey, members...)
+		pipe.HSet(ctx, indexKey, indexes[merchantID]...)
+		pipe.Expire(ctx, queueKey, defaultExpiration)
+		pipe.Expire(ctx, indexKey, defaultExpiration)
+		migrated += len(members)
+	}
+	for _, info := range lookups {
+		pipe.Set(ctx, rs.getOrderMerchantKey(info.OrderID), info.MerchantID, defaultExpiration)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to migrate legacy queue: %v", err)
+	}
+
+	if err := rs.client.Del(ctx, legacyKey).Err(); err != nil {
+		return migrated, fmt.Errorf("failed to delete legacy queue: %v", err)
+	}
+	return migrated, nil
+}
+
+// RebuildIndex 为变更前创建的商家队列重建订单索引及订单所属商家的全局索引
+// date 格式为 2006-01-02，返回写入索引的订单数
+func (q *QueueSystem) RebuildIndex(ctx context.Context, merchantID, date string) (int, error) {
+	rs, err := q.redisStore()
+	if err != nil {
+		return 0, err
+	}
+	queueKey := rs.getQueueKey(merchantID, date)
+	indexKey := rs.getIndexKey(merchantID, date)
+
+	orders, err := rs.client.ZRange(ctx, queueKey, 0, -1).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get queue: %v", err)
+	}
+
+	values := make([]interface{}, 0, len(orders)*2)
+	lookups := make([]string, 0, len(orders))
+	for _, order := range orders {
+		info, err := parseOrderInfo(order)
+		if err != nil {
+			log.Log(ctx).Printf("Failed to parse order %v: %v", order, err)
+			continue
+		}
+		values = append(values, info.OrderID, order)
+		lookups = append(lookups, info.OrderID)
+	}
+
+	// 只补写队列中的订单，保留已出队订单的索引以便查询其状态
+	// 订单所属商家的全局索引与商家key位于不同slot，不能放在同一事务中
+	if len(values) > 0 {
+		pipe := rs.client.Pipeline()
+		pipe.HSet(ctx, indexKey, values...)
+		pipe.Expire(ctx, indexKey, defaultExpiration)
+		for _, orderID := range lookups {
+			pipe.Set(ctx, rs.getOrderMerchantKey(orderID), merchantID, defaultExpiration)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return 0, fmt.Errorf("failed to rebuild index: %v", err)
+		}
+	}
+
+	return len(values) / 2, nil
+}
+
+// untaggedKey 按加入哈希标签之前的格式生成key，如 queue:<merchantID>:<date>
+func untaggedKey(format string, args ...interface{}) string {
+	return fmt.Sprintf(strings.Replace(format, "{%s}", "%s", 1), args...)
+}
+
+// MigrateHashTagKeys 将商家加入哈希标签之前的key迁移到新的key，返回迁移的key数
+// 迁移商家统计，以及当前与上一营业日的队列、索引、订单状态、取餐号、工位队列等；
+// 工位统计只迁移这两天订单中出现过的工位。新key已存在时保留新数据并跳过，可重复执行。
+// 新旧key位于不同slot，无法原子迁移，迁移期间应暂停该商家的写入
+func (q *QueueSystem) MigrateHashTagKeys(ctx context.Context, merchantID string) (int, error) {
+	rs, err := q.redisStore()
+	if err != nil {
+		return 0, err
+	}
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return 0, err
+	}
+
+	keys := map[string]string{
+		untaggedKey(statsKeyFormat, merchantID): rs.getStatsKey(merchantID),
+	}
+	stations := make(map[Station]bool)
+	for _, day := range []string{q.previousDay(cfg), q.currentDay(cfg)} {
+		keys[untaggedKey(queueKeyFormat, merchantID, day)] = rs.getQueueKey(merchantID, day)
+		keys[untaggedKey(indexKeyFormat, merchantID, day)] = rs.getIndexKey(merchantID, day)
+		keys[untaggedKey(laneKeyFormat, merchantID, day)] = rs.getLaneKey(merchantID, day)
+		keys[untaggedKey(ticketKeyFormat, merchantID, day)] = rs.getTicketKey(merchantID, day)
+		keys[untaggedKey(ticketIndexKeyFormat, merchantID, day)] = rs.getTicketIndexKey(merchantID, day)
+		keys[untaggedKey(archiveKeyFormat, merchantID, day)] = rs.getArchiveKey(merchantID, day)
+		keys[untaggedKey(moveKeyFormat, merchantID, day)] = rs.getMoveKey(merchantID, day)
+		for _, state := range orderStates {
+			keys[untaggedKey(stateKeyFormat, merchantID, day, state)] = rs.getStateKey(merchantID, day, state)
+		}
+
+		// 订单状态与工位队列按旧索引中的订单确定
+		members, err := rs.client.HGetAll(ctx, untaggedKey(indexKeyFormat, merchantID, day)).Result()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get order index: %v", err)
+		}
+		for orderID, member := range members {
+			keys[untaggedKey(orderKeyFormat, merchantID, day, orderID)] = rs.getOrderKey(merchantID, day, orderID)
+			info, err := parseOrderInfo(member)
+			if err != nil {
+				log.Log(ctx).Printf("Failed to parse order %v: %v", member, err)
+				continue
+			}
+			for station := range info.Stations {
+				stations[station] = true
+				keys[untaggedKey(stationQueueKeyFormat, merchantID, day, station)] = rs.getStationQueueKey(merchantID, day, station)
+			}
+		}
+	}
+	for station := range stations {
+		keys[untaggedKey(stationStatsKeyFormat, merchantID, station)] = rs.getStationStatsKey(merchantID, station)
+	}
+
+	var migrated int
+	for from, to := range keys {
+		moved, err := rs.moveKey(ctx, from, to)
+		if err != nil {
+			return migrated, err
+		}
+		if moved {
+			migrated++
+		}
+	}
+	return migrated, nil
+}
+
+// moveKey 将key连同剩余过期时间移动到新key，新旧key可位于不同slot
+// 支持队列使用的 hash、zset、list 类型；旧key不存在或新key已存在时返回 false
+func (s *RedisStore) moveKey(ctx context.Context, from, to string) (bool, error) {
+	exists, err := s.client.Exists(ctx, to).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check %s: %v", to, err)
+	}
+	if exists > 0 {
+		log.Log(ctx).WithField("key", to).Printf("[oqueue] skip migrating %s, target key exists", from)
+		return false, nil
+	}
+
+	pipe := s.client.Pipeline()
+	keyType := pipe.Type(ctx, from)
+	ttl := pipe.PTTL(ctx, from)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("failed to inspect %s: %v", from, err)
+	}
+
+	if keyType.Val() == "none" {
+		return false, nil
+	}
+
+	pipe = s.client.TxPipeline()
+	switch keyType.Val() {
+	case "hash":
+		fields, err := s.client.HGetAll(ctx, from).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %v", from, err)
+		}
+		pipe.HSet(ctx, to, fields)
+	case "zset":
+		members, err := s.client.ZRangeWithScores(ctx, from, 0, -1).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %v", from, err)
+		}
+		pipe.ZAdd(ctx, to, members...)
+	case "list":
+		items, err := s.client.LRange(ctx, from, 0, -1).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %v", from, err)
+		}
+		values := make([]interface{}, len(items))
+		for i, item := range items {
+			values[i] = item
+		}
+		pipe.RPush(ctx, to, values...)
+	default:
+		return false, fmt.Errorf("unsupported key type %s: %s", from, keyType.Val())
+	}
+	if ttl.Val() > 0 {
+		pipe.PExpire(ctx, to, ttl.Val())
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("failed to write %s: %v", to, err)
+	}
+
+	if err := s.client.Del(ctx, from).Err(); err != nil {
+		return true, fmt.Errorf("failed to delete %s: %v", from, err)
+	}
+	return true, nil
+}
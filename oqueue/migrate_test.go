@@ -0,0 +1,100 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUntaggedKey(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{untaggedKey(queueKeyFormat, "m1", "2026-03-02"), "queue:m1:2026-03-02"},
+		{untaggedKey(statsKeyFormat, "m1"), "merchant_stats:m1"},
+		{untaggedKey(orderKeyFormat, "m1", "2026-03-02", "o1"), "queue_order:m1:2026-03-02:o1"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("key = %s, want %s", tt.got, tt.want)
+		}
+	}
+}
+
+func TestMigrateHashTagKeys(t *testing.T) {
+	ctx := context.Background()
+	q, m := newTestQueue(t)
+	orders := []OrderInfo{
+		{MerchantID: "m1", OrderID: "o1", Stations: map[Station]int{StationBar: 1}},
+		{MerchantID: "m1", OrderID: "o2", NumOfItems: 1, EnqueueTime: time.Now().Add(-3 * time.Minute)},
+		{MerchantID: "m2", OrderID: "o1", NumOfItems: 1},
+	}
+	for _, order := range orders {
+		if err := q.EnqueueOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 还原为加入哈希标签之前的key
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	defer client.Close()
+	for _, key := range m.Keys() {
+		if strings.Contains(key, "{m1}") {
+			if err := client.Rename(ctx, key, strings.Replace(key, "{m1}", "m1", 1)).Err(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, err := q.GetOrderRecord(ctx, "m1", "o1"); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("record before migration: %v", err)
+	}
+
+	n, err := q.MigrateHashTagKeys(ctx, "m1")
+	if err != nil || n == 0 {
+		t.Fatalf("migrated = %d, %v", n, err)
+	}
+	for _, key := range m.Keys() {
+		if strings.Contains(key, ":m1:") || strings.HasSuffix(key, ":m1") {
+			t.Errorf("key %s not migrated", key)
+		}
+	}
+	if record, err := q.GetOrderRecord(ctx, "m1", "o1"); err != nil || record.Ticket == "" {
+		t.Fatalf("record = %+v, %v", record, err)
+	}
+	if stats, err := q.GetMerchantStats(ctx, "m1"); err != nil || stats.ProcessedOrders != 1 {
+		t.Fatalf("processed = %d, %v", stats.ProcessedOrders, err)
+	}
+	if bar, err := q.GetStationQueue(ctx, "m1", StationBar); err != nil || len(bar) != 1 {
+		t.Fatalf("bar queue = %+v, %v", bar, err)
+	}
+	if n, _, err := q.GetMerchantQueueStatus(ctx, "m2"); err != nil || n != 1 {
+		t.Fatalf("other merchant queue = %d, %v", n, err)
+	}
+	if merchantID, err := q.GetOrderMerchant(ctx, "o1"); err != nil || merchantID != "m2" {
+		t.Fatalf("merchant of o1 = %s, %v", merchantID, err)
+	}
+
+	if n, err := q.MigrateHashTagKeys(ctx, "m1"); err != nil || n != 0 {
+		t.Fatalf("migrate again = %d, %v", n, err)
+	}
+}
+
+func TestMigrateMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	q := NewQueueSystemWithStore(NewMemoryStore())
+	if _, err := q.MigrateHashTagKeys(ctx, "m1"); !errors.Is(err, ErrRedisStoreRequired) {
+		t.Fatalf("MigrateHashTagKeys: %v", err)
+	}
+	if _, err := q.MigrateLegacyQueue(ctx, "2025-04-01"); !errors.Is(err, ErrRedisStoreRequired) {
+		t.Fatalf("MigrateLegacyQueue: %v", err)
+	}
+	if _, err := q.RebuildIndex(ctx, "m1", "2025-04-01"); !errors.Is(err, ErrRedisStoreRequired) {
+		t.Fatalf("RebuildIndex: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package oqueue
+
+import "time"
+
+// Option 队列系统配置项
+type Option func(*QueueSystem)
+
+// WithEstimator 设置默认的等待时间预估器
+func WithEstimator(e Estimator) Option {
+	return func(q *QueueSystem) {
+		q.estimator = e
+	}
+}
+
+// WithMerchantEstimator 为指定商家设置单独的预估器
+func WithMerchantEstimator(merchantID string, e Estimator) Option {
+	return func(q *QueueSystem) {
+		q.merchantEstimators[merchantID] = e
+	}
+}
+
+// WithStatsPolicy 设置商家统计的衰减与异常剔除策略
+func WithStatsPolicy(p StatsPolicy) Option {
+	return func(q *QueueSystem) {
+		q.statsPolicy = p
+	}
+}
+
+// WithLocation 设置默认时区，用于营业日划分、分时段统计与产能时段
+// 商家可通过 MerchantConfig.Location 单独覆盖
+func WithLocation(loc *time.Location) Option {
+	return func(q *QueueSystem) {
+		if loc != nil {
+			q.location = loc
+		}
+	}
+}
+
+// WithClock 设置时钟，营业日划分、状态时间、统计与预估均使用该时钟
+// 用于按虚拟时间回放订单或测试；后台任务的执行间隔仍使用系统时间
+func WithClock(c Clock) Option {
+	return func(q *QueueSystem) {
+		if c != nil {
+			q.clock = c
+		}
+	}
+}
+
+// WithArchiver 设置订单历史归档器
+// 订单出餐、取餐、取消或过期时写入归档
+func WithArchiver(a *Archiver) Option {
+	return func(q *QueueSystem) {
+		q.archiver = a
+	}
+}
+
+// WithBufferCalibration 按商家的历史预估误差自动校准缓冲系数
+// 未设置时使用预估器固定的 BufferFactor；字段为0时使用默认策略对应的值
+func WithBufferCalibration(p CalibrationPolicy) Option {
+	return func(q *QueueSystem) {
+		if p.MinSamples == 0 {
+			p.MinSamples = defaultCalibrationPolicy.MinSamples
+		}
+		if p.MinBuffer == 0 {
+			p.MinBuffer = defaultCalibrationPolicy.MinBuffer
+		}
+		if p.MaxBuffer == 0 {
+			p.MaxBuffer = defaultCalibrationPolicy.MaxBuffer
+		}
+		if p.InitialBuffer == 0 {
+			p.InitialBuffer = defaultCalibrationPolicy.InitialBuffer
+		}
+		q.calibration = &p
+	}
+}
@@ -0,0 +1,966 @@
+// Package oqueuetest 提供 oqueue.Store 实现的一致性测试
+//
+// 各存储实现在自己的测试中调用 RunStoreConformance，通过 QueueSystem 的公开接口
+// 校验入队、状态流转、统计、取餐号、通道、批量操作、调整顺序、工位、订单所属商家与事件订阅等行为一致
+package oqueuetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/open4go/p7/oqueue"
+	"sync"
+	"testing"
+	"time"
+)
+
+// NewStore 为每个子测试创建一个空的存储
+type NewStore func(t *testing.T) oqueue.Store
+
+// RunStoreConformance 对存储实现运行一致性测试
+func RunStoreConformance(t *testing.T, newStore NewStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, q *oqueue.QueueSystem)
+	}{
+		{"Config", testConfig},
+		{"EnqueuePosition", testEnqueuePosition},
+		{"Transitions", testTransitions},
+		{"Stats", testStats},
+		{"Tickets", testTickets},
+		{"Lanes", testLanes},
+		{"Batch", testBatch},
+		{"ClearArchive", testClearArchive},
+		{"Reorder", testReorder},
+		{"ReorderStations", testReorderStations},
+		{"Stations", testStations},
+		{"OrderMerchant", testOrderMerchant},
+		{"Subscribe", testSubscribe},
+		{"Reaper", testReaper},
+		{"ConcurrentEnqueue", testConcurrentEnqueue},
+		{"Snapshot", testSnapshot},
+		{"Admission", testAdmission},
+		{"Schedule", testSchedule},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, oqueue.NewQueueSystemWithStore(newStore(t), oqueue.WithLocation(time.UTC)))
+		})
+	}
+}
+
+// today 测试使用 UTC 时区，营业日即当前的 UTC 日期
+func today() string {
+	return time.Now().UTC().Format("2006-01-02")
+}
+
+// enqueue 入队订单，失败时终止测试
+func enqueue(t *testing.T, q *oqueue.QueueSystem, order oqueue.OrderInfo) string {
+	t.Helper()
+	ticket, err := q.EnqueueOrderWithTicket(context.Background(), order)
+	if err != nil {
+		t.Fatalf("enqueue %s: %v", order.OrderID, err)
+	}
+	return ticket
+}
+
+// assertQueue 校验订单在队列中的顺序
+func assertQueue(t *testing.T, q *oqueue.QueueSystem, merchantID string, orderIDs ...string) {
+	t.Helper()
+	ctx := context.Background()
+	for i, orderID := range orderIDs {
+		position, _, _, err := q.GetMerchantOrderPosition(ctx, merchantID, orderID)
+		if err != nil {
+			t.Fatalf("position of %s: %v", orderID, err)
+		}
+		if position != int64(i) {
+			t.Fatalf("position of %s = %d, want %d", orderID, position, i)
+		}
+	}
+	count, _, err := q.GetMerchantQueueStatus(ctx, merchantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(orderIDs) {
+		t.Fatalf("queue length = %d, want %d", count, len(orderIDs))
+	}
+}
+
+func testConfig(t *testing.T, q *oqueue.QueueSystem) {
+	ctx := context.Background()
+	cfg, err := q.GetMerchantConfig(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DayCutover != 0 || len(cfg.TicketPrefixes) != 0 {
+		t.Fatalf("default config = %+v", cfg)
+	}
+
+	cfg.TicketPrefixes = map[string]string{"dine_in": "T"}
+	cfg.DayCutover = 4 * time.Hour
+	if err := q.SetMerchantConfig(ctx, "m1", cfg); err != nil {
+		t.Fatal(err)
+	}
+	got, err := q.GetMerchantConfig(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DayCutover != 4*time.Hour || got.TicketPrefixes["dine_in"] != "T" {
+		t.Fatalf("config = %+v", got)
+	}
+}
+
+func testEnqueuePosition(t *testing.T, q *oqueue.QueueSystem) {
+	ctx := context.Background()
+	for i, id := range []string{"o1", "o2", "o3"} {
+		enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: id, NumOfItems: i + 1})
+	}
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m2", OrderID: "o1", NumOfItems: 1})
+	assertQueue(t, q, "m1", "o1", "o2", "o3")
+	assertQueue(t, q, "m2", "o1")
+
+	_, items, err := q.GetMerchantQueueStatus(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items != 6 {
+		t.Fatalf("items = %d, want 6", items)
+	}
+
+	err = q.EnqueueOrder(ctx, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 1})
+	if !errors.Is(err, oqueue.ErrOrderAlreadyQueued) {
+		t.Fatalf("duplicate enqueue: %v", err)
+	}
+	if _, _, _, err := q.GetMerchantOrderPosition(ctx, "m1", "missing"); !errors.Is(err, oqueue.ErrOrderNotFound) {
+		t.Fatalf("missing order: %v", err)
+	}
+	if _, err := q.GetOrderWaitEstimate(ctx, "m1", "o3"); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := q.GetOrderRecord(ctx, "m1", "o2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.State != oqueue.StateQueued || record.NumOfItems != 2 || record.EnqueuePosition != 1 {
+		t.Fatalf("record = %+v", record)
+	}
+	if _, ok := record.Transitions[oqueue.StateQueued]; !ok {
+		t.Fatal("missing queued time")
+	}
+}
+
+func testTransitions(t *testing.T, q *oqueue.QueueSystem) {
+	ctx := context.Background()
+	for _, id := range []string{"o1", "o2", "o3", "o4"} {
+		enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: id, NumOfItems: 1})
+	}
+
+	if err := q.StartPreparing(ctx, "m1", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	assertQueue(t, q, "m1", "o1", "o2", "o3", "o4")
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o1"); !errors.Is(err, oqueue.ErrOrderAlreadyCompleted) {
+		t.Fatalf("complete twice: %v", err)
+	}
+	if err := q.PickupOrder(ctx, "m1", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.CancelOrder(ctx, "m1", "o3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o3"); !errors.Is(err, oqueue.ErrOrderAlreadyDequeued) {
+		t.Fatalf("complete cancelled: %v", err)
+	}
+	if err := q.EnqueueOrder(ctx, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o3", NumOfItems: 1}); err == nil {
+		t.Fatal("re-enqueue of cancelled order succeeded")
+	}
+	if err := q.ExpireOrder(ctx, "m1", "o4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.CompleteMerchantOrder(ctx, "m1", "missing"); !errors.Is(err, oqueue.ErrOrderNotFound) {
+		t.Fatalf("complete missing: %v", err)
+	}
+	assertQueue(t, q, "m1", "o2")
+
+	record, err := q.GetOrderRecord(ctx, "m1", "o1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.State != oqueue.StatePickedUp {
+		t.Fatalf("state = %s", record.State)
+	}
+	for _, state := range []oqueue.OrderState{oqueue.StateQueued, oqueue.StatePreparing, oqueue.StateReady, oqueue.StatePickedUp} {
+		if _, ok := record.Transitions[state]; !ok {
+			t.Fatalf("missing %s time", state)
+		}
+	}
+
+	cancelled, err := q.GetOrderRecord(ctx, "m1", "o3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.State != oqueue.StateCancelled || cancelled.FinalPosition != 1 {
+		t.Fatalf("cancelled record = %+v", cancelled)
+	}
+
+	queued, err := q.ListOrdersByState(ctx, "m1", oqueue.StateQueued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 1 || queued[0].OrderID != "o2" {
+		t.Fatalf("queued orders = %+v", queued)
+	}
+	expired, err := q.ListOrdersByState(ctx, "m1", oqueue.StateExpired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0].OrderID != "o4" {
+		t.Fatalf("expired orders = %+v", expired)
+	}
+}
+
+func testStats(t *testing.T, q *oqueue.QueueSystem) {
+	ctx := context.Background()
+	enqueued := time.Now().Add(-2 * time.Minute)
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 2, EnqueueTime: enqueued})
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o2", NumOfItems: 1})
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	// 立即完成的订单低于最小每商品时间，视为异常
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o2"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := q.GetMerchantStats(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.ProcessedOrders != 1 || stats.RejectedOrders != 1 {
+		t.Fatalf("processed = %d, rejected = %d", stats.ProcessedOrders, stats.RejectedOrders)
+	}
+	if d := stats.AvgItemTime - time.Minute; d < -time.Second || d > time.Second {
+		t.Fatalf("avg item time = %v", stats.AvgItemTime)
+	}
+	if stats.EWMAItemTime != stats.AvgItemTime || stats.SampleWeight != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if stats.P50ItemTime <= 45*time.Second || stats.P50ItemTime > 90*time.Second {
+		t.Fatalf("p50 = %v", stats.P50ItemTime)
+	}
+	var hourly int64
+	for _, n := range stats.HourlyOrders {
+		hourly += n
+	}
+	if hourly != 1 {
+		t.Fatalf("hourly orders = %v", stats.HourlyOrders)
+	}
+	if stats.EstimatedOrders != 1 || stats.MeanAbsError <= 0 {
+		t.Fatalf("accuracy = %v, %v", stats.EstimatedOrders, stats.MeanAbsError)
+	}
+}
+
+func testTickets(t *testing.T, q *oqueue.QueueSystem) {
+	ctx := context.Background()
+	tickets := []string{
+		enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 1}),
+		enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o2", NumOfItems: 1, Channel: oqueue.ChannelTakeaway}),
+		enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o3", NumOfItems: 1}),
+		enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o4", NumOfItems: 1, Ticket: "VIP9"}),
+	}
+	want := []string{"A001", "B001", "A002", "VIP9"}
+	for i := range want {
+		if tickets[i] != want[i] {
+			t.Fatalf("tickets = %v, want %v", tickets, want)
+		}
+	}
+
+	record, err := q.GetOrderByTicket(ctx, "m1", "A002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.OrderID != "o3" || record.Ticket != "A002" {
+		t.Fatalf("record = %+v", record)
+	}
+	if _, err := q.GetOrderByTicket(ctx, "m1", "A999"); !errors.Is(err, oqueue.ErrOrderNotFound) {
+		t.Fatalf("missing ticket: %v", err)
+	}
+
+	for _, id := range []string{"o1", "o3", "o2"} {
+		if err := q.CompleteMerchantOrder(ctx, "m1", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	serving, err := q.GetNowServing(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serving) != 2 || serving["A"] != "A002" || serving["B"] != "B001" {
+		t.Fatalf("now serving = %v", serving)
+	}
+}
+
+func testLanes(t *testing.T, q *oqueue.QueueSystem) {
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 1})
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o2", NumOfItems: 1, Lane: oqueue.LanePlatform})
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o3", NumOfItems: 1, Lane: oqueue.LaneRush})
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o4", NumOfItems: 1})
+	assertQueue(t, q, "m1", "o3", "o2", "o1", "o4")
+
+	// 高权重通道的到达会计入后续普通订单的预估
+	estimate, err := q.EstimateNewOrderWait(context.Background(), "m1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate.Expected <= 0 {
+		t.Fatalf("estimate = %+v", estimate)
+	}
+}
+
+func testBatch(t *testing.T, q *oqueue.QueueSystem) {
+	ctx := context.Background()
+	results, err := q.EnqueueOrders(ctx, []oqueue.OrderInfo{
+		{MerchantID: "m1", OrderID: "o1", NumOfItems: 1},
+		{MerchantID: "m2", OrderID: "o1", NumOfItems: 2},
+		{MerchantID: "m1", OrderID: "o1", NumOfItems: 1},
+		{MerchantID: "m1", OrderID: "o2", NumOfItems: 1, Stations: map[oqueue.Station]int{"": 1}},
+		{MerchantID: "m1", OrderID: "o3", NumOfItems: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil || results[0].Ticket != "A001" || results[1].Err != nil || results[4].Ticket != "A002" {
+		t.Fatalf("results = %+v", results)
+	}
+	if !errors.Is(results[2].Err, oqueue.ErrOrderAlreadyQueued) || results[3].Err == nil {
+		t.Fatalf("results = %+v", results)
+	}
+	assertQueue(t, q, "m1", "o1", "o3")
+
+	completed, err := q.CompleteOrders(ctx, "m1", []string{"o1", "missing", "o3", "o1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completed[0].Err != nil || completed[2].Err != nil {
+		t.Fatalf("completed = %+v", completed)
+	}
+	if !errors.Is(completed[1].Err, oqueue.ErrOrderNotFound) || !errors.Is(completed[3].Err, oqueue.ErrOrderAlreadyCompleted) {
+		t.Fatalf("completed = %+v", completed)
+	}
+	assertQueue(t, q, "m1")
+}
+
+func testClearArchive(t *testing.T, q *oqueue.QueueSystem) {
+	ctx := context.Background()
+	for _, id := range []string{"o1", "o2", "o3"} {
+		enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: id, NumOfItems: 2})
+	}
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	cleared, err := q.ClearMerchantQueue(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleared != 2 {
+		t.Fatalf("cleared = %d, want 2", cleared)
+	}
+	assertQueue(t, q, "m1")
+
+	archived, err := q.GetArchivedOrders(ctx, "m1", today())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archived) != 2 || archived[0].OrderID != "o2" || archived[1].OrderID != "o3" {
+		t.Fatalf("archived = %+v", archived)
+	}
+	if archived[0].State != oqueue.StateCancelled || archived[0].NumOfItems != 2 || archived[0].EnqueueTime.IsZero() {
+		t.Fatalf("archived order = %+v", archived[0])
+	}
+}
+
+func testReorder(t *testing.T, q *oqueue.QueueSystem) {
+	ctx := context.Background()
+	for _, id := range []string{"o0", "o1", "o2", "o3"} {
+		enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: id, NumOfItems: 1})
+	}
+
+	if err := q.MoveToFront(ctx, "m1", "o2", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	assertQueue(t, q, "m1", "o2", "o0", "o1", "o3")
+	if err := q.MoveBefore(ctx, "m1", "o3", "o0", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	assertQueue(t, q, "m1", "o2", "o3", "o0", "o1")
+	if err := q.Defer(ctx, "m1", "o2", time.Hour, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	assertQueue(t, q, "m1", "o3", "o0", "o1", "o2")
+
+	if err := q.Hold(ctx, "m1", "o3", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	assertQueue(t, q, "m1", "o0", "o1", "o2", "o3")
+	if err := q.Hold(ctx, "m1", "o3", "bob"); !errors.Is(err, oqueue.ErrOrderHeld) {
+		t.Fatalf("hold twice: %v", err)
+	}
+	if err := q.MoveBefore(ctx, "m1", "o0", "o3", "bob"); !errors.Is(err, oqueue.ErrOrderHeld) {
+		t.Fatalf("move before held: %v", err)
+	}
+	record, err := q.GetOrderRecord(ctx, "m1", "o3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !record.Held {
+		t.Fatal("order not held")
+	}
+	if err := q.Release(ctx, "m1", "o3", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	assertQueue(t, q, "m1", "o3", "o0", "o1", "o2")
+	if err := q.Release(ctx, "m1", "o3", "bob"); !errors.Is(err, oqueue.ErrOrderNotHeld) {
+		t.Fatalf("release twice: %v", err)
+	}
+
+	if err := q.StartPreparing(ctx, "m1", "o0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.MoveToFront(ctx, "m1", "o0", "bob"); !errors.Is(err, oqueue.ErrOrderNotQueued) {
+		t.Fatalf("move preparing: %v", err)
+	}
+	if err := q.MoveToFront(ctx, "m1", "missing", "bob"); !errors.Is(err, oqueue.ErrOrderNotFound) {
+		t.Fatalf("move missing: %v", err)
+	}
+
+	records, err := q.GetMoveRecords(ctx, "m1", today())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("move records = %+v", records)
+	}
+	first := records[0]
+	if first.Action != oqueue.MoveActionFront || first.OrderID != "o2" || first.Operator != "alice" || first.From != 2 || first.To != 0 {
+		t.Fatalf("first move = %+v", first)
+	}
+	if records[2].DeferredMs != time.Hour.Milliseconds() || records[1].OtherID != "o0" {
+		t.Fatalf("move records = %+v", records)
+	}
+}
+
+// assertStation 校验工位队列中小票的顺序
+func assertStation(t *testing.T, q *oqueue.QueueSystem, merchantID string, station oqueue.Station, orderIDs ...string) {
+	t.Helper()
+	tickets, err := q.GetStationQueue(context.Background(), merchantID, station)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, len(tickets))
+	for i, ticket := range tickets {
+		got[i] = ticket.OrderID
+	}
+	if fmt.Sprint(got) != fmt.Sprint(orderIDs) {
+		t.Fatalf("%s queue = %v, want %v", station, got, orderIDs)
+	}
+}
+
+func testReorderStations(t *testing.T, q *oqueue.QueueSystem) {
+	ctx := context.Background()
+	for _, id := range []string{"o0", "o1", "o2", "o3"} {
+		enqueue(t, q, oqueue.OrderInfo{
+			MerchantID: "m1",
+			OrderID:    id,
+			Stations:   map[oqueue.Station]int{oqueue.StationKitchen: 1, oqueue.StationBar: 1},
+		})
+	}
+	// 已完成的小票不会因调整顺序重新加入工位队列
+	if _, err := q.CompleteStation(ctx, "m1", "o2", oqueue.StationBar); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name  string
+		move  func() error
+		order []string
+	}{
+		{"front", func() error { return q.MoveToFront(ctx, "m1", "o2", "alice") }, []string{"o2", "o0", "o1", "o3"}},
+		{"before", func() error { return q.MoveBefore(ctx, "m1", "o3", "o0", "alice") }, []string{"o2", "o3", "o0", "o1"}},
+		{"defer", func() error { return q.Defer(ctx, "m1", "o2", time.Hour, "bob") }, []string{"o3", "o0", "o1", "o2"}},
+		{"hold", func() error { return q.Hold(ctx, "m1", "o3", "bob") }, []string{"o0", "o1", "o2", "o3"}},
+		{"release", func() error { return q.Release(ctx, "m1", "o3", "bob") }, []string{"o3", "o0", "o1", "o2"}},
+	}
+	for _, step := range steps {
+		if err := step.move(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		assertQueue(t, q, "m1", step.order...)
+		assertStation(t, q, "m1", oqueue.StationKitchen, step.order...)
+		var bar []string
+		for _, id := range step.order {
+			if id != "o2" {
+				bar = append(bar, id)
+			}
+		}
+		assertStation(t, q, "m1", oqueue.StationBar, bar...)
+	}
+}
+
+func testStations(t *testing.T, q *oqueue.QueueSystem) {
+	ctx := context.Background()
+	enqueued := time.Now().Add(-time.Minute)
+	enqueue(t, q, oqueue.OrderInfo{
+		MerchantID:  "m1",
+		OrderID:     "o1",
+		EnqueueTime: enqueued,
+		Stations:    map[oqueue.Station]int{oqueue.StationKitchen: 2, oqueue.StationBar: 1},
+	})
+	enqueue(t, q, oqueue.OrderInfo{
+		MerchantID: "m1",
+		OrderID:    "o2",
+		Stations:   map[oqueue.Station]int{oqueue.StationBar: 1},
+	})
+
+	bar, err := q.GetStationQueue(ctx, "m1", oqueue.StationBar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bar) != 2 || bar[0].OrderID != "o1" || bar[1].OrderID != "o2" || bar[1].Position != 1 || bar[0].Ticket != "A001" {
+		t.Fatalf("bar queue = %+v", bar)
+	}
+
+	done, err := q.CompleteStation(ctx, "m1", "o1", oqueue.StationBar)
+	if err != nil || done {
+		t.Fatalf("complete bar: %v, %v", done, err)
+	}
+	if _, err := q.CompleteStation(ctx, "m1", "o1", oqueue.StationBar); !errors.Is(err, oqueue.ErrStationAlreadyCompleted) {
+		t.Fatalf("complete bar twice: %v", err)
+	}
+	if _, err := q.CompleteStation(ctx, "m1", "o1", oqueue.StationDessert); !errors.Is(err, oqueue.ErrOrderNotFound) {
+		t.Fatalf("complete missing station: %v", err)
+	}
+	record, err := q.GetOrderRecord(ctx, "m1", "o1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.NumOfItems != 3 || record.State != oqueue.StateQueued || len(record.StationsDone) != 1 {
+		t.Fatalf("record = %+v", record)
+	}
+
+	done, err = q.CompleteStation(ctx, "m1", "o1", oqueue.StationKitchen)
+	if err != nil || !done {
+		t.Fatalf("complete kitchen: %v, %v", done, err)
+	}
+	record, err = q.GetOrderRecord(ctx, "m1", "o1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.State != oqueue.StateReady || len(record.StationsDone) != 2 {
+		t.Fatalf("record = %+v", record)
+	}
+	if _, err := q.CompleteStation(ctx, "m1", "o1", oqueue.StationKitchen); !errors.Is(err, oqueue.ErrOrderAlreadyCompleted) {
+		t.Fatalf("complete after ready: %v", err)
+	}
+
+	kitchen, err := q.GetStationStats(ctx, "m1", oqueue.StationKitchen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kitchen.ProcessedOrders != 1 || kitchen.AvgItemTime < 29*time.Second || kitchen.AvgItemTime > 31*time.Second {
+		t.Fatalf("kitchen stats = %+v", kitchen)
+	}
+
+	// 订单离开队列后移除未完成的工位小票
+	if err := q.CancelOrder(ctx, "m1", "o2"); err != nil {
+		t.Fatal(err)
+	}
+	bar, err = q.GetStationQueue(ctx, "m1", oqueue.StationBar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bar) != 0 {
+		t.Fatalf("bar queue = %+v", bar)
+	}
+}
+
+func testOrderMerchant(t *testing.T, q *oqueue.QueueSystem) {
+	ctx := context.Background()
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 1})
+	if _, err := q.EnqueueOrders(ctx, []oqueue.OrderInfo{{MerchantID: "m2", OrderID: "o2", NumOfItems: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	for orderID, want := range map[string]string{"o1": "m1", "o2": "m2"} {
+		merchantID, err := q.GetOrderMerchant(ctx, orderID)
+		if err != nil || merchantID != want {
+			t.Fatalf("merchant of %s = %q, %v", orderID, merchantID, err)
+		}
+	}
+
+	// 离开队列后删除索引，其他商家复用的订单ID保留
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m3", OrderID: "o1", NumOfItems: 1})
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if merchantID, err := q.GetOrderMerchant(ctx, "o1"); err != nil || merchantID != "m3" {
+		t.Fatalf("merchant of reused o1 = %q, %v", merchantID, err)
+	}
+	if _, err := q.CompleteOrders(ctx, "m2", []string{"o2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.GetOrderMerchant(ctx, "o2"); !errors.Is(err, oqueue.ErrOrderNotFound) {
+		t.Fatalf("merchant of completed o2: %v", err)
+	}
+}
+
+func testSubscribe(t *testing.T, q *oqueue.QueueSystem) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 1})
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o2", NumOfItems: 1})
+
+	updates, err := q.SubscribeOrder(ctx, "m1", "o2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func() oqueue.OrderUpdate {
+		t.Helper()
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				t.Fatal("updates closed")
+			}
+			return update
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for update")
+		}
+		return oqueue.OrderUpdate{}
+	}
+
+	if first := next(); first.Position != 1 || first.State != oqueue.StateQueued || first.Event != "" {
+		t.Fatalf("first update = %+v", first)
+	}
+	// 其他商家的事件不影响订阅
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m2", OrderID: "o1", NumOfItems: 1})
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if update := next(); update.Position != 0 || update.Event != oqueue.EventAdvanced {
+		t.Fatalf("advanced update = %+v", update)
+	}
+	if err := q.CancelOrder(ctx, "m1", "o2"); err != nil {
+		t.Fatal(err)
+	}
+	if update := next(); update.State != oqueue.StateCancelled {
+		t.Fatalf("final update = %+v", update)
+	}
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Fatal("updates not closed after order left the queue")
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for close")
+	}
+}
+
+func testReaper(t *testing.T, q *oqueue.QueueSystem) {
+	ctx := context.Background()
+	if err := q.SetMerchantConfig(ctx, "m1", oqueue.MerchantConfig{StaleAfter: 50 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 1})
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o2", NumOfItems: 1})
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o2"); err != nil {
+		t.Fatal(err)
+	}
+
+	merchants, err := q.ActiveMerchants(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merchants) != 1 || merchants[0] != "m1" {
+		t.Fatalf("active merchants = %v", merchants)
+	}
+
+	expired, err := q.ReapStaleOrders(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 0 {
+		t.Fatalf("expired too early: %v", expired)
+	}
+	time.Sleep(100 * time.Millisecond)
+	expired, err = q.ReapStaleOrders(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0] != "o1" {
+		t.Fatalf("expired = %v", expired)
+	}
+	record, err := q.GetOrderRecord(ctx, "m1", "o1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.State != oqueue.StateExpired {
+		t.Fatalf("state = %s", record.State)
+	}
+}
+
+func testConcurrentEnqueue(t *testing.T, q *oqueue.QueueSystem) {
+	const n = 50
+	var wg sync.WaitGroup
+	tickets := make([]string, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tickets[i], errs[i] = q.EnqueueOrderWithTicket(context.Background(), oqueue.OrderInfo{
+				MerchantID: "m1",
+				OrderID:    fmt.Sprintf("o%d", i),
+				NumOfItems: 1,
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool, n)
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if seen[tickets[i]] {
+			t.Fatalf("duplicate ticket %s", tickets[i])
+		}
+		seen[tickets[i]] = true
+	}
+	count, _, err := q.GetMerchantQueueStatus(context.Background(), "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != n {
+		t.Fatalf("queue length = %d, want %d", count, n)
+	}
+}
+
+func testSnapshot(t *testing.T, q *oqueue.QueueSystem) {
+	ctx := context.Background()
+	now := time.Now()
+	ticket := enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 2, EnqueueTime: now.Add(-3 * time.Minute)})
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o2", NumOfItems: 1, EnqueueTime: now.Add(-time.Minute)})
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o3", NumOfItems: 4, EnqueueTime: now.Add(-2 * time.Minute)})
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.PickupOrder(ctx, "m1", "o3"); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := q.GetQueueSnapshot(ctx, "m1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Day != today() || len(snapshot.Orders) != 2 || snapshot.TotalItems != 3 {
+		t.Fatalf("snapshot = %+v", snapshot)
+	}
+	for i, orderID := range []string{"o1", "o2"} {
+		order := snapshot.Orders[i]
+		if order.OrderID != orderID || order.Position != int64(i) || order.Ticket == "" {
+			t.Fatalf("order %d = %+v", i, order)
+		}
+		if order.State != oqueue.StateQueued || order.Wait.Expected < 0 {
+			t.Fatalf("order %s = %+v", orderID, order)
+		}
+	}
+	if snapshot.Orders[1].Wait.Expected <= snapshot.Orders[0].Wait.Expected {
+		t.Fatalf("waits = %v, %v", snapshot.Orders[0].Wait, snapshot.Orders[1].Wait)
+	}
+	if snapshot.Orders[0].Ticket != ticket || snapshot.Orders[0].Age < 3*time.Minute {
+		t.Fatalf("first order = %+v", snapshot.Orders[0])
+	}
+	if snapshot.LongestWaiting == nil || snapshot.LongestWaiting.OrderID != "o1" {
+		t.Fatalf("longest waiting = %+v", snapshot.LongestWaiting)
+	}
+	if snapshot.CompletedToday != 1 {
+		t.Fatalf("completed = %d", snapshot.CompletedToday)
+	}
+	tp := snapshot.Throughput
+	if tp.Window != time.Hour || tp.Orders != 1 || tp.Items != 4 || tp.OrdersPerHour != 1 || tp.ItemsPerHour != 4 {
+		t.Fatalf("throughput = %+v", tp)
+	}
+
+	// 窗口外出餐的订单不计入速率，出餐时间精确到毫秒
+	time.Sleep(10 * time.Millisecond)
+	snapshot, err = q.GetQueueSnapshot(ctx, "m1", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Throughput.Orders != 0 || snapshot.CompletedToday != 1 {
+		t.Fatalf("throughput = %+v", snapshot.Throughput)
+	}
+
+	empty, err := q.GetQueueSnapshot(ctx, "m2", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(empty.Orders) != 0 || empty.LongestWaiting != nil || empty.CompletedToday != 0 {
+		t.Fatalf("empty snapshot = %+v", empty)
+	}
+}
+
+func testAdmission(t *testing.T, q *oqueue.QueueSystem) {
+	ctx := context.Background()
+	cfg := oqueue.MerchantConfig{Admission: oqueue.AdmissionPolicy{MaxOrders: 2, MaxItems: 5}}
+	if err := q.SetMerchantConfig(ctx, "m1", cfg); err != nil {
+		t.Fatal(err)
+	}
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 3})
+
+	var full *oqueue.QueueFullError
+	err := q.EnqueueOrder(ctx, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o2", NumOfItems: 3})
+	if !errors.As(err, &full) || !errors.Is(err, oqueue.ErrQueueFull) || full.Limit != oqueue.LimitItems {
+		t.Fatalf("err = %v", err)
+	}
+	if full.Orders != 1 || full.Items != 3 || !full.SuggestedPickup.After(time.Now()) {
+		t.Fatalf("queue full = %+v", full)
+	}
+	if err := q.CheckAdmission(ctx, "m1", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// 批量入队时本批已准入的订单计入上限
+	results, err := q.EnqueueOrders(ctx, []oqueue.OrderInfo{
+		{MerchantID: "m1", OrderID: "o2", NumOfItems: 1},
+		{MerchantID: "m1", OrderID: "o3", NumOfItems: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil || !errors.As(results[1].Err, &full) || full.Limit != oqueue.LimitOrders {
+		t.Fatalf("results = %+v", results)
+	}
+	assertQueue(t, q, "m1", "o1", "o2")
+
+	cfg.Admission = oqueue.AdmissionPolicy{MaxWait: time.Minute}
+	if err := q.SetMerchantConfig(ctx, "m1", cfg); err != nil {
+		t.Fatal(err)
+	}
+	err = q.EnqueueOrder(ctx, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o3", NumOfItems: 1})
+	if !errors.As(err, &full) || full.Limit != oqueue.LimitWait || full.Wait.Expected <= time.Minute {
+		t.Fatalf("err = %v", err)
+	}
+	if full.SuggestedPickup.Before(time.Now().Add(full.Wait.Expected)) || full.SuggestedPickup.Minute()%5 != 0 {
+		t.Fatalf("suggested pickup = %v", full.SuggestedPickup)
+	}
+
+	if err := q.PauseOrdering(ctx, "m2", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	err = q.EnqueueOrder(ctx, oqueue.OrderInfo{MerchantID: "m2", OrderID: "o1", NumOfItems: 1})
+	if !errors.Is(err, oqueue.ErrOrderingPaused) || errors.Is(err, oqueue.ErrQueueFull) {
+		t.Fatalf("err = %v", err)
+	}
+	snapshot, err := q.GetQueueSnapshot(ctx, "m2", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !snapshot.Paused {
+		t.Fatal("snapshot not paused")
+	}
+	if err := q.ResumeOrdering(ctx, "m2"); err != nil {
+		t.Fatal(err)
+	}
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m2", OrderID: "o1", NumOfItems: 1})
+
+	// 到恢复时间后自动恢复接单
+	if err := q.PauseOrdering(ctx, "m2", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m2", OrderID: "o2", NumOfItems: 1})
+}
+
+func testSchedule(t *testing.T, q *oqueue.QueueSystem) {
+	ctx := context.Background()
+	later, err := q.ScheduleOrder(ctx, oqueue.OrderInfo{MerchantID: "m1", OrderID: "s1", NumOfItems: 1}, time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prep := later.PickupAt.Sub(later.ReleaseAt)
+	if prep <= 0 || later.Order.Ticket != "" {
+		t.Fatalf("scheduled = %+v", later)
+	}
+	if _, err := q.ScheduleOrder(ctx, oqueue.OrderInfo{MerchantID: "m1", OrderID: "s1", NumOfItems: 1}, later.PickupAt); !errors.Is(err, oqueue.ErrOrderAlreadyScheduled) {
+		t.Fatalf("err = %v", err)
+	}
+
+	// 放入时间已到的预约订单直接入队，并排在普通订单之前
+	enqueue(t, q, oqueue.OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 1})
+	now, err := q.ScheduleOrder(ctx, oqueue.OrderInfo{MerchantID: "m1", OrderID: "s2", NumOfItems: 1}, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if now.Order.Ticket == "" {
+		t.Fatalf("scheduled = %+v", now)
+	}
+	assertQueue(t, q, "m1", "s2", "o1")
+
+	// 即将放入队列的预约订单计入新订单的预估时间
+	before, err := q.EstimateNewOrderWait(ctx, "m1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	soon, err := q.ScheduleOrder(ctx, oqueue.OrderInfo{MerchantID: "m1", OrderID: "s3", NumOfItems: 1}, time.Now().Add(prep+100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := q.EstimateNewOrderWait(ctx, "m1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Expected <= before.Expected {
+		t.Fatalf("estimate before = %v, after = %v", before.Expected, after.Expected)
+	}
+
+	snapshot, err := q.GetQueueSnapshot(ctx, "m1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Scheduled) != 2 || snapshot.Scheduled[0].Order.OrderID != "s3" || snapshot.Scheduled[1].Order.OrderID != "s1" {
+		t.Fatalf("scheduled = %+v", snapshot.Scheduled)
+	}
+
+	time.Sleep(time.Until(soon.ReleaseAt) + 10*time.Millisecond)
+	released, err := q.ReleaseScheduledOrders(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(released) != 1 || released[0] != "s3" {
+		t.Fatalf("released = %v", released)
+	}
+	assertQueue(t, q, "m1", "s2", "s3", "o1")
+	record, err := q.GetOrderRecord(ctx, "m1", "s3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Lane != oqueue.LaneScheduled || record.Ticket == "" {
+		t.Fatalf("record = %+v", record)
+	}
+
+	if err := q.CancelScheduledOrder(ctx, "m1", "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.CancelScheduledOrder(ctx, "m1", "s1"); !errors.Is(err, oqueue.ErrOrderNotFound) {
+		t.Fatalf("err = %v", err)
+	}
+	scheduled, err := q.GetScheduledOrders(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scheduled) != 0 {
+		t.Fatalf("scheduled = %+v", scheduled)
+	}
+}
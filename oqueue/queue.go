@@ -3,389 +3,307 @@ package oqueue
 import (
 	"context"
 	"fmt"
-	"github.com/open4go/log"
+	"github.com/open4go/p7/clock"
 	"github.com/redis/go-redis/v9"
-	"strconv"
-	"strings"
 	"time"
 )
 
 const (
-	queueKeyFormat     = "queue:%s"
-	statsKeyFormat     = "merchant_stats:%s"
-	defaultExpiration  = 48 * time.Hour
-	baseProcessTime    = 2 * time.Minute    // 每单基础处理时间
-	itemProcessTimeKey = "avg_item_time"    // 平均每商品处理时间(毫秒)
-	orderCountKey      = "processed_orders" // 已处理订单数
-	defaultItemTime    = 1 * time.Minute    // 默认每商品处理时间
-	minProcessedOrders = 5                  // 最小样本数才使用历史数据
+	defaultExpiration   = 48 * time.Hour
+	statsExpiration     = 30 * 24 * time.Hour // 保留30天统计数据
+	baseProcessTime     = 2 * time.Minute     // 每单基础处理时间
+	itemProcessTimeKey  = "avg_item_time"     // 平均每商品处理时间(毫秒)
+	orderCountKey       = "processed_orders"  // 已处理订单数
+	defaultItemTime     = 1 * time.Minute     // 默认每商品处理时间
+	minProcessedOrders  = 5                   // 最小样本数才使用历史数据
+	defaultBufferFactor = 1.2                 // 预估时间缓冲系数
 )
 
 // OrderInfo 增强版OrderInfo
 type OrderInfo struct {
-	MerchantID  string
-	OrderID     string
-	NumOfItems  int
-	Timestamp   int64 // 入队时间戳
-	EnqueueTime time.Time
+	MerchantID  string    `json:"merchant_id"`
+	OrderID     string    `json:"order_id"`
+	NumOfItems  int       `json:"num_of_items"`
+	Timestamp   int64     `json:"timestamp"`         // 入队时间戳
+	EnqueueTime time.Time `json:"-"`                 // 以纳秒时间戳 enqueue_at 编码
+	Lane        Lane      `json:"lane,omitempty"`    // 优先通道，默认普通通道
+	Channel     Channel   `json:"channel,omitempty"` // 来源渠道，用于区分取餐号前缀
+	Ticket      string    `json:"ticket,omitempty"`  // 取餐号，如 A042，入队时自动分配
+	// Stations 各工位的商品数，如 {"kitchen": 1, "bar": 1}，为空时订单不拆分到工位
+	Stations map[Station]int `json:"stations,omitempty"`
 }
 
 // QueueSystem 增强版排队系统
 type QueueSystem struct {
-	client *redis.Client
+	store              Store
+	estimator          Estimator
+	merchantEstimators map[string]Estimator
+	statsPolicy        StatsPolicy
+	location           *time.Location // 商家未配置时区时使用的默认时区
+	archiver           *Archiver      // 订单历史归档，为空时不归档
+	calibration        *CalibrationPolicy
+	clock              Clock
 }
 
-// NewQueueSystem 创建队列系统
-func NewQueueSystem(client *redis.Client) *QueueSystem {
-	return &QueueSystem{client: client}
+// NewQueueSystem 创建基于 Redis 的队列系统
+// client 可以是单机 *redis.Client、哨兵模式的 FailoverClient 或 *redis.ClusterClient
+func NewQueueSystem(client redis.UniversalClient, opts ...Option) *QueueSystem {
+	return NewQueueSystemWithStore(NewRedisStore(client), opts...)
 }
 
-// getQueueKey 获取当天的队列key
-func (q *QueueSystem) getQueueKey() string {
-	loc, _ := time.LoadLocation("Asia/Shanghai")
-	date := time.Now().In(loc).Format("2006-01-02")
-	return fmt.Sprintf(queueKeyFormat, date)
-}
-
-// getStatsKey 获取商家统计key
-func (q *QueueSystem) getStatsKey(merchantID string) string {
-	return fmt.Sprintf(statsKeyFormat, merchantID)
+// NewQueueSystemWithStore 使用指定存储创建队列系统，如测试或单机部署使用 NewMemoryStore
+func NewQueueSystemWithStore(store Store, opts ...Option) *QueueSystem {
+	q := &QueueSystem{
+		store:              store,
+		estimator:          NewDefaultEstimator(),
+		merchantEstimators: make(map[string]Estimator),
+		statsPolicy:        defaultStatsPolicy,
+		location:           defaultLocation(),
+		clock:              clock.System,
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	return q
 }
 
 // EnqueueOrder 将订单加入队列
+// 队列按 入队时间-通道权重 排序，同一通道内先进先出
+// 同一订单重复入队返回 ErrOrderAlreadyQueued，当天已出餐或取消的订单不可再次入队
+// 超出商家准入策略或暂停接单时返回 *QueueFullError
 func (q *QueueSystem) EnqueueOrder(ctx context.Context, order OrderInfo) error {
-	queueKey := q.getQueueKey()
-
-	if err := q.client.Expire(ctx, queueKey, defaultExpiration).Err(); err != nil {
-		return fmt.Errorf("failed to set expiration: %v", err)
-	}
-
-	if order.Timestamp == 0 {
-		order.Timestamp = time.Now().UnixNano()
-	}
-	if order.EnqueueTime.IsZero() {
-		order.EnqueueTime = time.Now()
-	}
-
-	// Create a value that can be reliably parsed
-	value := fmt.Sprintf("%s:%s:%d:%d",
-		order.MerchantID,
-		order.OrderID,
-		order.NumOfItems,
-		order.EnqueueTime.Unix())
-
-	// 修正后的ZAdd调用方式
-	z := redis.Z{
-		Score:  float64(order.Timestamp),
-		Member: value,
-	}
-
-	// 两种调用方式，根据你的redis客户端版本选择一种
-	// 方式1: 适用于较新版本
-	if err := q.client.ZAdd(ctx, queueKey, z).Err(); err != nil {
-		return fmt.Errorf("failed to enqueue order: %v", err)
-	}
-
-	return nil
+	_, err := q.EnqueueOrderWithTicket(ctx, order)
+	return err
 }
 
-// GetOrderPosition 获取订单在队列中的位置及预估等待时间
-func (q *QueueSystem) GetOrderPosition(ctx context.Context, orderID string) (position int64, waitTime time.Duration, info *OrderInfo, err error) {
-	queueKey := q.getQueueKey()
-
-	orders, err := q.client.ZRangeWithScores(ctx, queueKey, 0, -1).Result()
+// EnqueueOrderWithTicket 将订单加入队列并返回分配的取餐号
+// 取餐号按商家、营业日、前缀递增，如 A001、A002；订单已指定 Ticket 时沿用该取餐号，
+// 该取餐号当天已被其他订单使用时返回 ErrTicketTaken
+func (q *QueueSystem) EnqueueOrderWithTicket(ctx context.Context, order OrderInfo) (string, error) {
+	cfg, err := q.GetMerchantConfig(ctx, order.MerchantID)
 	if err != nil {
-		return 0, 0, nil, fmt.Errorf("failed to get queue: %v", err)
+		return "", err
 	}
 
-	var found bool
-	var precedingItems int
-	var precedingOrders int
-
-	for i, order := range orders {
-		orderInfo, err := parseOrderInfo(order.Member.(string))
-		if err != nil {
-			log.Log(ctx).Printf("Failed to parse order %v: %v", order, err)
-			continue
-		}
-
-		if orderInfo.OrderID == orderID {
-			position = int64(i)
-			info = orderInfo
-			found = true
-			break
-		}
-
-		// 计算前面订单的总商品数和订单数
-		precedingItems += orderInfo.NumOfItems
-		precedingOrders++
-	}
-
-	if !found {
-		return 0, 0, nil, fmt.Errorf("order not found")
+	req, err := q.enqueueRequest(cfg, &order)
+	if err != nil {
+		return "", err
 	}
-
-	// 计算预估等待时间
-	waitTime, err = q.calculateWaitTime(ctx, info.MerchantID, precedingItems, precedingOrders)
+	a, err := q.newAdmission(ctx, order.MerchantID, cfg)
 	if err != nil {
-		return position, 0, info, fmt.Errorf("failed to calculate wait time: %v", err)
+		return "", err
 	}
-
-	return position, waitTime, info, nil
+	if err := q.admit(ctx, a, order.Lane, order.NumOfItems); err != nil {
+		return "", err
+	}
+	return q.enqueue(ctx, cfg, req)
 }
 
-// calculateWaitTime 计算预估等待时间
-func (q *QueueSystem) calculateWaitTime(ctx context.Context, merchantID string, precedingItems, precedingOrders int) (time.Duration, error) {
-	statsKey := q.getStatsKey(merchantID)
-
-	// 获取商家历史统计数据
-	avgItemTime, processedOrders, err := q.getMerchantStats(ctx, statsKey)
+// enqueue 执行单个入队请求，成功后记录活跃商家、发布事件并记录入队时的预估
+func (q *QueueSystem) enqueue(ctx context.Context, cfg MerchantConfig, req EnqueueRequest) (string, error) {
+	results, err := q.store.Enqueue(ctx, []EnqueueRequest{req})
 	if err != nil {
-		return 0, err
+		return "", err
 	}
-
-	// 如果历史数据不足，使用默认值
-	if processedOrders < minProcessedOrders {
-		avgItemTime = defaultItemTime
+	if results[0].Err != nil {
+		return "", results[0].Err
 	}
+	ticket, position := results[0].Ticket, results[0].Position
 
-	// 计算预估时间 = (前面商品数 × 平均每商品时间) + (前面订单数 × 基础处理时间)
-	totalWait := time.Duration(precedingItems)*avgItemTime + time.Duration(precedingOrders)*baseProcessTime
-
-	return totalWait, nil
+	order := req.Order
+	q.markActive(ctx, order.MerchantID)
+	q.setOrderMerchants(ctx, []OrderInfo{order})
+	q.publishEvents(ctx, order.MerchantID, enqueuedEvent(order, position, q.now()))
+	q.recordEnqueueEstimates(ctx, cfg, order.MerchantID, []string{order.OrderID})
+	return ticket, nil
 }
 
-// getMerchantStats 获取商家历史统计数据
-func (q *QueueSystem) getMerchantStats(ctx context.Context, statsKey string) (avgItemTime time.Duration, processedOrders int64, err error) {
-	results, err := q.client.HMGet(ctx, statsKey, itemProcessTimeKey, orderCountKey).Result()
+// enqueueRequest 填充订单默认值并生成入队请求
+func (q *QueueSystem) enqueueRequest(cfg MerchantConfig, order *OrderInfo) (EnqueueRequest, error) {
+	now := q.now()
+	if order.Timestamp == 0 {
+		order.Timestamp = now.UnixNano()
+	}
+	if order.EnqueueTime.IsZero() {
+		order.EnqueueTime = now
+	}
+	order.Lane = orderLane(*order)
+	stations, err := order.stationList()
 	if err != nil {
-		return 0, 0, err
+		return EnqueueRequest{}, err
 	}
-
-	// 解析平均每商品处理时间(毫秒)
-	if results[0] != nil {
-		itemTimeMs, _ := strconv.ParseInt(results[0].(string), 10, 64)
-		avgItemTime = time.Duration(itemTimeMs) * time.Millisecond
+	if order.NumOfItems == 0 {
+		for _, n := range order.Stations {
+			order.NumOfItems += n
+		}
 	}
 
-	// 解析已处理订单数
-	if results[1] != nil {
-		processedOrders, _ = strconv.ParseInt(results[1].(string), 10, 64)
+	req := EnqueueRequest{
+		Day:      q.currentDay(cfg),
+		Order:    *order,
+		Score:    laneScore(order.Timestamp, cfg.laneWeight(order.Lane)),
+		Stations: stations,
+		Now:      now,
 	}
-
-	return avgItemTime, processedOrders, nil
-}
-
-// CompleteOrder 订单完成处理，更新统计数据
-func (q *QueueSystem) CompleteOrder(ctx context.Context, orderID string) error {
-	// 先获取订单信息
-	_, _, info, err := q.GetOrderPosition(ctx, orderID)
-	if err != nil {
-		return fmt.Errorf("failed to get order info: %v", err)
+	// 未指定取餐号时由存储按前缀原子分配
+	if order.Ticket == "" {
+		req.TicketPrefix = cfg.ticketPrefix(*order)
 	}
+	return req, nil
+}
 
-	// 从队列中移除
-	if err := q.DequeueOrder(ctx, orderID); err != nil {
-		return fmt.Errorf("failed to dequeue order: %v", err)
+// enqueuedEvent 生成入队事件，position 为入队后的位置
+func enqueuedEvent(order OrderInfo, position int64, at time.Time) QueueEvent {
+	return QueueEvent{
+		Type:       EventEnqueued,
+		MerchantID: order.MerchantID,
+		OrderID:    order.OrderID,
+		State:      StateQueued,
+		Position:   position,
+		Time:       at.UnixMilli(),
 	}
+}
 
-	// 计算处理时间
-	processDuration := time.Since(info.EnqueueTime)
-
-	// 更新商家统计数据
-	return q.updateMerchantStats(ctx, info.MerchantID, info.NumOfItems, processDuration)
+// GetMerchantOrderPosition 获取商家订单在队列中的位置及预估等待时间
+// 预估时间包含之后可能从高优先通道插队到前面的订单
+func (q *QueueSystem) GetMerchantOrderPosition(ctx context.Context, merchantID, orderID string) (position int64, waitTime time.Duration, info *OrderInfo, err error) {
+	position, estimate, info, err := q.orderWait(ctx, merchantID, orderID)
+	return position, estimate.Expected, info, err
 }
 
-// updateMerchantStats 更新商家统计数据
-func (q *QueueSystem) updateMerchantStats(ctx context.Context, merchantID string, numOfItems int, processDuration time.Duration) error {
-	statsKey := q.getStatsKey(merchantID)
+// GetOrderWaitEstimate 获取订单的预估等待时间及其P90
+func (q *QueueSystem) GetOrderWaitEstimate(ctx context.Context, merchantID, orderID string) (WaitEstimate, error) {
+	_, estimate, _, err := q.orderWait(ctx, merchantID, orderID)
+	return estimate, err
+}
 
-	// 获取当前统计数据
-	avgItemTime, processedOrders, err := q.getMerchantStats(ctx, statsKey)
+// orderWait 获取订单在队列中的位置及预估等待时间
+func (q *QueueSystem) orderWait(ctx context.Context, merchantID, orderID string) (int64, WaitEstimate, *OrderInfo, error) {
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
 	if err != nil {
-		return err
+		return 0, WaitEstimate{}, nil, err
 	}
 
-	// 计算每商品平均处理时间(毫秒)
-	itemTime := processDuration / time.Duration(numOfItems)
-
-	// 更新平均值(加权平均)
-	var newAvgItemTime time.Duration
-	if processedOrders == 0 {
-		newAvgItemTime = itemTime
-	} else {
-		// 新平均值 = (旧平均值 × 旧数量 + 新值) / (旧数量 + 1)
-		total := avgItemTime*time.Duration(processedOrders) + itemTime
-		newAvgItemTime = total / time.Duration(processedOrders+1)
+	day, err := q.locateOrder(ctx, merchantID, cfg, orderID)
+	if err != nil {
+		return 0, WaitEstimate{}, nil, err
 	}
-
-	// 保存更新后的数据
-	_, err = q.client.HSet(ctx, statsKey,
-		itemProcessTimeKey, fmt.Sprintf("%d", newAvgItemTime.Milliseconds()),
-		orderCountKey, fmt.Sprintf("%d", processedOrders+1),
-	).Result()
-
-	// 设置过期时间
-	q.client.Expire(ctx, statsKey, 30*24*time.Hour) // 保留30天统计数据
-
-	return err
+	return q.orderWaitInDay(ctx, merchantID, cfg, day, orderID)
 }
 
-// parseOrderInfo 解析订单信息(增强版)
-func parseOrderInfo(s string) (*OrderInfo, error) {
-	parts := strings.Split(s, ":")
-	if len(parts) < 4 {
-		return nil, fmt.Errorf("invalid order info format")
+// orderWaitInDay 获取某营业日订单在队列中的位置及预估等待时间
+func (q *QueueSystem) orderWaitInDay(ctx context.Context, merchantID string, cfg MerchantConfig, day, orderID string) (int64, WaitEstimate, *OrderInfo, error) {
+	position, info, err := q.store.QueuePosition(ctx, merchantID, day, orderID)
+	if err != nil {
+		return 0, WaitEstimate{}, nil, err
 	}
 
-	// The merchant ID might contain colons, so we need to handle that
-	// The last 3 parts are orderID, numOfItems, enqueueTime
-	// Everything before that is merchantID
-	merchantID := strings.Join(parts[:len(parts)-3], ":")
-	orderID := parts[len(parts)-3]
+	// 只读取排在前面的订单
+	var preceding []int
+	if position > 0 {
+		preceding, err = q.queueItems(ctx, merchantID, day, 0, position-1)
+		if err != nil {
+			return position, WaitEstimate{}, info, err
+		}
+	}
 
-	numOfItems, err := strconv.Atoi(parts[len(parts)-2])
+	// 计算预估等待时间
+	data, err := q.loadEstimateData(ctx, merchantID, day)
 	if err != nil {
-		return nil, fmt.Errorf("invalid numOfItems: %v", err)
+		return position, WaitEstimate{}, info, err
 	}
-
-	enqueueTimeUnix, err := strconv.ParseInt(parts[len(parts)-1], 10, 64)
+	estimate, err := q.estimateWithOvertakes(ctx, merchantID, cfg, data, orderLane(*info), info.EnqueueTime, preceding, info.NumOfItems, true)
 	if err != nil {
-		return nil, fmt.Errorf("invalid timestamp: %v", err)
+		return position, WaitEstimate{}, info, fmt.Errorf("failed to calculate wait time: %v", err)
 	}
 
-	return &OrderInfo{
-		MerchantID:  merchantID,
-		OrderID:     orderID,
-		NumOfItems:  numOfItems,
-		EnqueueTime: time.Unix(enqueueTimeUnix, 0),
-	}, nil
+	return position, estimate, info, nil
 }
 
-// DequeueOrder 保留原有方法(GetMerchantQueueStatus, DequeueOrder等)...
-// DequeueOrder 将订单从队列中移除
-func (q *QueueSystem) DequeueOrder(ctx context.Context, orderID string) error {
-	queueKey := q.getQueueKey()
-
-	// 先找到订单
-	orders, err := q.client.ZRange(ctx, queueKey, 0, -1).Result()
+// queueItems 按队列顺序获取区间内各订单的商品数
+func (q *QueueSystem) queueItems(ctx context.Context, merchantID, day string, start, stop int64) ([]int, error) {
+	orders, err := q.store.QueueOrders(ctx, merchantID, day, start, stop)
 	if err != nil {
-		return fmt.Errorf("failed to get queue: %v", err)
+		return nil, err
 	}
 
-	var target string
-	for _, order := range orders {
-		info, err := parseOrderInfo(order)
-		if err != nil {
-			continue
-		}
-
-		if info.OrderID == orderID {
-			target = order
-			break
-		}
-	}
-
-	if target == "" {
-		return fmt.Errorf("order not found")
+	items := make([]int, len(orders))
+	for i, order := range orders {
+		items[i] = order.NumOfItems
 	}
+	return items, nil
+}
 
-	// 从有序集合中移除
-	if err := q.client.ZRem(ctx, queueKey, target).Err(); err != nil {
-		return fmt.Errorf("failed to dequeue order: %v", err)
-	}
+// CompleteMerchantOrder 商家订单出餐完成，移出队列进入待取餐状态并更新统计数据
+// 重复完成返回 ErrOrderAlreadyCompleted，不会重复计入统计
+func (q *QueueSystem) CompleteMerchantOrder(ctx context.Context, merchantID, orderID string) error {
+	return q.TransitionOrder(ctx, merchantID, orderID, StateReady)
+}
 
-	return nil
+// DequeueMerchantOrder 将商家的订单从队列中移除，等同于 CancelOrder
+// 重复出队返回 ErrOrderAlreadyDequeued
+func (q *QueueSystem) DequeueMerchantOrder(ctx context.Context, merchantID, orderID string) error {
+	return q.CancelOrder(ctx, merchantID, orderID)
 }
 
 // GetMerchantQueueStatus 获取商家的队列状态
 func (q *QueueSystem) GetMerchantQueueStatus(ctx context.Context, merchantID string) (int, int, error) {
-	queueKey := q.getQueueKey()
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return 0, 0, err
+	}
 
-	// 获取所有订单
-	orders, err := q.client.ZRange(ctx, queueKey, 0, -1).Result()
+	items, err := q.queueItems(ctx, merchantID, q.currentDay(cfg), 0, -1)
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to get queue: %v", err)
+		return 0, 0, err
 	}
 
-	var count int
 	var totalItems int
-
-	for _, order := range orders {
-		info, err := parseOrderInfo(order)
-		if err != nil {
-			continue
-		}
-
-		if info.MerchantID == merchantID {
-			count++
-			totalItems += info.NumOfItems
-		}
+	for _, n := range items {
+		totalItems += n
 	}
 
-	return count, totalItems, nil
+	return len(items), totalItems, nil
 }
 
 // GetMerchantQueueStatusWithEstimate 获取商家队列状态及新订单预估等待时间
 func (q *QueueSystem) GetMerchantQueueStatusWithEstimate(ctx context.Context, merchantID string, newOrderItems int) (orderCount int, totalItems int, estimatedWait time.Duration, err error) {
-	queueKey := q.getQueueKey()
-
-	// 获取当前队列中该商家的所有订单
-	orders, err := q.client.ZRange(ctx, queueKey, 0, -1).Result()
-	if err != nil {
-		return 0, 0, 0, fmt.Errorf("failed to get queue: %v", err)
-	}
+	orderCount, totalItems, estimate, err := q.newOrderWait(ctx, merchantID, newOrderItems)
+	return orderCount, totalItems, estimate.Expected, err
+}
 
-	// 统计当前队列状态
-	for _, order := range orders {
-		info, err := parseOrderInfo(order)
-		if err != nil {
-			continue
-		}
+// EstimateNewOrderWait 预估新订单的等待时间及其P90
+func (q *QueueSystem) EstimateNewOrderWait(ctx context.Context, merchantID string, newOrderItems int) (WaitEstimate, error) {
+	_, _, estimate, err := q.newOrderWait(ctx, merchantID, newOrderItems)
+	return estimate, err
+}
 
-		if info.MerchantID == merchantID {
-			orderCount++
-			totalItems += info.NumOfItems
-		}
+// newOrderWait 统计当前队列状态并预估新订单等待时间
+// 新订单按普通通道排在最后，并计入之后可能插队的订单
+func (q *QueueSystem) newOrderWait(ctx context.Context, merchantID string, newOrderItems int) (orderCount int, totalItems int, estimate WaitEstimate, err error) {
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return 0, 0, WaitEstimate{}, err
 	}
+	day := q.currentDay(cfg)
 
-	// 计算预估等待时间
-	estimatedWait, err = q.estimateNewOrderWaitTime(ctx, merchantID, totalItems, orderCount, newOrderItems)
+	items, err := q.queueItems(ctx, merchantID, day, 0, -1)
 	if err != nil {
-		return orderCount, totalItems, 0, fmt.Errorf("failed to estimate wait time: %v", err)
+		return 0, 0, WaitEstimate{}, err
 	}
+	for _, n := range items {
+		totalItems += n
+	}
+	orderCount = len(items)
 
-	return orderCount, totalItems, estimatedWait, nil
-}
-
-// estimateNewOrderWaitTime 预估新订单等待时间
-func (q *QueueSystem) estimateNewOrderWaitTime(ctx context.Context, merchantID string, currentItems, currentOrders, newOrderItems int) (time.Duration, error) {
-	statsKey := q.getStatsKey(merchantID)
-
-	// 获取商家历史统计数据
-	avgItemTime, processedOrders, err := q.getMerchantStats(ctx, statsKey)
+	data, err := q.loadEstimateData(ctx, merchantID, day)
 	if err != nil {
-		return 0, err
+		return orderCount, totalItems, WaitEstimate{}, err
 	}
-
-	// 如果历史数据不足，使用默认值
-	if processedOrders < minProcessedOrders {
-		avgItemTime = defaultItemTime
+	estimate, err = q.estimateWithOvertakes(ctx, merchantID, cfg, data, LaneNormal, q.now(), items, newOrderItems, false)
+	if err != nil {
+		return orderCount, totalItems, WaitEstimate{}, fmt.Errorf("failed to estimate wait time: %v", err)
 	}
 
-	// 预估时间计算逻辑:
-	// 1. 当前队列中所有订单的处理时间
-	currentWait := time.Duration(currentItems)*avgItemTime + time.Duration(currentOrders)*baseProcessTime
-
-	// 2. 新订单本身的处理时间(按历史平均效率计算)
-	newOrderProcessTime := time.Duration(newOrderItems)*avgItemTime + baseProcessTime
-
-	// 3. 总预估时间 = 当前队列处理时间 + 新订单处理时间
-	// (这里假设新订单会排在最后)
-	totalWait := currentWait + newOrderProcessTime
-
-	// 增加20%缓冲时间(可根据实际情况调整)
-	totalWait = time.Duration(float64(totalWait) * 1.2)
-
-	return totalWait, nil
+	return orderCount, totalItems, estimate, nil
 }
@@ -0,0 +1,330 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestQueue 创建使用 miniredis 的队列系统
+func newTestQueue(t *testing.T, opts ...Option) (*QueueSystem, *miniredis.Miniredis) {
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewQueueSystem(client, opts...), m
+}
+
+func TestPerMerchantQueues(t *testing.T) {
+	ctx := context.Background()
+	q, m := newTestQueue(t)
+	orders := []OrderInfo{
+		{MerchantID: "m:1", OrderID: "o1", NumOfItems: 1},
+		{MerchantID: "m2", OrderID: "o2", NumOfItems: 4},
+		{MerchantID: "m:1", OrderID: "o3", NumOfItems: 2},
+	}
+	for _, order := range orders {
+		if err := q.EnqueueOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	day := q.currentDay(MerchantConfig{})
+	tests := []struct {
+		merchantID   string
+		orders, item int
+	}{
+		{"m:1", 2, 3},
+		{"m2", 1, 4},
+		{"m3", 0, 0},
+	}
+	for _, tt := range tests {
+		n, items, err := q.GetMerchantQueueStatus(ctx, tt.merchantID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != tt.orders || items != tt.item {
+			t.Errorf("%s: status = %d orders, %d items", tt.merchantID, n, items)
+		}
+		key := fmt.Sprintf("queue:{%s}:%s", tt.merchantID, day)
+		if members, _ := m.ZMembers(key); len(members) != tt.orders {
+			t.Errorf("%s: members of %s = %v", tt.merchantID, key, members)
+		}
+	}
+	if m.Exists("queue:" + day) {
+		t.Fatal("global daily queue written")
+	}
+
+	position, _, info, err := q.GetMerchantOrderPosition(ctx, "m:1", "o3")
+	if err != nil || position != 1 || info.MerchantID != "m:1" {
+		t.Fatalf("position of m:1/o3 = %d, %+v, %v", position, info, err)
+	}
+	if _, _, _, err := q.GetMerchantOrderPosition(ctx, "m2", "o1"); err == nil {
+		t.Fatal("found order of another merchant")
+	}
+}
+
+func TestLegacyOrderIDCalls(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+	for _, order := range []OrderInfo{
+		{MerchantID: "m1", OrderID: "o1", NumOfItems: 1, EnqueueTime: time.Now().Add(-3 * time.Minute)},
+		{MerchantID: "m2", OrderID: "o2", NumOfItems: 2},
+		{MerchantID: "m2", OrderID: "o3", NumOfItems: 1},
+	} {
+		if err := q.EnqueueOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	position, _, info, err := q.GetOrderPosition(ctx, "o3")
+	if err != nil || position != 1 || info.MerchantID != "m2" {
+		t.Fatalf("position of o3 = %d, %+v, %v", position, info, err)
+	}
+	if err := q.CompleteOrder(ctx, "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.DequeueOrder(ctx, "o2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := q.GetOrderPosition(ctx, "o2"); err == nil {
+		t.Fatal("dequeued order still found")
+	}
+	if n, _, _ := q.GetMerchantQueueStatus(ctx, "m1"); n != 0 {
+		t.Fatalf("m1 queue = %d", n)
+	}
+	if position, _, _, err := q.GetOrderPosition(ctx, "o3"); err != nil || position != 0 {
+		t.Fatalf("position of o3 = %d, %v", position, err)
+	}
+}
+
+func TestMigrateLegacyQueue(t *testing.T) {
+	ctx := context.Background()
+	q, m := newTestQueue(t)
+	for i, member := range []string{"m1:o1:1:1700000000", "m:2:o2:3:1700000001", "m1:o3:2:1700000002"} {
+		if _, err := m.ZAdd("queue:2026-03-02", float64(i), member); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := q.MigrateLegacyQueue(ctx, "2026-03-02")
+	if err != nil || n != 3 {
+		t.Fatalf("migrated = %d, %v", n, err)
+	}
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"queue:{m1}:2026-03-02", 2},
+		{"queue:{m:2}:2026-03-02", 1},
+	}
+	for _, tt := range tests {
+		if members, _ := m.ZMembers(tt.key); len(members) != tt.want {
+			t.Errorf("members of %s = %v", tt.key, members)
+		}
+	}
+	if m.Exists("queue:2026-03-02") {
+		t.Fatal("legacy queue not removed")
+	}
+	if n, err := q.MigrateLegacyQueue(ctx, "2026-03-02"); err != nil || n != 0 {
+		t.Fatalf("migrate again = %d, %v", n, err)
+	}
+}
+
+func TestOrderIndex(t *testing.T) {
+	ctx := context.Background()
+	q, m := newTestQueue(t)
+	for _, order := range []OrderInfo{
+		{MerchantID: "m1", OrderID: "o1", NumOfItems: 1},
+		{MerchantID: "m1", OrderID: "o2", NumOfItems: 2},
+		{MerchantID: "m2", OrderID: "o3", NumOfItems: 1},
+	} {
+		if err := q.EnqueueOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	day := q.currentDay(MerchantConfig{})
+	for _, id := range []string{"o1", "o2"} {
+		member := m.HGet("queue_index:{m1}:"+day, id)
+		if _, err := m.ZScore("queue:{m1}:"+day, member); err != nil {
+			t.Fatalf("index of %s = %q not in queue: %v", id, member, err)
+		}
+	}
+
+	tests := []struct {
+		orderID    string
+		merchantID string
+		position   int64
+		wantErr    bool
+	}{
+		{"o1", "m1", 0, false},
+		{"o2", "m1", 1, false},
+		{"o3", "m2", 0, false},
+		{"missing", "", 0, true},
+	}
+	for _, tt := range tests {
+		merchantID, err := q.GetOrderMerchant(ctx, tt.orderID)
+		if (err != nil) != tt.wantErr || merchantID != tt.merchantID {
+			t.Errorf("%s: merchant = %q, %v", tt.orderID, merchantID, err)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		position, _, info, err := q.GetMerchantOrderPosition(ctx, merchantID, tt.orderID)
+		if err != nil || position != tt.position || info.OrderID != tt.orderID {
+			t.Errorf("%s: position = %d, %+v, %v", tt.orderID, position, info, err)
+		}
+	}
+
+	// 出队后保留索引以便查询订单状态，清理全局索引
+	if err := q.DequeueMerchantOrder(ctx, "m1", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if m.HGet("queue_index:{m1}:"+day, "o1") == "" || m.Exists("order_merchant:o1") {
+		t.Fatal("unexpected index of dequeued order")
+	}
+	if position, _, _, err := q.GetMerchantOrderPosition(ctx, "m1", "o2"); err != nil || position != 0 {
+		t.Fatalf("position of o2 = %d, %v", position, err)
+	}
+
+	// 订单ID被其他商家复用时，出队不影响其全局索引
+	if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m2", OrderID: "o2", NumOfItems: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.DequeueMerchantOrder(ctx, "m1", "o2"); err != nil {
+		t.Fatal(err)
+	}
+	if merchantID, err := q.GetOrderMerchant(ctx, "o2"); err != nil || merchantID != "m2" {
+		t.Fatalf("merchant of o2 = %q, %v", merchantID, err)
+	}
+}
+
+func TestRebuildIndex(t *testing.T) {
+	ctx := context.Background()
+	q, m := newTestQueue(t)
+	for i, member := range []string{"m1:o1:1:1700000000", "m1:o2:3:1700000001"} {
+		if _, err := m.ZAdd("queue:{m1}:2026-03-02", float64(i), member); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.HSet("queue_index:{m1}:2026-03-02", "done", "m1:done:1:1700000000")
+
+	// 已出队订单的索引保留，以便查询其状态
+	n, err := q.RebuildIndex(ctx, "m1", "2026-03-02")
+	if err != nil || n != 2 {
+		t.Fatalf("rebuilt = %d, %v", n, err)
+	}
+	if keys, _ := m.HKeys("queue_index:{m1}:2026-03-02"); len(keys) != 3 {
+		t.Fatalf("index = %v", keys)
+	}
+	if merchantID, err := q.GetOrderMerchant(ctx, "o2"); err != nil || merchantID != "m1" {
+		t.Fatalf("merchant of o2 = %q, %v", merchantID, err)
+	}
+}
+
+func TestScriptResult(t *testing.T) {
+	tests := []struct {
+		res     []interface{}
+		target  OrderState
+		wantErr error
+	}{
+		{[]interface{}{int64(resultOK), "queued"}, StateReady, nil},
+		{[]interface{}{int64(resultNotFound), ""}, StateReady, ErrOrderNotFound},
+		{[]interface{}{int64(resultConflict), "queued"}, StateQueued, ErrOrderAlreadyQueued},
+		{[]interface{}{int64(resultConflict), "ready"}, StateReady, ErrOrderAlreadyCompleted},
+		{[]interface{}{int64(resultConflict), "cancelled"}, StateReady, ErrOrderAlreadyDequeued},
+	}
+	for _, tt := range tests {
+		if err := scriptResult(tt.res, tt.target); !errors.Is(err, tt.wantErr) {
+			t.Errorf("scriptResult(%v, %s) = %v, want %v", tt.res, tt.target, err, tt.wantErr)
+		}
+	}
+	if err := scriptResult([]interface{}{int64(resultOK)}, StateReady); err == nil {
+		t.Error("short result accepted")
+	}
+}
+
+func TestAtomicEnqueueComplete(t *testing.T) {
+	ctx := context.Background()
+	q, m := newTestQueue(t)
+	const workers = 20
+
+	run := func(fn func() error) []error {
+		errs := make([]error, workers)
+		var wg sync.WaitGroup
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = fn()
+			}(i)
+		}
+		wg.Wait()
+		return errs
+	}
+	order := OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 2, EnqueueTime: time.Now().Add(-4 * time.Minute)}
+	tests := []struct {
+		name    string
+		fn      func() error
+		wantOK  int
+		wantErr error
+	}{
+		{"enqueue", func() error { return q.EnqueueOrder(ctx, order) }, 1, ErrOrderAlreadyQueued},
+		{"complete", func() error { return q.CompleteMerchantOrder(ctx, "m1", "o1") }, 1, ErrOrderAlreadyCompleted},
+		{"enqueue completed order", func() error { return q.EnqueueOrder(ctx, order) }, 0, ErrOrderAlreadyCompleted},
+	}
+	for _, tt := range tests {
+		var ok int
+		for _, err := range run(tt.fn) {
+			switch {
+			case err == nil:
+				ok++
+			case !errors.Is(err, tt.wantErr):
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		if ok != tt.wantOK {
+			t.Fatalf("%s succeeded %d times", tt.name, ok)
+		}
+	}
+
+	stats, err := q.GetMerchantStats(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.ProcessedOrders != 1 || stats.AvgItemTime < 119*time.Second || stats.EWMAItemTime < 119*time.Second {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if m.Exists("order_merchant:o1") {
+		t.Fatal("merchant lookup of completed order not removed")
+	}
+}
+
+func TestDequeueOrder(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+	if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 1}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		fn      func() error
+		wantErr error
+	}{
+		{"dequeue", func() error { return q.DequeueMerchantOrder(ctx, "m1", "o1") }, nil},
+		{"dequeue again", func() error { return q.DequeueMerchantOrder(ctx, "m1", "o1") }, ErrOrderAlreadyDequeued},
+		{"complete dequeued", func() error { return q.CompleteMerchantOrder(ctx, "m1", "o1") }, ErrOrderAlreadyDequeued},
+		{"missing", func() error { return q.DequeueMerchantOrder(ctx, "m1", "missing") }, ErrOrderNotFound},
+		{"legacy missing", func() error { return q.DequeueOrder(ctx, "missing") }, ErrOrderNotFound},
+	}
+	for _, tt := range tests {
+		if err := tt.fn(); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
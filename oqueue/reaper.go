@@ -0,0 +1,126 @@
+package oqueue
+
+import (
+	"context"
+	"github.com/open4go/log"
+	"time"
+)
+
+const (
+	defaultStaleAfter   = 2 * time.Hour // 默认超过该时长未完成的订单视为过期
+	defaultReapInterval = time.Minute   // 默认后台清理间隔
+)
+
+// staleAfter 获取商家订单的过期时长，小于等于0表示不清理
+func (c MerchantConfig) staleAfter() time.Duration {
+	if c.StaleAfter == 0 {
+		return defaultStaleAfter
+	}
+	return c.StaleAfter
+}
+
+// ReapStaleOrders 将商家排队或制作超过 StaleAfter 仍未完成的订单标记为过期，返回过期的订单ID
+// 过期订单移出队列并发布 expired 事件，不计入商家处理时间统计，之后也不能再完成
+func (q *QueueSystem) ReapStaleOrders(ctx context.Context, merchantID string) ([]string, error) {
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	staleAfter := cfg.staleAfter()
+	if staleAfter <= 0 {
+		return nil, nil
+	}
+
+	cutoff := q.now().Add(-staleAfter)
+	days := make(map[string]string)
+	var orderIDs []string
+	for _, day := range []string{q.previousDay(cfg), q.currentDay(cfg)} {
+		for _, state := range []OrderState{StateQueued, StatePreparing} {
+			ids, err := q.store.StateOrders(ctx, merchantID, day, state, cutoff)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range ids {
+				if _, ok := days[id]; !ok {
+					days[id] = day
+					orderIDs = append(orderIDs, id)
+				}
+			}
+		}
+	}
+	if len(orderIDs) == 0 {
+		return nil, nil
+	}
+
+	results, err := q.transitionBatch(ctx, merchantID, cfg, orderIDs, days, StateExpired)
+	if err != nil {
+		return nil, err
+	}
+
+	// 期间被完成或取消的订单会流转失败，跳过即可
+	expired := make([]string, 0, len(results))
+	for _, result := range results {
+		if result.Err == nil {
+			expired = append(expired, result.OrderID)
+		}
+	}
+	return expired, nil
+}
+
+// markActive 记录商家最近的入队时间，供后台清理遍历，失败只记录日志
+func (q *QueueSystem) markActive(ctx context.Context, merchantIDs ...string) {
+	if err := q.store.MarkActive(ctx, merchantIDs, q.now()); err != nil {
+		log.Log(ctx).Error(err)
+	}
+}
+
+// ActiveMerchants 获取最近 defaultExpiration 内有订单入队的商家
+func (q *QueueSystem) ActiveMerchants(ctx context.Context) ([]string, error) {
+	return q.store.ActiveMerchants(ctx, q.now().Add(-defaultExpiration))
+}
+
+// StartReaper 启动后台清理协程，每隔 interval 清理所有活跃商家的过期订单，ctx 取消时退出
+// 定时器取自 WithClock 注入的时钟
+// interval 小于等于0时使用 defaultReapInterval
+func (q *QueueSystem) StartReaper(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultReapInterval
+	}
+	ticker := q.clock.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Log(ctx).Info("[oqueue] reaper stopped")
+				return
+			case <-ticker.C():
+				q.reapAll(ctx)
+			}
+		}
+	}()
+}
+
+// reapAll 清理所有活跃商家的过期订单，单个商家失败不影响其他商家
+func (q *QueueSystem) reapAll(ctx context.Context) {
+	merchants, err := q.ActiveMerchants(ctx)
+	if err != nil {
+		log.Log(ctx).Error(err)
+		return
+	}
+
+	for _, merchantID := range merchants {
+		if ctx.Err() != nil {
+			return
+		}
+		expired, err := q.ReapStaleOrders(ctx, merchantID)
+		if err != nil {
+			log.Log(ctx).WithField("merchant", merchantID).Error(err)
+			continue
+		}
+		if len(expired) > 0 {
+			log.Log(ctx).WithField("merchant", merchantID).Infof("[oqueue] expired %d stale orders", len(expired))
+		}
+	}
+}
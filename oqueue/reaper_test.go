@@ -0,0 +1,106 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"testing"
+	"time"
+)
+
+// backdate 将订单进入当前状态的时间提前 d
+func backdate(t *testing.T, q *QueueSystem, m *miniredis.Miniredis, merchantID, orderID string, state OrderState, d time.Duration) {
+	t.Helper()
+	rs := q.store.(*RedisStore)
+	key := rs.getStateKey(merchantID, q.currentDay(MerchantConfig{}), state)
+	if _, err := m.ZAdd(key, float64(time.Now().Add(-d).UnixMilli()), orderID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaleAfter(t *testing.T) {
+	tests := []struct {
+		cfg  MerchantConfig
+		want time.Duration
+	}{
+		{MerchantConfig{}, defaultStaleAfter},
+		{MerchantConfig{StaleAfter: 30 * time.Minute}, 30 * time.Minute},
+		{MerchantConfig{StaleAfter: -1}, -1},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.staleAfter(); got != tt.want {
+			t.Errorf("staleAfter(%v) = %v, want %v", tt.cfg.StaleAfter, got, tt.want)
+		}
+	}
+}
+
+func TestReapStaleOrders(t *testing.T) {
+	ctx := context.Background()
+	q, m := newTestQueue(t)
+	if err := q.SetMerchantConfig(ctx, "m1", MerchantConfig{StaleAfter: 30 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.SetMerchantConfig(ctx, "m3", MerchantConfig{StaleAfter: -1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, order := range []OrderInfo{
+		{MerchantID: "m1", OrderID: "old", NumOfItems: 1},
+		{MerchantID: "m1", OrderID: "prep", NumOfItems: 1},
+		{MerchantID: "m1", OrderID: "new", NumOfItems: 1},
+		{MerchantID: "m2", OrderID: "keep", NumOfItems: 1},
+		{MerchantID: "m3", OrderID: "never", NumOfItems: 1},
+	} {
+		if err := q.EnqueueOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.StartPreparing(ctx, "m1", "prep"); err != nil {
+		t.Fatal(err)
+	}
+	backdate(t, q, m, "m1", "old", StateQueued, 31*time.Minute)
+	backdate(t, q, m, "m1", "prep", StatePreparing, 31*time.Minute)
+	backdate(t, q, m, "m2", "keep", StateQueued, 31*time.Minute)
+	backdate(t, q, m, "m3", "never", StateQueued, 3*time.Hour)
+
+	merchants, err := q.ActiveMerchants(ctx)
+	if err != nil || len(merchants) != 3 {
+		t.Fatalf("active merchants = %v, %v", merchants, err)
+	}
+
+	q.reapAll(ctx)
+
+	tests := []struct {
+		merchantID, orderID string
+		want                OrderState
+	}{
+		{"m1", "old", StateExpired},
+		{"m1", "prep", StateExpired},
+		{"m1", "new", StateQueued},
+		{"m2", "keep", StateQueued},
+		{"m3", "never", StateQueued},
+	}
+	for _, tt := range tests {
+		record, err := q.GetOrderRecord(ctx, tt.merchantID, tt.orderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.State != tt.want {
+			t.Errorf("%s/%s state = %s, want %s", tt.merchantID, tt.orderID, record.State, tt.want)
+		}
+	}
+	if err := q.CompleteMerchantOrder(ctx, "m1", "old"); !errors.Is(err, ErrOrderAlreadyDequeued) {
+		t.Fatalf("complete expired order: %v", err)
+	}
+	if m.Exists("order_merchant:old") {
+		t.Fatal("expired order merchant lookup not released")
+	}
+}
+
+func TestStartReaperDefaultInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q, _ := newTestQueue(t)
+	for _, interval := range []time.Duration{0, -time.Second} {
+		q.StartReaper(ctx, interval)
+	}
+}
@@ -0,0 +1,234 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+const (
+	heldScoreField = "held_score" // 暂缓前的队列分数
+	heldAtField    = "held_at"    // 暂缓时间(毫秒)
+)
+
+var (
+	// ErrOrderNotQueued 订单不在排队中，制作中及已离开队列的订单不能调整顺序
+	ErrOrderNotQueued = errors.New("order not queued")
+	// ErrOrderHeld 订单已暂缓，需先恢复
+	ErrOrderHeld = errors.New("order is held")
+	// ErrOrderNotHeld 订单未暂缓
+	ErrOrderNotHeld = errors.New("order is not held")
+	// ErrNoRoom 相邻订单入队时间过近，无法插入两者之间
+	ErrNoRoom = errors.New("no room to move order")
+)
+
+// MoveAction 人工调整顺序的操作
+type MoveAction string
+
+const (
+	MoveActionFront   MoveAction = "front"   // 移到队首
+	MoveActionBefore  MoveAction = "before"  // 移到另一订单之前
+	MoveActionDefer   MoveAction = "defer"   // 延后一段时间
+	MoveActionHold    MoveAction = "hold"    // 暂缓，排到所有订单之后
+	MoveActionRelease MoveAction = "release" // 恢复暂缓前的位置
+)
+
+// MoveRecord 人工调整顺序的审计记录
+type MoveRecord struct {
+	Action     MoveAction `json:"action"`
+	OrderID    string     `json:"order_id"`
+	OtherID    string     `json:"other_id,omitempty"`    // MoveBefore 的参照订单
+	DeferredMs int64      `json:"deferred_ms,omitempty"` // Defer 延后的时长(毫秒)
+	Operator   string     `json:"operator"`
+	From       int64      `json:"from"` // 调整前在队列中的位置
+	To         int64      `json:"to"`   // 调整后在队列中的位置
+	Time       int64      `json:"time"` // 操作时间(毫秒)
+}
+
+// reorderScript 原子地调整订单的队列分数并记录审计
+// 只有排队中的订单可以调整；暂缓时保存原分数并加上一个足够大的偏移，恢复时还原
+// 插到另一订单之前时取与前一订单分数的中点，使其他订单的相对顺序不变
+// 订单拆分到工位时同步更新各工位队列中尚未完成的小票分数，使工位顺序与主队列一致
+// KEYS: queue, index, order, moves, 参照订单(无参照订单时同 order), 之后为订单的各工位队列
+// ARGV: orderID, action, otherID, 延后时长(毫秒), operator, now(毫秒), ttl(秒)
+var reorderScript = redis.NewScript(`
+local member = redis.call('HGET', KEYS[2], ARGV[1])
+if not member then
+	return {1, ''}
+end
+local state = redis.call('HGET', KEYS[3], 'state') or 'queued'
+if state ~= 'queued' then
+	return {2, state}
+end
+local score = redis.call('ZSCORE', KEYS[1], member)
+if not score then
+	return {1, state}
+end
+score = tonumber(score)
+
+local action = ARGV[2]
+local held = redis.call('HGET', KEYS[3], 'held_score')
+if action == 'release' then
+	if not held then
+		return {5, state}
+	end
+elseif held then
+	return {4, state}
+end
+
+local from = redis.call('ZRANK', KEYS[1], member)
+if action == 'front' then
+	local first = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	if first[1] ~= member then
+		score = tonumber(first[2]) - 1000000
+	end
+elseif action == 'before' then
+	local other = redis.call('HGET', KEYS[2], ARGV[3])
+	local otherScore = other and redis.call('ZSCORE', KEYS[1], other)
+	if not otherScore then
+		return {1, state}
+	end
+	if redis.call('HEXISTS', KEYS[5], 'held_score') == 1 then
+		return {4, state}
+	end
+	otherScore = tonumber(otherScore)
+	local rank = redis.call('ZRANK', KEYS[1], other)
+	if rank == 0 then
+		score = otherScore - 1000000
+	else
+		local prev = redis.call('ZRANGE', KEYS[1], rank - 1, rank - 1, 'WITHSCORES')
+		if prev[1] ~= member then
+			local prevScore = tonumber(prev[2])
+			score = (prevScore + otherScore) / 2
+			if score <= prevScore or score >= otherScore then
+				return {6, state}
+			end
+		end
+	end
+elseif action == 'defer' then
+	score = score + tonumber(ARGV[4]) * 1000000
+elseif action == 'hold' then
+	redis.call('HSET', KEYS[3], 'held_score', string.format('%.17g', score), 'held_at', ARGV[6])
+	score = score + 1e18
+elseif action == 'release' then
+	score = tonumber(held)
+	redis.call('HDEL', KEYS[3], 'held_score', 'held_at')
+end
+
+redis.call('ZADD', KEYS[1], 'XX', string.format('%.17g', score), member)
+for i = 6, #KEYS do
+	redis.call('ZADD', KEYS[i], 'XX', string.format('%.17g', score), ARGV[1])
+end
+local to = redis.call('ZRANK', KEYS[1], member)
+redis.call('RPUSH', KEYS[4], cjson.encode({
+	action = action,
+	order_id = ARGV[1],
+	other_id = ARGV[3],
+	deferred_ms = tonumber(ARGV[4]),
+	operator = ARGV[5],
+	from = from,
+	to = to,
+	time = tonumber(ARGV[6]),
+}))
+redis.call('EXPIRE', KEYS[4], ARGV[7])
+return {0, state}
+`)
+
+// MoveToFront 将订单移到队首，如投诉或重做的订单
+func (q *QueueSystem) MoveToFront(ctx context.Context, merchantID, orderID, operator string) error {
+	return q.reorder(ctx, merchantID, orderID, MoveActionFront, "", 0, operator)
+}
+
+// MoveBefore 将订单移到另一订单之前，两者须在同一营业日的队列中
+func (q *QueueSystem) MoveBefore(ctx context.Context, merchantID, orderID, otherID, operator string) error {
+	if orderID == otherID {
+		return fmt.Errorf("cannot move order before itself: %s", orderID)
+	}
+	return q.reorder(ctx, merchantID, orderID, MoveActionBefore, otherID, 0, operator)
+}
+
+// Defer 将订单延后，相当于晚 d 入队
+func (q *QueueSystem) Defer(ctx context.Context, merchantID, orderID string, d time.Duration, operator string) error {
+	if d < time.Millisecond {
+		return fmt.Errorf("invalid defer duration: %v", d)
+	}
+	return q.reorder(ctx, merchantID, orderID, MoveActionDefer, "", d, operator)
+}
+
+// Hold 暂缓订单，如等待原料，订单排到所有未暂缓的订单之后
+// 暂缓的订单仍处于排队中，可正常取消或完成；Release 后恢复原来的位置
+func (q *QueueSystem) Hold(ctx context.Context, merchantID, orderID, operator string) error {
+	return q.reorder(ctx, merchantID, orderID, MoveActionHold, "", 0, operator)
+}
+
+// Release 恢复暂缓的订单，按原入队顺序排回队列
+func (q *QueueSystem) Release(ctx context.Context, merchantID, orderID, operator string) error {
+	return q.reorder(ctx, merchantID, orderID, MoveActionRelease, "", 0, operator)
+}
+
+// reorder 调整订单顺序并发布 reordered 事件
+func (q *QueueSystem) reorder(ctx context.Context, merchantID, orderID string, action MoveAction, otherID string, d time.Duration, operator string) error {
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return err
+	}
+	day, err := q.locateOrder(ctx, merchantID, cfg, orderID)
+	if err != nil {
+		return err
+	}
+
+	err = q.store.Reorder(ctx, ReorderRequest{
+		MerchantID: merchantID,
+		Day:        day,
+		OrderID:    orderID,
+		Action:     action,
+		OtherID:    otherID,
+		Defer:      d,
+		Operator:   operator,
+		Now:        q.now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	q.publishEvents(ctx, merchantID, QueueEvent{
+		Type:       EventReordered,
+		MerchantID: merchantID,
+		OrderID:    orderID,
+		State:      StateQueued,
+		Time:       q.now().UnixMilli(),
+	})
+	return nil
+}
+
+// reorderResult 将调整顺序脚本的返回值转换为错误
+func reorderResult(res []interface{}) error {
+	if len(res) < 2 {
+		return errors.New("unexpected script result")
+	}
+	code, _ := res[0].(int64)
+
+	switch code {
+	case resultOK:
+		return nil
+	case resultNotFound:
+		return ErrOrderNotFound
+	case resultConflict:
+		return ErrOrderNotQueued
+	case resultHeld:
+		return ErrOrderHeld
+	case resultNotHeld:
+		return ErrOrderNotHeld
+	case resultNoRoom:
+		return ErrNoRoom
+	default:
+		return errors.New("unknown script result")
+	}
+}
+
+// GetMoveRecords 获取商家某营业日(2006-01-02)人工调整顺序的审计记录，按操作先后排列
+func (q *QueueSystem) GetMoveRecords(ctx context.Context, merchantID, day string) ([]MoveRecord, error) {
+	return q.store.MoveRecords(ctx, merchantID, day)
+}
@@ -0,0 +1,110 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReorderResult(t *testing.T) {
+	tests := []struct {
+		code int64
+		want error
+	}{
+		{resultOK, nil},
+		{resultNotFound, ErrOrderNotFound},
+		{resultConflict, ErrOrderNotQueued},
+		{resultHeld, ErrOrderHeld},
+		{resultNotHeld, ErrOrderNotHeld},
+		{resultNoRoom, ErrNoRoom},
+	}
+	for _, tt := range tests {
+		if err := reorderResult([]interface{}{tt.code, "queued"}); !errors.Is(err, tt.want) {
+			t.Errorf("reorderResult(%d) = %v, want %v", tt.code, err, tt.want)
+		}
+	}
+}
+
+func TestReorder(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+	day := q.currentDay(MerchantConfig{})
+	rs := q.store.(*RedisStore)
+	for _, id := range []string{"o1", "o2", "o3", "o4"} {
+		if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: id, NumOfItems: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	queue := func() string {
+		members, err := rs.client.ZRange(ctx, rs.getQueueKey("m1", day), 0, -1).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]string, len(members))
+		for i, member := range members {
+			info, err := parseOrderInfo(member)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids[i] = info.OrderID
+		}
+		return strings.Join(ids, ",")
+	}
+
+	tests := []struct {
+		name    string
+		op      func() error
+		wantErr error
+		want    string
+	}{
+		{"front", func() error { return q.MoveToFront(ctx, "m1", "o3", "alice") }, nil, "o3,o1,o2,o4"},
+		{"before", func() error { return q.MoveBefore(ctx, "m1", "o4", "o1", "bob") }, nil, "o3,o4,o1,o2"},
+		{"hold", func() error { return q.Hold(ctx, "m1", "o3", "bob") }, nil, "o4,o1,o2,o3"},
+		{"move held order", func() error { return q.MoveToFront(ctx, "m1", "o3", "bob") }, ErrOrderHeld, "o4,o1,o2,o3"},
+		{"release order not held", func() error { return q.Release(ctx, "m1", "o1", "bob") }, ErrOrderNotHeld, "o4,o1,o2,o3"},
+		{"defer", func() error { return q.Defer(ctx, "m1", "o4", time.Hour, "bob") }, nil, "o1,o2,o4,o3"},
+		{"release", func() error { return q.Release(ctx, "m1", "o3", "bob") }, nil, "o3,o1,o2,o4"},
+		{"missing", func() error { return q.MoveToFront(ctx, "m1", "missing", "bob") }, ErrOrderNotFound, "o3,o1,o2,o4"},
+	}
+	for _, tt := range tests {
+		if err := tt.op(); !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if got := queue(); got != tt.want {
+			t.Fatalf("%s: queue = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if err := q.StartPreparing(ctx, "m1", "o3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.MoveToFront(ctx, "m1", "o3", "bob"); !errors.Is(err, ErrOrderNotQueued) {
+		t.Fatalf("move preparing order: %v", err)
+	}
+	if err := q.MoveBefore(ctx, "m1", "o1", "o1", "bob"); err == nil {
+		t.Fatal("moved order before itself")
+	}
+	if err := q.Defer(ctx, "m1", "o1", 0, "bob"); err == nil {
+		t.Fatal("deferred by zero")
+	}
+
+	moves, err := q.GetMoveRecords(ctx, "m1", day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 5 {
+		t.Fatalf("moves = %+v", moves)
+	}
+	before := moves[1]
+	if before.Action != MoveActionBefore || before.OtherID != "o1" || before.Operator != "bob" || before.From != 3 || before.To != 1 {
+		t.Errorf("before = %+v", before)
+	}
+	if record, err := q.GetOrderRecord(ctx, "m1", "o3"); err != nil || record.Held {
+		t.Errorf("released record = %+v, %v", record, err)
+	}
+	if moves[3].Action != MoveActionDefer || moves[3].DeferredMs != time.Hour.Milliseconds() {
+		t.Errorf("defer = %+v", moves[3])
+	}
+}
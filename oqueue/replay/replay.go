@@ -0,0 +1,244 @@
+// Package replay 按虚拟时钟回放订单日志，对比预估等待时间与实际出餐时间，
+// 用于离线评估预估器及其参数的调整
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/open4go/p7/clock"
+	"github.com/open4go/p7/oqueue"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// EventType 订单日志事件类型
+type EventType string
+
+const (
+	EventEnqueue   EventType = "enqueue"   // 订单入队
+	EventPreparing EventType = "preparing" // 订单开始制作
+	EventComplete  EventType = "complete"  // 订单出餐
+	EventPickup    EventType = "pickup"    // 订单取餐
+	EventCancel    EventType = "cancel"    // 订单取消
+)
+
+// Event 订单日志中的一条事件，日志为每行一个JSON的格式
+// 如 {"type":"enqueue","time":"2026-10-01T12:00:00+08:00","merchant_id":"m1","order_id":"o1","num_of_items":2}
+type Event struct {
+	Type       EventType              `json:"type"`
+	Time       time.Time              `json:"time"`
+	MerchantID string                 `json:"merchant_id"`
+	OrderID    string                 `json:"order_id"`
+	NumOfItems int                    `json:"num_of_items,omitempty"` // 以下字段仅 enqueue 事件使用
+	Lane       oqueue.Lane            `json:"lane,omitempty"`
+	Channel    oqueue.Channel         `json:"channel,omitempty"`
+	Stations   map[oqueue.Station]int `json:"stations,omitempty"`
+}
+
+// ReadEvents 读取JSON行格式的订单日志，空行会被跳过
+func ReadEvents(r io.Reader) ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("invalid event at line %d: %v", line, err)
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events: %v", err)
+	}
+	return events, nil
+}
+
+// Config 回放配置
+type Config struct {
+	// Options 队列系统配置项，如 WithEstimator、WithLocation、WithBufferCalibration
+	// 时钟由回放设置，Options 中的 WithClock 会被覆盖
+	Options []oqueue.Option
+	// Merchants 商家队列配置，未配置的商家使用默认配置
+	Merchants map[string]oqueue.MerchantConfig
+}
+
+// OrderResult 单个订单的预估与实际结果
+type OrderResult struct {
+	MerchantID string        `json:"merchant_id"`
+	OrderID    string        `json:"order_id"`
+	NumOfItems int           `json:"num_of_items"`
+	EnqueuedAt time.Time     `json:"enqueued_at"`
+	Position   int64         `json:"position"`  // 入队时的位置
+	Predicted  time.Duration `json:"predicted"` // 入队时的预估等待时间
+	P90        time.Duration `json:"p90"`
+	Actual     time.Duration `json:"actual,omitempty"` // 入队到出餐的实际时间，未出餐为0
+	Completed  bool          `json:"completed"`
+}
+
+// Deviation 预估误差(预估-实际)，未出餐时为0
+func (r OrderResult) Deviation() time.Duration {
+	if !r.Completed {
+		return 0
+	}
+	return r.Predicted - r.Actual
+}
+
+// Summary 预估准确度汇总，只统计已出餐的订单
+type Summary struct {
+	Orders       int           `json:"orders"`         // 入队的订单数
+	Completed    int           `json:"completed"`      // 已出餐的订单数
+	MeanAbsError time.Duration `json:"mean_abs_error"` // 平均绝对误差
+	MeanError    time.Duration `json:"mean_error"`     // 平均误差，为正表示预估偏长
+	RMSE         time.Duration `json:"rmse"`           // 均方根误差
+	P90Coverage  float64       `json:"p90_coverage"`   // 实际时间不超过P90的比例，理想值约为0.9
+}
+
+// Failure 回放失败的事件，如重复入队或完成不存在的订单
+type Failure struct {
+	Index int    `json:"index"` // 事件在排序后日志中的下标
+	Event Event  `json:"event"`
+	Error string `json:"error"`
+}
+
+// Report 回放报告
+type Report struct {
+	Orders     []OrderResult      `json:"orders"` // 按入队顺序
+	Summary    Summary            `json:"summary"`
+	ByMerchant map[string]Summary `json:"by_merchant"`
+	Failures   []Failure          `json:"failures,omitempty"`
+}
+
+// Replay 按事件时间顺序回放订单日志
+// 使用内存存储与虚拟时钟，商家统计从空白开始随回放中的出餐逐步积累，与线上自学习的过程一致
+func Replay(ctx context.Context, events []Event, cfg Config) (*Report, error) {
+	events = append([]Event(nil), events...)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+
+	report := &Report{ByMerchant: make(map[string]Summary)}
+	if len(events) == 0 {
+		return report, nil
+	}
+
+	// 虚拟时钟随事件时间推进，事件已按时间排序，时间不会回退
+	virtual := clock.NewFake(events[0].Time)
+	opts := append(append([]oqueue.Option(nil), cfg.Options...), oqueue.WithClock(virtual))
+	q := oqueue.NewQueueSystemWithStore(oqueue.NewMemoryStore(), opts...)
+	for merchantID, mc := range cfg.Merchants {
+		if err := q.SetMerchantConfig(ctx, merchantID, mc); err != nil {
+			return nil, fmt.Errorf("invalid config for merchant %s: %v", merchantID, err)
+		}
+	}
+
+	index := make(map[string]int) // 商家/订单 -> report.Orders 下标
+	for i, e := range events {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		virtual.Set(e.Time)
+		if err := apply(ctx, q, e, report, index); err != nil {
+			report.Failures = append(report.Failures, Failure{Index: i, Event: e, Error: err.Error()})
+		}
+	}
+
+	report.Summary = summarize(report.Orders)
+	byMerchant := make(map[string][]OrderResult)
+	for _, r := range report.Orders {
+		byMerchant[r.MerchantID] = append(byMerchant[r.MerchantID], r)
+	}
+	for merchantID, results := range byMerchant {
+		report.ByMerchant[merchantID] = summarize(results)
+	}
+	return report, nil
+}
+
+// apply 回放单个事件
+func apply(ctx context.Context, q *oqueue.QueueSystem, e Event, report *Report, index map[string]int) error {
+	key := e.MerchantID + "/" + e.OrderID
+	switch e.Type {
+	case EventEnqueue:
+		err := q.EnqueueOrder(ctx, oqueue.OrderInfo{
+			MerchantID:  e.MerchantID,
+			OrderID:     e.OrderID,
+			NumOfItems:  e.NumOfItems,
+			Timestamp:   e.Time.UnixNano(),
+			EnqueueTime: e.Time,
+			Lane:        e.Lane,
+			Channel:     e.Channel,
+			Stations:    e.Stations,
+		})
+		if err != nil {
+			return err
+		}
+		record, err := q.GetOrderRecord(ctx, e.MerchantID, e.OrderID)
+		if err != nil {
+			return err
+		}
+		index[key] = len(report.Orders)
+		report.Orders = append(report.Orders, OrderResult{
+			MerchantID: e.MerchantID,
+			OrderID:    e.OrderID,
+			NumOfItems: record.NumOfItems,
+			EnqueuedAt: e.Time,
+			Position:   record.EnqueuePosition,
+			Predicted:  record.EstimatedWait.Expected,
+			P90:        record.EstimatedWait.P90,
+		})
+		return nil
+	case EventPreparing:
+		return q.StartPreparing(ctx, e.MerchantID, e.OrderID)
+	case EventComplete:
+		if err := q.CompleteMerchantOrder(ctx, e.MerchantID, e.OrderID); err != nil {
+			return err
+		}
+		if i, ok := index[key]; ok {
+			report.Orders[i].Actual = e.Time.Sub(report.Orders[i].EnqueuedAt)
+			report.Orders[i].Completed = true
+		}
+		return nil
+	case EventPickup:
+		return q.PickupOrder(ctx, e.MerchantID, e.OrderID)
+	case EventCancel:
+		return q.CancelOrder(ctx, e.MerchantID, e.OrderID)
+	default:
+		return fmt.Errorf("unknown event type: %q", e.Type)
+	}
+}
+
+// summarize 汇总预估误差
+func summarize(results []OrderResult) Summary {
+	s := Summary{Orders: len(results)}
+	var abs, sum, squares float64
+	var covered int
+	for _, r := range results {
+		if !r.Completed {
+			continue
+		}
+		s.Completed++
+		diff := float64(r.Deviation())
+		abs += math.Abs(diff)
+		sum += diff
+		squares += diff * diff
+		if r.Actual <= r.P90 {
+			covered++
+		}
+	}
+	if s.Completed == 0 {
+		return s
+	}
+
+	n := float64(s.Completed)
+	s.MeanAbsError = time.Duration(abs / n)
+	s.MeanError = time.Duration(sum / n)
+	s.RMSE = time.Duration(math.Sqrt(squares / n))
+	s.P90Coverage = float64(covered) / n
+	return s
+}
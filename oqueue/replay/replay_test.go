@@ -0,0 +1,118 @@
+package replay
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		log     string
+		want    int
+		wantErr string
+	}{
+		{"empty", "", 0, ""},
+		{"blank lines", "\n" + `{"type":"enqueue","merchant_id":"m1","order_id":"o1","num_of_items":2}` + "\n\n", 1, ""},
+		{"invalid line", `{"type":"enqueue"}` + "\n" + `{"type":`, 0, "line 2"},
+	}
+	for _, tt := range tests {
+		events, err := ReadEvents(strings.NewReader(tt.log))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %s", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || len(events) != tt.want {
+			t.Errorf("%s: events = %+v, %v", tt.name, events, err)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	results := []OrderResult{
+		{Predicted: 4 * time.Minute, P90: 5 * time.Minute, Actual: 3 * time.Minute, Completed: true},
+		{Predicted: 4 * time.Minute, P90: 5 * time.Minute, Actual: 7 * time.Minute, Completed: true},
+		{Predicted: 4 * time.Minute},
+	}
+	got := summarize(results)
+	want := Summary{
+		Orders:       3,
+		Completed:    2,
+		MeanAbsError: 2 * time.Minute,
+		MeanError:    -time.Minute,
+		RMSE:         time.Duration(math.Sqrt(5) * float64(time.Minute)),
+		P90Coverage:  0.5,
+	}
+	if got.Orders != want.Orders || got.Completed != want.Completed || got.MeanAbsError != want.MeanAbsError ||
+		got.MeanError != want.MeanError || (got.RMSE-want.RMSE).Abs() > time.Millisecond || got.P90Coverage != want.P90Coverage {
+		t.Errorf("summary = %+v, want %+v", got, want)
+	}
+	if (OrderResult{Predicted: time.Minute}).Deviation() != 0 {
+		t.Error("deviation of order not completed")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	at := func(min int) time.Time { return time.Date(2026, 3, 2, 12, min, 0, 0, time.UTC) }
+	// 事件不按时间排列，回放时按时间排序
+	events := []Event{
+		{Type: EventComplete, Time: at(5), MerchantID: "m1", OrderID: "o1"},
+		{Type: EventEnqueue, Time: at(0), MerchantID: "m1", OrderID: "o1", NumOfItems: 1},
+		{Type: EventEnqueue, Time: at(1), MerchantID: "m1", OrderID: "o2", NumOfItems: 2},
+		{Type: EventEnqueue, Time: at(2), MerchantID: "m1", OrderID: "o1", NumOfItems: 1},
+		{Type: EventEnqueue, Time: at(3), MerchantID: "m2", OrderID: "o1", NumOfItems: 1},
+		{Type: EventComplete, Time: at(6), MerchantID: "m1", OrderID: "missing"},
+		{Type: "unknown", Time: at(7), MerchantID: "m1", OrderID: "o2"},
+	}
+	report, err := Replay(context.Background(), events, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		merchantID, orderID string
+		position            int64
+		predicted, actual   time.Duration
+		completed           bool
+	}{
+		{"m1", "o1", 0, 3*time.Minute + 36*time.Second, 5 * time.Minute, true},
+		{"m1", "o2", 1, 0, 0, false},
+		{"m2", "o1", 0, 3*time.Minute + 36*time.Second, 0, false},
+	}
+	if len(report.Orders) != len(tests) {
+		t.Fatalf("orders = %+v", report.Orders)
+	}
+	for i, tt := range tests {
+		r := report.Orders[i]
+		if r.MerchantID != tt.merchantID || r.OrderID != tt.orderID || r.Position != tt.position ||
+			r.Actual != tt.actual || r.Completed != tt.completed || (tt.predicted > 0 && r.Predicted != tt.predicted) {
+			t.Errorf("order %d = %+v", i, r)
+		}
+	}
+	if o2 := report.Orders[1]; o2.Predicted <= report.Orders[0].Predicted {
+		t.Errorf("o2 predicted = %v", o2.Predicted)
+	}
+
+	// 重复入队、完成不存在的订单与未知事件记为失败
+	wantFailures := []int{2, 5, 6}
+	if len(report.Failures) != len(wantFailures) {
+		t.Fatalf("failures = %+v", report.Failures)
+	}
+	for i, f := range report.Failures {
+		if f.Index != wantFailures[i] || f.Error == "" {
+			t.Errorf("failure %d = %+v", i, f)
+		}
+	}
+
+	if s := report.Summary; s.Orders != 3 || s.Completed != 1 || s.MeanError != -time.Minute-24*time.Second {
+		t.Errorf("summary = %+v", s)
+	}
+	if len(report.ByMerchant) != 2 || report.ByMerchant["m2"].Orders != 1 || report.ByMerchant["m2"].Completed != 0 {
+		t.Errorf("by merchant = %+v", report.ByMerchant)
+	}
+}
@@ -0,0 +1,224 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"github.com/open4go/log"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+const (
+	scheduleLookahead       = 2 * time.Hour // 预估等待时间时计入该时长内将放入队列的预约订单
+	defaultScheduleInterval = time.Minute   // 默认预约订单放入间隔
+)
+
+// ErrOrderAlreadyScheduled 订单已预约
+var ErrOrderAlreadyScheduled = errors.New("order already scheduled")
+
+// ScheduledOrder 预约订单
+type ScheduledOrder struct {
+	Order     OrderInfo `json:"order"`
+	PickupAt  time.Time `json:"pickup_at"`  // 预约取餐时间
+	ReleaseAt time.Time `json:"release_at"` // 放入队列的时间: 取餐时间 - 预估制作时间
+}
+
+// scheduleScript 保存预约订单，订单已预约时返回 resultConflict
+// KEYS: 预约集合(score为放入时间), 预约订单哈希
+// ARGV: 订单ID, 放入时间(毫秒), 预约订单JSON
+var scheduleScript = redis.NewScript(`
+if redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[3]) == 0 then
+	return 2
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 0
+`)
+
+// unscheduleScript 移除预约订单，订单不存在时返回 resultNotFound
+// KEYS: 预约集合, 预约订单哈希
+// ARGV: 订单ID
+var unscheduleScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 1
+end
+redis.call('HDEL', KEYS[2], ARGV[1])
+return 0
+`)
+
+// scheduledOrdersScript 按放入时间顺序读取 until 之前放入的预约订单JSON
+// KEYS: 预约集合, 预约订单哈希
+// ARGV: until(毫秒或 +inf)
+var scheduledOrdersScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if #ids == 0 then
+	return {}
+end
+return redis.call('HMGET', KEYS[2], unpack(ids))
+`)
+
+// ScheduleOrder 预约订单在 pickupAt 取餐
+// 订单先保存在预约集合中，到 取餐时间-预估制作时间 由 ReleaseScheduledOrders 放入队列，
+// 放入时使用预约通道(LaneScheduled)排在普通订单之前，并在此时分配取餐号；放入时间已到时直接入队。
+// 商家在放入时间仍处于暂停接单时返回 *QueueFullError，预约成功的订单放入队列时不再做准入检查
+func (q *QueueSystem) ScheduleOrder(ctx context.Context, order OrderInfo, pickupAt time.Time) (*ScheduledOrder, error) {
+	cfg, err := q.GetMerchantConfig(ctx, order.MerchantID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := order.stationList(); err != nil {
+		return nil, err
+	}
+	if order.NumOfItems == 0 {
+		for _, n := range order.Stations {
+			order.NumOfItems += n
+		}
+	}
+
+	// 制作时间按队列为空时预估，放入队列后借助预约通道的权重排到前面
+	stats, err := q.GetMerchantStats(ctx, order.MerchantID)
+	if err != nil {
+		return nil, err
+	}
+	prep, err := q.estimateWait(ctx, order.MerchantID, cfg, stats, nil, order.NumOfItems, false)
+	if err != nil {
+		return nil, err
+	}
+	scheduled := &ScheduledOrder{Order: order, PickupAt: pickupAt, ReleaseAt: pickupAt.Add(-prep.Expected)}
+	if cfg.Admission.pausedAt(scheduled.ReleaseAt) {
+		return nil, pausedError(order.MerchantID, cfg.Admission)
+	}
+
+	if now := q.now(); !scheduled.ReleaseAt.After(now) {
+		scheduled.ReleaseAt = now
+		if scheduled.Order.Ticket, err = q.releaseOrder(ctx, cfg, *scheduled); err != nil {
+			return nil, err
+		}
+		return scheduled, nil
+	}
+	if err := q.store.Schedule(ctx, *scheduled); err != nil {
+		return nil, err
+	}
+	return scheduled, nil
+}
+
+// GetScheduledOrders 获取商家尚未放入队列的预约订单，按放入时间排序
+func (q *QueueSystem) GetScheduledOrders(ctx context.Context, merchantID string) ([]ScheduledOrder, error) {
+	return q.store.ScheduledOrders(ctx, merchantID, time.Time{})
+}
+
+// CancelScheduledOrder 取消尚未放入队列的预约订单，订单不存在或已放入队列时返回 ErrOrderNotFound
+// 已放入队列的订单使用 CancelOrder 取消
+func (q *QueueSystem) CancelScheduledOrder(ctx context.Context, merchantID, orderID string) error {
+	return q.store.Unschedule(ctx, merchantID, orderID)
+}
+
+// ReleaseScheduledOrders 将商家到达放入时间的预约订单放入队列，返回放入的订单ID
+// 订单先入队再从预约集合移除，多个实例同时放入时重复入队返回 ErrOrderAlreadyQueued，视为已放入
+func (q *QueueSystem) ReleaseScheduledOrders(ctx context.Context, merchantID string) ([]string, error) {
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	due, err := q.store.ScheduledOrders(ctx, merchantID, q.now())
+	if err != nil {
+		return nil, err
+	}
+
+	var released []string
+	for _, scheduled := range due {
+		_, err := q.releaseOrder(ctx, cfg, scheduled)
+		switch {
+		case err == nil:
+			released = append(released, scheduled.Order.OrderID)
+		case errors.Is(err, ErrOrderAlreadyQueued):
+		case errors.Is(err, ErrOrderAlreadyCompleted), errors.Is(err, ErrOrderAlreadyDequeued):
+			// 当天已完成或取消的订单不能再入队，直接丢弃预约
+			log.Log(ctx).WithField("order", scheduled.Order.OrderID).Error(err)
+		default:
+			return released, err
+		}
+
+		if err := q.store.Unschedule(ctx, merchantID, scheduled.Order.OrderID); err != nil && !errors.Is(err, ErrOrderNotFound) {
+			return released, err
+		}
+	}
+	return released, nil
+}
+
+// releaseOrder 将预约订单以预约通道放入队列，入队时间为当前时间
+func (q *QueueSystem) releaseOrder(ctx context.Context, cfg MerchantConfig, scheduled ScheduledOrder) (string, error) {
+	order := scheduled.Order
+	order.Lane = LaneScheduled
+	order.Timestamp = 0
+	order.EnqueueTime = time.Time{}
+
+	req, err := q.enqueueRequest(cfg, &order)
+	if err != nil {
+		return "", err
+	}
+	return q.enqueue(ctx, cfg, req)
+}
+
+// StartScheduler 启动后台协程，每隔 interval 将所有商家到期的预约订单放入队列，ctx 取消时退出
+// 使用队列系统的时钟计时
+// interval 小于等于0时使用 defaultScheduleInterval
+func (q *QueueSystem) StartScheduler(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultScheduleInterval
+	}
+	ticker := q.clock.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Log(ctx).Info("[oqueue] scheduler stopped")
+				return
+			case <-ticker.C():
+				q.releaseAll(ctx)
+			}
+		}
+	}()
+}
+
+// releaseAll 放入所有有预约订单的商家到期的订单，单个商家失败不影响其他商家
+func (q *QueueSystem) releaseAll(ctx context.Context) {
+	merchants, err := q.store.ScheduledMerchants(ctx, q.now().Add(-defaultExpiration))
+	if err != nil {
+		log.Log(ctx).Error(err)
+		return
+	}
+
+	for _, merchantID := range merchants {
+		if ctx.Err() != nil {
+			return
+		}
+		released, err := q.ReleaseScheduledOrders(ctx, merchantID)
+		if err != nil {
+			log.Log(ctx).WithField("merchant", merchantID).Error(err)
+			continue
+		}
+		if len(released) > 0 {
+			log.Log(ctx).WithField("merchant", merchantID).Infof("[oqueue] released %d scheduled orders", len(released))
+		}
+	}
+}
+
+// scheduledOvertakes 获取将在该订单开始处理前放入队列并排到其前面的预约订单的商品数
+// 预约订单的分数为 放入时间-预约通道权重，只有在 入队时间+(权重差) 之前放入的才会排到前面，
+// 且须在 horizon(订单开始处理前的等待时间)内放入
+func scheduledOvertakes(cfg MerchantConfig, scheduled []ScheduledOrder, lane Lane, enqueueTime, now time.Time, horizon time.Duration) []int {
+	until := enqueueTime.Add(cfg.laneWeight(LaneScheduled) - cfg.laneWeight(lane))
+	if limit := now.Add(horizon); until.After(limit) {
+		until = limit
+	}
+
+	var items []int
+	for _, s := range scheduled {
+		if s.ReleaseAt.After(now) && s.ReleaseAt.Before(until) {
+			items = append(items, s.Order.NumOfItems)
+		}
+	}
+	return items
+}
@@ -0,0 +1,90 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScheduleOrder(t *testing.T) {
+	ctx := context.Background()
+	q := NewQueueSystemWithStore(NewMemoryStore(), WithLocation(time.UTC))
+
+	// 队列为空时 2 件商品的制作时间为 (2×1m + 2m) × 1.2
+	prep := 4*time.Minute + 48*time.Second
+	pickupAt := time.Now().Add(time.Hour)
+	later, err := q.ScheduleOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: "later", NumOfItems: 2}, pickupAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !later.ReleaseAt.Equal(pickupAt.Add(-prep)) || later.Order.Ticket != "" {
+		t.Errorf("later: scheduled = %+v", later)
+	}
+	// 取餐时间早于制作完成时间的订单直接放入队列
+	soon, err := q.ScheduleOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: "soon", NumOfItems: 2}, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if soon.ReleaseAt.After(time.Now()) || soon.Order.Ticket == "" {
+		t.Errorf("soon: scheduled = %+v", soon)
+	}
+
+	if _, err := q.ScheduleOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: "later", NumOfItems: 2}, pickupAt); !errors.Is(err, ErrOrderAlreadyScheduled) {
+		t.Fatalf("schedule twice: %v", err)
+	}
+	pending, err := q.GetScheduledOrders(ctx, "m1")
+	if err != nil || len(pending) != 1 || pending[0].Order.OrderID != "later" {
+		t.Fatalf("scheduled orders = %+v, %v", pending, err)
+	}
+
+	q.releaseAll(ctx)
+	if pending, _ := q.GetScheduledOrders(ctx, "m1"); len(pending) != 1 {
+		t.Fatalf("released before release time: %+v", pending)
+	}
+
+	// 到达放入时间的预约订单
+	due := ScheduledOrder{
+		Order:     OrderInfo{MerchantID: "m1", OrderID: "due", NumOfItems: 1},
+		PickupAt:  time.Now().Add(prep),
+		ReleaseAt: time.Now().Add(-time.Second),
+	}
+	if err := q.store.Schedule(ctx, due); err != nil {
+		t.Fatal(err)
+	}
+	q.releaseAll(ctx)
+	pending, _ = q.GetScheduledOrders(ctx, "m1")
+	if len(pending) != 1 || pending[0].Order.OrderID != "later" {
+		t.Fatalf("pending after release = %+v", pending)
+	}
+	record, err := q.GetOrderRecord(ctx, "m1", "due")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.State != StateQueued || record.Lane != LaneScheduled || record.Ticket == "" {
+		t.Fatalf("released order = %+v", record)
+	}
+}
+
+func TestCancelScheduledOrder(t *testing.T) {
+	ctx := context.Background()
+	q := NewQueueSystemWithStore(NewMemoryStore())
+	if _, err := q.ScheduleOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: "o1", NumOfItems: 1}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.CancelScheduledOrder(ctx, "m1", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.CancelScheduledOrder(ctx, "m1", "o1"); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("cancel twice: %v", err)
+	}
+}
+
+func TestStartSchedulerDefaultInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q := NewQueueSystemWithStore(NewMemoryStore())
+	for _, interval := range []time.Duration{0, -time.Second} {
+		q.StartScheduler(ctx, interval)
+	}
+}
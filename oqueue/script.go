@@ -0,0 +1,361 @@
+package oqueue
+
+import (
+	"errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// 脚本返回码，脚本返回 {返回码, 订单当前状态, ...}
+const (
+	resultOK       = 0
+	resultNotFound = 1
+	resultConflict = 2 // 订单当前状态不允许该操作
+	resultTicket   = 3 // 指定的取餐号已被占用
+	resultHeld     = 4 // 订单已暂缓
+	resultNotHeld  = 5 // 订单未暂缓
+	resultNoRoom   = 6 // 相邻订单分数过近，无法插入
+	resultDone     = 7 // 工位小票已完成
+)
+
+var (
+	// ErrOrderNotFound 订单不存在
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrOrderAlreadyQueued 订单已在队列中
+	ErrOrderAlreadyQueued = errors.New("order already queued")
+	// ErrOrderAlreadyCompleted 订单已完成
+	ErrOrderAlreadyCompleted = errors.New("order already completed")
+	// ErrOrderAlreadyDequeued 订单已出队
+	ErrOrderAlreadyDequeued = errors.New("order already dequeued")
+)
+
+// scriptResult 将脚本返回值转换为错误
+func scriptResult(res []interface{}, target OrderState) error {
+	if len(res) < 2 {
+		return errors.New("unexpected script result")
+	}
+	code, _ := res[0].(int64)
+	current, _ := res[1].(string)
+
+	switch code {
+	case resultOK:
+		return nil
+	case resultNotFound:
+		return ErrOrderNotFound
+	case resultConflict:
+		return stateError(OrderState(current), target)
+	default:
+		return errors.New("unknown script result")
+	}
+}
+
+// scriptCall 一次脚本调用的 KEYS 与 ARGV
+type scriptCall struct {
+	keys []string
+	args []interface{}
+}
+
+// luaDecodeMember 解析队列成员，返回商品数与入队时间(毫秒)
+// 兼容JSON编码与旧版冒号分隔格式
+const luaDecodeMember = `
+local function decode_member(member)
+	if string.sub(member, 1, 1) == '{' then
+		local obj = cjson.decode(member)
+		local enqueueAt = tonumber(obj.enqueue_at)
+		if not enqueueAt then
+			return tonumber(obj.num_of_items), nil
+		end
+		return tonumber(obj.num_of_items), math.floor(enqueueAt / 1000000)
+	end
+	local items, enqueued = string.match(member, ':(%d+):(%d+)$')
+	if not enqueued then
+		return nil, nil
+	end
+	return tonumber(items), tonumber(enqueued) * 1000
+end
+`
+
+// luaUpdateStats 订单出餐后更新商家统计
+// 处理时长异常的订单只计入 rejected_orders；其余样本更新:
+// 衰减加权的均值/方差与直方图、指数加权平均、当前小时平均；返回样本是否被计入
+// record_sample 直接按商品数与入队时间记录样本，供工位统计使用
+const luaUpdateStats = `
+local function running_avg(key, avgField, countField, itemTime)
+	local stats = redis.call('HMGET', key, avgField, countField)
+	local avg = tonumber(stats[1]) or 0
+	local count = tonumber(stats[2]) or 0
+	local newAvg = itemTime
+	if count > 0 then
+		newAvg = math.floor((avg * count + itemTime) / (count + 1))
+	end
+	redis.call('HSET', key, avgField, newAvg, countField, count + 1)
+end
+
+local function record_sample(key, items, enqueued, now, ttl, policy)
+	if not items or items <= 0 or not enqueued then
+		return false
+	end
+
+	local duration = now - enqueued
+	if duration < 0 then
+		duration = 0
+	end
+	local itemTime = math.floor(duration / items)
+
+	local cur = redis.call('HMGET', key, 'sample_weight', 'mean_item_time', 'm2_item_time', 'decay_at')
+	local weight = tonumber(cur[1]) or 0
+	local mean = tonumber(cur[2]) or 0
+	local m2 = tonumber(cur[3]) or 0
+	local decayAt = tonumber(cur[4])
+
+	-- 异常样本不计入统计
+	local reject = duration > policy.max_order or itemTime < policy.min_item
+	if not reject and policy.sigma > 0 and weight >= policy.min_samples then
+		local sd = math.sqrt(m2 / weight)
+		if sd > 0 and itemTime > mean + policy.sigma * sd then
+			reject = true
+		end
+	end
+	if reject then
+		redis.call('HINCRBY', key, 'rejected_orders', 1)
+		redis.call('EXPIRE', key, ttl)
+		return false
+	end
+
+	-- 按距上次更新的时间衰减旧样本
+	local factor = 1
+	if decayAt and now > decayAt and policy.half_life > 0 then
+		factor = 0.5 ^ ((now - decayAt) / policy.half_life)
+	end
+	weight = weight * factor
+	m2 = m2 * factor
+
+	local buckets = policy.buckets
+	local bucket = #buckets + 1
+	for i, bound in ipairs(buckets) do
+		if itemTime <= bound then
+			bucket = i
+			break
+		end
+	end
+	for i = 1, #buckets + 1 do
+		local field = 'hist:' .. i
+		local w = (tonumber(redis.call('HGET', key, field)) or 0) * factor
+		if i == bucket then
+			w = w + 1
+		end
+		if w > 0 then
+			redis.call('HSET', key, field, w)
+		end
+	end
+
+	-- 加权 Welford 算法更新均值与方差
+	weight = weight + 1
+	local delta = itemTime - mean
+	mean = mean + delta / weight
+	m2 = m2 + delta * (itemTime - mean)
+
+	local count = tonumber(redis.call('HGET', key, 'processed_orders')) or 0
+	redis.call('HSET', key,
+		'sample_weight', weight,
+		'mean_item_time', mean,
+		'm2_item_time', m2,
+		'decay_at', now,
+		'avg_item_time', math.floor(mean),
+		'processed_orders', count + 1)
+
+	running_avg(key, 'avg_item_time:' .. policy.hour, 'processed_orders:' .. policy.hour, itemTime)
+
+	local ewma = tonumber(redis.call('HGET', key, 'ewma_item_time'))
+	if ewma then
+		ewma = math.floor(policy.alpha * itemTime + (1 - policy.alpha) * ewma)
+	else
+		ewma = itemTime
+	end
+	redis.call('HSET', key, 'ewma_item_time', ewma)
+	redis.call('EXPIRE', key, ttl)
+	return true
+end
+
+local function update_stats(key, member, now, ttl, policy)
+	local items, enqueued = decode_member(member)
+	return record_sample(key, items, enqueued, now, ttl, policy)
+end
+`
+
+// luaUpdateAccuracy 订单出餐后对比入队时的预估与实际等待时间
+// 误差 = 实际 - 预估(正数表示低估)，按统计半衰期衰减加权；
+// 预估时使用了校准缓冲系数的订单，同时更新使缓冲系数无偏的校准值
+const luaUpdateAccuracy = `
+local function update_accuracy(key, orderKey, now, ttl, policy)
+	local order = redis.call('HMGET', orderKey, 'estimate_ms', 'queued_at', 'buffer')
+	local estimate = tonumber(order[1])
+	local queuedAt = tonumber(order[2])
+	if not estimate or estimate <= 0 or not queuedAt then
+		return
+	end
+	local actual = now - queuedAt
+	local err = actual - estimate
+
+	local cur = redis.call('HMGET', key, 'accuracy_weight', 'mae_ms', 'bias_ms',
+		'calibration_weight', 'calibrated_buffer', 'accuracy_decay_at')
+	local weight = tonumber(cur[1]) or 0
+	local mae = tonumber(cur[2]) or 0
+	local bias = tonumber(cur[3]) or 0
+	local calWeight = tonumber(cur[4]) or 0
+	local calBuffer = tonumber(cur[5]) or 0
+	local decayAt = tonumber(cur[6])
+
+	local factor = 1
+	if decayAt and now > decayAt and policy.half_life > 0 then
+		factor = 0.5 ^ ((now - decayAt) / policy.half_life)
+	end
+
+	weight = weight * factor + 1
+	mae = mae + (math.abs(err) - mae) / weight
+	bias = bias + (err - bias) / weight
+	redis.call('HSET', key, 'accuracy_weight', weight, 'mae_ms', mae, 'bias_ms', bias, 'accuracy_decay_at', now)
+
+	-- 使本单预估恰好准确的缓冲系数
+	local buffer = tonumber(order[3])
+	if buffer and buffer > 0 then
+		calWeight = calWeight * factor + 1
+		calBuffer = calBuffer + (buffer * actual / estimate - calBuffer) / calWeight
+		redis.call('HSET', key, 'calibration_weight', calWeight, 'calibrated_buffer', calBuffer)
+	end
+	redis.call('EXPIRE', key, ttl)
+end
+`
+
+// enqueueScript 原子入队，分配取餐号，并累计当天各通道的到达量
+// 订单当天已存在时返回冲突及其当前状态，指定的取餐号当天已被占用时返回 resultTicket，
+// 成功时返回 {0, 'queued', 取餐号, 入队后的位置}；自动分配时跳过已被指定占用的取餐号
+// 分配的取餐号追加到成员JSON末尾，因此成员编码时不能已包含 ticket 字段
+// 拆分到工位的订单同时加入各工位队列，订单哈希中 station:<工位> 记为 pending
+// KEYS: queue, index, order, lanes, queued状态集合, tickets, ticket索引, 之后为各工位队列
+// ARGV: orderID, member, score, ttl(秒), lane, items, now(毫秒), 取餐号前缀(为空时不分配), 已指定的取餐号,
+// 之后为与工位队列一一对应的工位名
+var enqueueScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[2], ARGV[1]) == 1 then
+	return {2, redis.call('HGET', KEYS[3], 'state') or 'queued'}
+end
+
+local member = ARGV[2]
+local ticket = ARGV[9]
+if ticket ~= '' and redis.call('HEXISTS', KEYS[7], ticket) == 1 then
+	return {3, ''}
+end
+if ARGV[8] ~= '' then
+	repeat
+		local seq = redis.call('HINCRBY', KEYS[6], 'seq:' .. ARGV[8], 1)
+		ticket = string.format('%s%03d', ARGV[8], seq)
+	until redis.call('HEXISTS', KEYS[7], ticket) == 0
+	member = string.sub(member, 1, -2) .. ',"ticket":' .. cjson.encode(ticket) .. '}'
+end
+
+redis.call('ZADD', KEYS[1], ARGV[3], member)
+redis.call('HSET', KEYS[2], ARGV[1], member)
+redis.call('HSET', KEYS[3], 'state', 'queued', 'queued_at', ARGV[7])
+redis.call('ZADD', KEYS[5], ARGV[7], ARGV[1])
+redis.call('HINCRBY', KEYS[4], 'count:' .. ARGV[5], 1)
+redis.call('HINCRBY', KEYS[4], 'items:' .. ARGV[5], ARGV[6])
+redis.call('HSETNX', KEYS[4], 'since', ARGV[7])
+if ticket ~= '' then
+	redis.call('HSET', KEYS[3], 'ticket', ticket)
+	redis.call('HSET', KEYS[7], ticket, ARGV[1])
+end
+for i = 1, 7 do
+	redis.call('EXPIRE', KEYS[i], ARGV[4])
+end
+for i = 8, #KEYS do
+	redis.call('ZADD', KEYS[i], ARGV[3], ARGV[1])
+	redis.call('HSET', KEYS[3], 'station:' .. ARGV[i + 2], 'pending')
+	redis.call('EXPIRE', KEYS[i], ARGV[4])
+end
+return {0, 'queued', ticket, redis.call('ZRANK', KEYS[1], member)}
+`)
+
+// transitionScript 原子地将订单流转到目标状态
+// 离开排队/制作中状态时移出队列，流转到 ready 时更新商家统计与预估准确度，并记录该前缀当前叫到的取餐号
+// 离开队列时在订单哈希中记录离开时的位置 final_position
+// 成功时返回 {0, 流转前的状态, 尚未完成的工位(逗号分隔，供调用方清理工位队列), 离开队列时的位置(未离开队列时为-1)}
+// KEYS: queue, index, order, stats, 之后依次为 orderStates 对应的状态集合, tickets
+// ARGV: orderID, 目标状态, 允许的来源状态(逗号分隔), now(毫秒), ttl(秒), 统计ttl(秒), 统计参数(JSON)
+var transitionScript = redis.NewScript(luaDecodeMember + luaUpdateStats + luaUpdateAccuracy + `
+local stateKeys = {
+	queued = KEYS[5],
+	preparing = KEYS[6],
+	ready = KEYS[7],
+	picked_up = KEYS[8],
+	cancelled = KEYS[9],
+	expired = KEYS[10],
+}
+
+local member = redis.call('HGET', KEYS[2], ARGV[1])
+if not member then
+	return {1, ''}
+end
+
+local current = redis.call('HGET', KEYS[3], 'state') or 'queued'
+local allowed = false
+for state in string.gmatch(ARGV[3], '[^,]+') do
+	if state == current then
+		allowed = true
+	end
+end
+if not allowed then
+	return {2, current}
+end
+
+local target = ARGV[2]
+local now = tonumber(ARGV[4])
+local position = -1
+local pending = {}
+if target ~= 'queued' and target ~= 'preparing' then
+	position = redis.call('ZRANK', KEYS[1], member) or -1
+	if position >= 0 then
+		redis.call('HSET', KEYS[3], 'final_position', position)
+	end
+	redis.call('ZREM', KEYS[1], member)
+
+	if string.sub(member, 1, 1) == '{' then
+		local stations = cjson.decode(member).stations
+		if type(stations) == 'table' then
+			for station in pairs(stations) do
+				if redis.call('HGET', KEYS[3], 'station:' .. station) == 'pending' then
+					table.insert(pending, station)
+				end
+			end
+		end
+	end
+end
+redis.call('ZREM', stateKeys[current], ARGV[1])
+redis.call('ZADD', stateKeys[target], now, ARGV[1])
+redis.call('HSET', KEYS[3], 'state', target, target .. '_at', ARGV[4])
+redis.call('EXPIRE', KEYS[3], ARGV[5])
+redis.call('EXPIRE', stateKeys[target], ARGV[5])
+
+if target == 'ready' then
+	local policy = cjson.decode(ARGV[7])
+	if update_stats(KEYS[4], member, now, ARGV[6], policy) then
+		update_accuracy(KEYS[4], KEYS[3], now, ARGV[6], policy)
+	end
+
+	local ticket = redis.call('HGET', KEYS[3], 'ticket')
+	local prefix = ticket and string.match(ticket, '^(.-)%d+$')
+	if prefix then
+		redis.call('HSET', KEYS[11], 'serving:' .. prefix, ticket)
+		redis.call('EXPIRE', KEYS[11], ARGV[5])
+	end
+end
+return {0, current, table.concat(pending, ','), position}
+`)
+
+// releaseMerchantScript 删除订单所属商家的全局索引，订单ID已被其他商家复用时保留
+// KEYS: 订单所属商家
+// ARGV: merchantID
+var releaseMerchantScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+end
+return 0
+`)
@@ -0,0 +1,159 @@
+package oqueue
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+const defaultThroughputWindow = time.Hour // 默认按最近1小时统计出餐速率
+
+// QueueSnapshot 商家队列看板快照
+type QueueSnapshot struct {
+	MerchantID string          `json:"merchant_id"`
+	Day        string          `json:"day"` // 营业日
+	Orders     []SnapshotOrder `json:"orders"`
+	TotalItems int             `json:"total_items"`
+	// LongestWaiting 等待最久(入队最早)的订单，队列为空时为 nil
+	LongestWaiting *SnapshotOrder `json:"longest_waiting,omitempty"`
+	// CompletedToday 当前营业日已出餐(含已取餐)的订单数
+	CompletedToday int        `json:"completed_today"`
+	Throughput     Throughput `json:"throughput"`
+	Paused         bool       `json:"paused"` // 商家是否暂停接单
+	// Scheduled 尚未放入队列的预约订单，按放入时间排序
+	Scheduled []ScheduledOrder `json:"scheduled"`
+	Time      time.Time        `json:"time"`
+}
+
+// SnapshotOrder 快照中的订单
+type SnapshotOrder struct {
+	OrderRecord
+	Position int64         `json:"position"` // 队列中的位置(从0开始)
+	Age      time.Duration `json:"age"`      // 已等待时间
+	Wait     WaitEstimate  `json:"wait"`     // 预估剩余等待时间
+}
+
+// Throughput 最近一段时间的出餐速率
+type Throughput struct {
+	Window        time.Duration `json:"window"`
+	Orders        int           `json:"orders"` // 窗口内出餐的订单数
+	Items         int           `json:"items"`  // 窗口内出餐的商品数
+	OrdersPerHour float64       `json:"orders_per_hour"`
+	ItemsPerHour  float64       `json:"items_per_hour"`
+}
+
+// snapshotScript 一次读取队列中的订单及其状态、当天出餐数、窗口内的出餐量、商家统计、通道统计与预约订单
+// 订单状态key由前缀加订单ID组成，与其他key使用同一哈希标签，位于同一slot
+// 返回 {队列成员, 各成员的状态哈希, 出餐数, 窗口内出餐订单数, 窗口内出餐商品数, 商家统计, 通道统计, 预约订单JSON}
+// KEYS: queue, index, ready状态集合, picked_up状态集合, stats, lanes, 预约集合, 预约订单哈希
+// ARGV: 订单状态key前缀, since(毫秒)
+var snapshotScript = redis.NewScript(luaDecodeMember + `
+local function member_id(member)
+	if string.sub(member, 1, 1) == '{' then
+		return cjson.decode(member).order_id
+	end
+	return string.match(member, '([^:]+):%d+:%d+$')
+end
+
+local members = redis.call('ZRANGE', KEYS[1], 0, -1)
+local fields = {}
+for i, member in ipairs(members) do
+	local id = member_id(member)
+	if id then
+		fields[i] = redis.call('HGETALL', ARGV[1] .. id)
+	else
+		fields[i] = {}
+	end
+end
+
+-- 取餐后订单移到 picked_up 集合，其分数为取餐时间，不早于出餐时间
+local since = tonumber(ARGV[2])
+local recentOrders, recentItems = 0, 0
+for k = 3, 4 do
+	for _, id in ipairs(redis.call('ZRANGEBYSCORE', KEYS[k], since, '+inf')) do
+		local readyAt = tonumber(redis.call('HGET', ARGV[1] .. id, 'ready_at'))
+		if readyAt and readyAt >= since then
+			recentOrders = recentOrders + 1
+			local member = redis.call('HGET', KEYS[2], id)
+			local items = member and decode_member(member)
+			recentItems = recentItems + (items or 0)
+		end
+	end
+end
+
+local scheduled = {}
+local ids = redis.call('ZRANGE', KEYS[7], 0, -1)
+if #ids > 0 then
+	scheduled = redis.call('HMGET', KEYS[8], unpack(ids))
+end
+
+local completed = redis.call('ZCARD', KEYS[3]) + redis.call('ZCARD', KEYS[4])
+return {members, fields, completed, recentOrders, recentItems,
+	redis.call('HGETALL', KEYS[5]), redis.call('HGETALL', KEYS[6]), scheduled}
+`)
+
+// GetQueueSnapshot 获取商家当前营业日的队列看板快照
+// 包含按顺序排列的订单及其取餐号、位置、已等待时间与预估时间，等待最久的订单，
+// 当天出餐数，以及最近 window 内的出餐速率(window 小于等于0时为1小时)。
+// 商家配置决定营业日，先于快照单独读取；队列中的订单及其状态、出餐数与统计数据由存储一次原子读取
+// (Redis 中为一次脚本调用)，期间的入队与状态流转不会使快照前后不一致，各订单的预估时间基于同一份数据计算
+func (q *QueueSystem) GetQueueSnapshot(ctx context.Context, merchantID string, window time.Duration) (*QueueSnapshot, error) {
+	if window <= 0 {
+		window = defaultThroughputWindow
+	}
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	day := q.currentDay(cfg)
+
+	now := q.now()
+	data, err := q.store.Snapshot(ctx, merchantID, day, now.Add(-window))
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &QueueSnapshot{
+		MerchantID:     merchantID,
+		Day:            day,
+		Orders:         make([]SnapshotOrder, 0, len(data.Orders)),
+		CompletedToday: data.Completed,
+		Throughput: Throughput{
+			Window:        window,
+			Orders:        data.RecentOrders,
+			Items:         data.RecentItems,
+			OrdersPerHour: float64(data.RecentOrders) / window.Hours(),
+			ItemsPerHour:  float64(data.RecentItems) / window.Hours(),
+		},
+		Paused:    cfg.Admission.pausedAt(now),
+		Scheduled: data.Scheduled,
+		Time:      now,
+	}
+
+	estimates := estimateData{stats: parseMerchantStats(data.Stats), lanes: data.Lanes, scheduled: data.Scheduled}
+	preceding := make([]int, 0, len(data.Orders))
+	longest := -1
+	for i, record := range data.Orders {
+		wait, err := q.estimateWithOvertakes(ctx, merchantID, cfg, estimates, orderLane(record.OrderInfo), record.EnqueueTime, preceding, record.NumOfItems, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to estimate wait time: %v", err)
+		}
+		snapshot.Orders = append(snapshot.Orders, SnapshotOrder{
+			OrderRecord: *record,
+			Position:    int64(i),
+			Age:         now.Sub(record.EnqueueTime),
+			Wait:        wait,
+		})
+		snapshot.TotalItems += record.NumOfItems
+		preceding = append(preceding, record.NumOfItems)
+
+		if longest < 0 || record.EnqueueTime.Before(data.Orders[longest].EnqueueTime) {
+			longest = i
+		}
+	}
+	if longest >= 0 {
+		snapshot.LongestWaiting = &snapshot.Orders[longest]
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,143 @@
+package oqueue
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetQueueSnapshot(t *testing.T) {
+	ctx := context.Background()
+	q := NewQueueSystemWithStore(NewMemoryStore(), WithLocation(time.UTC))
+
+	snapshot, err := q.GetQueueSnapshot(ctx, "m1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Orders) != 0 || snapshot.LongestWaiting != nil || snapshot.Throughput.Window != defaultThroughputWindow {
+		t.Fatalf("empty snapshot = %+v", snapshot)
+	}
+
+	for _, order := range []OrderInfo{
+		{MerchantID: "m1", OrderID: "o1", NumOfItems: 2},
+		{MerchantID: "m1", OrderID: "o2", NumOfItems: 3},
+		{MerchantID: "m1", OrderID: "o3", NumOfItems: 1},
+	} {
+		if err := q.EnqueueOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.CompleteMerchantOrder(ctx, "m1", "o1"); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err = q.GetQueueSnapshot(ctx, "m1", 30*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Day != q.currentDay(MerchantConfig{}) || snapshot.TotalItems != 4 || snapshot.CompletedToday != 1 {
+		t.Fatalf("snapshot = %+v", snapshot)
+	}
+	if len(snapshot.Orders) != 2 || snapshot.Orders[0].OrderID != "o2" || snapshot.Orders[1].OrderID != "o3" {
+		t.Fatalf("orders = %+v", snapshot.Orders)
+	}
+	for i, order := range snapshot.Orders {
+		if order.Position != int64(i) || order.Ticket == "" || order.Age < 0 {
+			t.Errorf("order %d = %+v", i, order)
+		}
+	}
+	if snapshot.LongestWaiting == nil || snapshot.LongestWaiting.OrderID != "o2" {
+		t.Errorf("longest waiting = %+v", snapshot.LongestWaiting)
+	}
+	want := Throughput{Window: 30 * time.Minute, Orders: 1, Items: 2, OrdersPerHour: 2, ItemsPerHour: 4}
+	if snapshot.Throughput != want {
+		t.Errorf("throughput = %+v, want %+v", snapshot.Throughput, want)
+	}
+}
+
+// afterScriptHook 在指定脚本执行成功后调用一次 fn，用于模拟两次读取之间的并发修改
+type afterScriptHook struct {
+	script *redis.Script
+	fn     func()
+	once   sync.Once
+}
+
+func (h *afterScriptHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *afterScriptHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		args := cmd.Args()
+		if err == nil && len(args) > 1 && cmd.Name() == "evalsha" {
+			if sha, _ := args[1].(string); sha == h.script.Hash() {
+				h.once.Do(h.fn)
+			}
+		}
+		return err
+	}
+}
+
+func (h *afterScriptHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestGetQueueSnapshotConsistent(t *testing.T) {
+	ctx := context.Background()
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	other := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() {
+		client.Close()
+		other.Close()
+	})
+	q := NewQueueSystem(client, WithLocation(time.UTC))
+	writer := NewQueueSystem(other, WithLocation(time.UTC))
+
+	for _, order := range []OrderInfo{
+		{MerchantID: "m1", OrderID: "o1", NumOfItems: 2},
+		{MerchantID: "m1", OrderID: "o2", NumOfItems: 1},
+	} {
+		if err := q.EnqueueOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 预先加载脚本使快照只执行一次 EVALSHA；脚本返回后立即由另一个客户端出餐 o1，快照中不应混入之后读取的状态
+	if err := snapshotScript.Load(ctx, client).Err(); err != nil {
+		t.Fatal(err)
+	}
+	hook := &afterScriptHook{script: snapshotScript, fn: func() {
+		if err := writer.CompleteMerchantOrder(ctx, "m1", "o1"); err != nil {
+			t.Error(err)
+		}
+	}}
+	client.AddHook(hook)
+
+	snapshot, err := q.GetQueueSnapshot(ctx, "m1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Orders) != 2 || snapshot.CompletedToday != 0 || snapshot.Throughput.Orders != 0 {
+		t.Fatalf("snapshot = %+v", snapshot)
+	}
+	for _, order := range snapshot.Orders {
+		if order.State != StateQueued || !order.Transitions[StateReady].IsZero() {
+			t.Errorf("order %s = %+v", order.OrderID, order)
+		}
+	}
+
+	snapshot, err = q.GetQueueSnapshot(ctx, "m1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Orders) != 1 || snapshot.Orders[0].OrderID != "o2" || snapshot.CompletedToday != 1 {
+		t.Fatalf("snapshot after complete = %+v", snapshot)
+	}
+}
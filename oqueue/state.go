@@ -0,0 +1,224 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// OrderState 订单状态
+type OrderState string
+
+const (
+	StateQueued    OrderState = "queued"    // 排队中
+	StatePreparing OrderState = "preparing" // 制作中
+	StateReady     OrderState = "ready"     // 已出餐，待取餐
+	StatePickedUp  OrderState = "picked_up" // 已取餐
+	StateCancelled OrderState = "cancelled" // 已取消
+	StateExpired   OrderState = "expired"   // 已过期
+)
+
+// orderStates 所有状态，顺序与脚本中状态集合key的顺序一致
+var orderStates = []OrderState{
+	StateQueued,
+	StatePreparing,
+	StateReady,
+	StatePickedUp,
+	StateCancelled,
+	StateExpired,
+}
+
+// transitions 允许的状态流转: 目标状态 -> 允许的来源状态
+var transitions = map[OrderState][]OrderState{
+	StatePreparing: {StateQueued},
+	StateReady:     {StateQueued, StatePreparing},
+	StatePickedUp:  {StateReady},
+	StateCancelled: {StateQueued, StatePreparing},
+	StateExpired:   {StateQueued, StatePreparing, StateReady},
+}
+
+// IsLive 订单是否仍占用队列(排队中或制作中)
+func (s OrderState) IsLive() bool {
+	return s == StateQueued || s == StatePreparing
+}
+
+// IsTerminal 订单是否已结束
+func (s OrderState) IsTerminal() bool {
+	return s == StatePickedUp || s == StateCancelled || s == StateExpired
+}
+
+// ErrInvalidTransition 不允许的状态流转
+var ErrInvalidTransition = errors.New("invalid order state transition")
+
+// stateError 根据订单当前状态与目标状态生成错误
+func stateError(current, target OrderState) error {
+	switch {
+	case current.IsLive() && target == StateQueued:
+		return ErrOrderAlreadyQueued
+	case (current == StateReady || current == StatePickedUp) && (target == StateQueued || target == StateReady):
+		return ErrOrderAlreadyCompleted
+	case current == StateCancelled || current == StateExpired:
+		return ErrOrderAlreadyDequeued
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, current, target)
+}
+
+// OrderRecord 订单及其状态记录
+type OrderRecord struct {
+	OrderInfo
+	State       OrderState               `json:"state"`
+	Transitions map[OrderState]time.Time `json:"transitions"` // 进入各状态的时间
+
+	// 入队时的位置及预估等待时间，出餐时与实际等待时间对比
+	EnqueuePosition int64        `json:"enqueue_position"`
+	EstimatedWait   WaitEstimate `json:"estimated_wait"`
+	// FinalPosition 离开队列(出餐、取消、过期)时在队列中的位置
+	FinalPosition int64 `json:"final_position"`
+	// Held 订单是否被暂缓
+	Held bool `json:"held,omitempty"`
+	// StationsDone 已完成的工位及完成时间，未完成的工位不包含在内
+	StationsDone map[Station]time.Time `json:"stations_done,omitempty"`
+}
+
+// TransitionOrder 将订单流转到目标状态
+// 离开排队/制作中状态时订单移出队列，流转到 ready 时更新商家统计
+// 订单按当前或上一营业日查找，跨越营业日切换时间的订单仍可正常流转
+func (q *QueueSystem) TransitionOrder(ctx context.Context, merchantID, orderID string, target OrderState) error {
+	if _, ok := transitions[target]; !ok {
+		return fmt.Errorf("%w: -> %s", ErrInvalidTransition, target)
+	}
+
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return err
+	}
+	day, err := q.locateOrder(ctx, merchantID, cfg, orderID)
+	if err != nil {
+		return err
+	}
+
+	results, err := q.store.Transition(ctx, []TransitionRequest{q.transitionRequest(cfg, merchantID, day, orderID, target)})
+	if err != nil {
+		return err
+	}
+	if results[0].Err != nil {
+		return results[0].Err
+	}
+	previous, stations, position := results[0].Previous, results[0].Pending, results[0].Position
+
+	if len(stations) > 0 {
+		q.removeStationTickets(ctx, merchantID, day, map[string][]Station{orderID: stations})
+	}
+	if !target.IsLive() {
+		q.releaseOrderMerchants(ctx, merchantID, []string{orderID})
+	}
+	q.publishEvents(ctx, merchantID, transitionEvents(merchantID, orderID, previous, target, position, q.now())...)
+	if q.archiver != nil && !target.IsLive() {
+		q.recordHistory(ctx, merchantID, []historyEntry{{orderID: orderID, day: day}})
+	}
+	return nil
+}
+
+// transitionRequest 生成状态流转请求，target 须为 transitions 中的目标状态
+func (q *QueueSystem) transitionRequest(cfg MerchantConfig, merchantID, day, orderID string, target OrderState) TransitionRequest {
+	return TransitionRequest{
+		MerchantID: merchantID,
+		Day:        day,
+		OrderID:    orderID,
+		Target:     target,
+		Allowed:    transitions[target],
+		Now:        q.now(),
+		Stats:      q.statsParams(q.merchantNow(cfg)),
+	}
+}
+
+// StartPreparing 订单开始制作
+func (q *QueueSystem) StartPreparing(ctx context.Context, merchantID, orderID string) error {
+	return q.TransitionOrder(ctx, merchantID, orderID, StatePreparing)
+}
+
+// PickupOrder 顾客已取餐
+func (q *QueueSystem) PickupOrder(ctx context.Context, merchantID, orderID string) error {
+	return q.TransitionOrder(ctx, merchantID, orderID, StatePickedUp)
+}
+
+// CancelOrder 取消订单
+func (q *QueueSystem) CancelOrder(ctx context.Context, merchantID, orderID string) error {
+	return q.TransitionOrder(ctx, merchantID, orderID, StateCancelled)
+}
+
+// ExpireOrder 订单过期(长时间未处理或未取餐)
+func (q *QueueSystem) ExpireOrder(ctx context.Context, merchantID, orderID string) error {
+	return q.TransitionOrder(ctx, merchantID, orderID, StateExpired)
+}
+
+// GetOrderRecord 获取订单及其状态记录
+func (q *QueueSystem) GetOrderRecord(ctx context.Context, merchantID, orderID string) (*OrderRecord, error) {
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	day, err := q.locateOrder(ctx, merchantID, cfg, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := q.store.OrderRecords(ctx, merchantID, day, []string{orderID})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrOrderNotFound
+	}
+	return records[0], nil
+}
+
+// ListOrdersByState 按进入状态的先后列出商家当前营业日处于某状态的订单
+// 例如 ListOrdersByState(ctx, merchantID, StateReady) 获取所有待取餐订单
+func (q *QueueSystem) ListOrdersByState(ctx context.Context, merchantID string, state OrderState) ([]*OrderRecord, error) {
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	day := q.currentDay(cfg)
+
+	orderIDs, err := q.store.StateOrders(ctx, merchantID, day, state, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	return q.store.OrderRecords(ctx, merchantID, day, orderIDs)
+}
+
+// newOrderRecord 根据订单状态哈希生成订单记录
+// 状态机上线前入队的订单没有状态哈希，视为排队中
+func newOrderRecord(info OrderInfo, fields map[string]string) *OrderRecord {
+	record := &OrderRecord{
+		OrderInfo:   info,
+		State:       StateQueued,
+		Transitions: make(map[OrderState]time.Time),
+	}
+	if state, ok := fields["state"]; ok {
+		record.State = OrderState(state)
+	}
+	for _, state := range orderStates {
+		if ms, err := strconv.ParseInt(fields[string(state)+"_at"], 10, 64); err == nil {
+			record.Transitions[state] = time.UnixMilli(ms)
+		}
+	}
+	record.EnqueuePosition, _ = strconv.ParseInt(fields[positionField], 10, 64)
+	record.FinalPosition, _ = strconv.ParseInt(fields[finalPositionField], 10, 64)
+	record.EstimatedWait.Expected = parseMillis(fields[estimateField])
+	record.EstimatedWait.P90 = parseMillis(fields[p90Field])
+	_, record.Held = fields[heldAtField]
+	for station := range info.Stations {
+		if ms, err := strconv.ParseInt(fields[stationField(station)], 10, 64); err == nil {
+			if record.StationsDone == nil {
+				record.StationsDone = make(map[Station]time.Time)
+			}
+			record.StationsDone[station] = time.UnixMilli(ms)
+		}
+	}
+	return record
+}
@@ -0,0 +1,105 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStateError(t *testing.T) {
+	tests := []struct {
+		current, target OrderState
+		want            error
+	}{
+		{StateQueued, StateQueued, ErrOrderAlreadyQueued},
+		{StatePreparing, StateQueued, ErrOrderAlreadyQueued},
+		{StateReady, StateReady, ErrOrderAlreadyCompleted},
+		{StatePickedUp, StateQueued, ErrOrderAlreadyCompleted},
+		{StateCancelled, StateReady, ErrOrderAlreadyDequeued},
+		{StateExpired, StatePreparing, ErrOrderAlreadyDequeued},
+		{StateReady, StatePreparing, ErrInvalidTransition},
+		{StatePickedUp, StateCancelled, ErrInvalidTransition},
+	}
+	for _, tt := range tests {
+		if err := stateError(tt.current, tt.target); !errors.Is(err, tt.want) {
+			t.Errorf("stateError(%s, %s) = %v, want %v", tt.current, tt.target, err, tt.want)
+		}
+	}
+}
+
+func TestNewOrderRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]string
+		want   OrderState
+		at     int
+	}{
+		{"legacy order without state hash", nil, StateQueued, 0},
+		{"queued", map[string]string{"state": "queued", "queued_at": "1700000000000"}, StateQueued, 1},
+		{"ready", map[string]string{"state": "ready", "queued_at": "1700000000000", "ready_at": "1700000300000"}, StateReady, 2},
+	}
+	for _, tt := range tests {
+		record := newOrderRecord(OrderInfo{MerchantID: "m1", OrderID: "o1"}, tt.fields)
+		if record.State != tt.want || len(record.Transitions) != tt.at {
+			t.Errorf("%s: record = %+v", tt.name, record)
+		}
+	}
+}
+
+func TestTransitionOrder(t *testing.T) {
+	ctx := context.Background()
+	q, m := newTestQueue(t)
+	for _, id := range []string{"o1", "o2", "o3"} {
+		if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: id, NumOfItems: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		orderID string
+		target  OrderState
+		want    error
+	}{
+		{"o1", StatePreparing, nil},
+		{"o1", StatePreparing, ErrInvalidTransition},
+		{"o1", StateReady, nil},
+		{"o1", StateCancelled, ErrInvalidTransition},
+		{"o1", StatePickedUp, nil},
+		{"o2", StatePickedUp, ErrInvalidTransition},
+		{"o2", StateCancelled, nil},
+		{"o2", StateReady, ErrOrderAlreadyDequeued},
+		{"o3", StateQueued, ErrInvalidTransition},
+		{"missing", StateReady, ErrOrderNotFound},
+	}
+	for _, tt := range tests {
+		if err := q.TransitionOrder(ctx, "m1", tt.orderID, tt.target); !errors.Is(err, tt.want) {
+			t.Errorf("%s -> %s: %v, want %v", tt.orderID, tt.target, err, tt.want)
+		}
+	}
+
+	live, err := q.ListOrdersByState(ctx, "m1", StateQueued)
+	if err != nil || len(live) != 1 || live[0].OrderID != "o3" {
+		t.Fatalf("queued orders = %+v, %v", live, err)
+	}
+	record, err := q.GetOrderRecord(ctx, "m1", "o1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range []OrderState{StateQueued, StatePreparing, StateReady, StatePickedUp} {
+		if _, ok := record.Transitions[state]; !ok {
+			t.Errorf("transition to %s not recorded: %+v", state, record.Transitions)
+		}
+	}
+	if !record.State.IsTerminal() || record.State.IsLive() {
+		t.Errorf("state = %s", record.State)
+	}
+	// 离开队列的订单不再保留订单所属商家的全局索引
+	for _, id := range []string{"o1", "o2"} {
+		if m.Exists("order_merchant:" + id) {
+			t.Errorf("merchant lookup of %s not removed", id)
+		}
+	}
+	if merchantID, err := q.GetOrderMerchant(ctx, "o3"); err != nil || merchantID != "m1" {
+		t.Errorf("merchant of o3 = %q, %v", merchantID, err)
+	}
+}
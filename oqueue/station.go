@@ -0,0 +1,176 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/open4go/log"
+	"github.com/redis/go-redis/v9"
+	"sort"
+)
+
+// Station 出餐工位，如后厨、吧台、甜品台
+// 订单可按工位拆分为多张小票，各工位独立排队，全部完成后订单才出餐
+type Station string
+
+const (
+	StationKitchen Station = "kitchen" // 后厨
+	StationBar     Station = "bar"     // 吧台(饮品)
+	StationDessert Station = "dessert" // 甜品台
+)
+
+// ErrStationAlreadyCompleted 工位小票已完成
+var ErrStationAlreadyCompleted = errors.New("station ticket already completed")
+
+// StationTicket 工位队列中的小票
+type StationTicket struct {
+	OrderID  string
+	Ticket   string // 订单的取餐号
+	Items    int    // 该工位需制作的商品数
+	Position int64  // 在工位队列中的位置(从0开始)
+}
+
+// stationField 订单哈希中记录工位完成情况的字段，未完成时为 pending，完成后为完成时间(毫秒)
+func stationField(station Station) string {
+	return "station:" + string(station)
+}
+
+// stationList 校验订单的工位拆分并按名称排序返回工位
+func (o OrderInfo) stationList() ([]Station, error) {
+	stations := make([]Station, 0, len(o.Stations))
+	for station, n := range o.Stations {
+		if station == "" || n <= 0 {
+			return nil, fmt.Errorf("invalid station items: %q=%d", station, n)
+		}
+		stations = append(stations, station)
+	}
+	sort.Slice(stations, func(i, j int) bool { return stations[i] < stations[j] })
+	return stations, nil
+}
+
+// stationScript 原子地完成订单某工位的小票，并以该工位的商品数更新工位统计
+// 返回 {0, 订单当前状态, 尚未完成的工位数}
+// KEYS: index, order, 工位队列, 工位统计
+// ARGV: orderID, 工位, now(毫秒), 统计ttl(秒), 统计参数(JSON)
+var stationScript = redis.NewScript(luaDecodeMember + luaUpdateStats + `
+local member = redis.call('HGET', KEYS[1], ARGV[1])
+if not member then
+	return {1, ''}
+end
+local state = redis.call('HGET', KEYS[2], 'state') or 'queued'
+local status = redis.call('HGET', KEYS[2], 'station:' .. ARGV[2])
+if not status then
+	return {1, state}
+end
+if state ~= 'queued' and state ~= 'preparing' then
+	return {2, state}
+end
+if status ~= 'pending' then
+	return {7, state}
+end
+
+local now = tonumber(ARGV[3])
+redis.call('HSET', KEYS[2], 'station:' .. ARGV[2], ARGV[3])
+redis.call('ZREM', KEYS[3], ARGV[1])
+
+local obj = cjson.decode(member)
+local enqueued = math.floor(tonumber(obj.enqueue_at) / 1000000)
+record_sample(KEYS[4], tonumber(obj.stations[ARGV[2]]), enqueued, now, ARGV[4], cjson.decode(ARGV[5]))
+
+local remaining = 0
+for station in pairs(obj.stations) do
+	if redis.call('HGET', KEYS[2], 'station:' .. station) == 'pending' then
+		remaining = remaining + 1
+	end
+end
+return {0, state, remaining}
+`)
+
+// CompleteStation 完成订单某工位的小票，返回订单是否已全部完成
+// 最后一个工位完成时订单流转到 ready，与 CompleteOrder 一样更新商家统计并叫号
+// 订单没有该工位返回 ErrOrderNotFound，工位重复完成返回 ErrStationAlreadyCompleted，订单已出餐返回 ErrOrderAlreadyCompleted
+func (q *QueueSystem) CompleteStation(ctx context.Context, merchantID, orderID string, station Station) (bool, error) {
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return false, err
+	}
+	day, err := q.locateOrder(ctx, merchantID, cfg, orderID)
+	if err != nil {
+		return false, err
+	}
+
+	state, remaining, err := q.store.CompleteStation(ctx, StationRequest{
+		MerchantID: merchantID,
+		Day:        day,
+		OrderID:    orderID,
+		Station:    station,
+		Now:        q.now(),
+		Stats:      q.statsParams(q.merchantNow(cfg)),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	q.publishEvents(ctx, merchantID, QueueEvent{
+		Type:       EventStation,
+		MerchantID: merchantID,
+		OrderID:    orderID,
+		State:      state,
+		Station:    station,
+		Time:       q.now().UnixMilli(),
+	})
+	if remaining > 0 {
+		return false, nil
+	}
+
+	if err := q.TransitionOrder(ctx, merchantID, orderID, StateReady); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// removeStationTickets 订单离开队列后从工位队列中移除尚未完成的小票
+// tickets 为 订单ID -> 工位，失败只记录日志
+func (q *QueueSystem) removeStationTickets(ctx context.Context, merchantID, day string, tickets map[string][]Station) {
+	if err := q.store.RemoveStationTickets(ctx, merchantID, day, tickets); err != nil {
+		log.Log(ctx).Error(err)
+	}
+}
+
+// GetStationQueue 按顺序获取商家当前营业日某工位尚未完成的小票
+func (q *QueueSystem) GetStationQueue(ctx context.Context, merchantID string, station Station) ([]StationTicket, error) {
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	day := q.currentDay(cfg)
+
+	orderIDs, err := q.store.StationQueue(ctx, merchantID, day, station)
+	if err != nil {
+		return nil, err
+	}
+	records, err := q.store.OrderRecords(ctx, merchantID, day, orderIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	tickets := make([]StationTicket, 0, len(records))
+	for _, record := range records {
+		tickets = append(tickets, StationTicket{
+			OrderID:  record.OrderID,
+			Ticket:   record.Ticket,
+			Items:    record.Stations[station],
+			Position: int64(len(tickets)),
+		})
+	}
+	return tickets, nil
+}
+
+// GetStationStats 获取商家某工位的历史统计，按该工位的商品数计算每商品处理时间
+func (q *QueueSystem) GetStationStats(ctx context.Context, merchantID string, station Station) (MerchantStats, error) {
+	fields, err := q.store.StationStats(ctx, merchantID, station)
+	if err != nil {
+		return MerchantStats{}, err
+	}
+	return parseMerchantStats(fields), nil
+}
@@ -0,0 +1,159 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStationList(t *testing.T) {
+	tests := []struct {
+		name     string
+		stations map[Station]int
+		want     []Station
+		wantErr  bool
+	}{
+		{"none", nil, []Station{}, false},
+		{"sorted", map[Station]int{StationKitchen: 2, StationBar: 1, StationDessert: 1}, []Station{StationBar, StationDessert, StationKitchen}, false},
+		{"no items", map[Station]int{StationKitchen: 0}, nil, true},
+		{"empty station", map[Station]int{"": 1}, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := OrderInfo{Stations: tt.stations}.stationList()
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: err = %v", tt.name, err)
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: stations = %v, want %v", tt.name, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: stations = %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestCompleteStation(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+	enqueued := time.Now().Add(-3 * time.Minute)
+	orders := []OrderInfo{
+		{MerchantID: "m1", OrderID: "o1", EnqueueTime: enqueued, Stations: map[Station]int{StationKitchen: 2, StationBar: 1}},
+		{MerchantID: "m1", OrderID: "o2", EnqueueTime: enqueued, Stations: map[Station]int{StationBar: 3}},
+	}
+	for _, order := range orders {
+		if err := q.EnqueueOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.EnqueueOrder(ctx, OrderInfo{MerchantID: "m1", OrderID: "bad", Stations: map[Station]int{StationKitchen: 0}}); err == nil {
+		t.Fatal("enqueued order with empty station")
+	}
+	record, err := q.GetOrderRecord(ctx, "m1", "o1")
+	if err != nil || record.NumOfItems != 3 {
+		t.Fatalf("record = %+v, %v", record, err)
+	}
+	bar, err := q.GetStationQueue(ctx, "m1", StationBar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bar) != 2 || bar[0].OrderID != "o1" || bar[1].Items != 3 || bar[1].Position != 1 || bar[1].Ticket == "" {
+		t.Fatalf("bar queue = %+v", bar)
+	}
+
+	tests := []struct {
+		name      string
+		station   Station
+		wantReady bool
+		wantErr   error
+		wantState OrderState
+	}{
+		{"bar", StationBar, false, nil, StateQueued},
+		{"bar again", StationBar, false, ErrStationAlreadyCompleted, StateQueued},
+		{"station not in order", StationDessert, false, ErrOrderNotFound, StateQueued},
+		{"kitchen", StationKitchen, true, nil, StateReady},
+		{"after ready", StationKitchen, false, ErrOrderAlreadyCompleted, StateReady},
+	}
+	for _, tt := range tests {
+		ready, err := q.CompleteStation(ctx, "m1", "o1", tt.station)
+		if ready != tt.wantReady || !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: ready = %v, err = %v", tt.name, ready, err)
+		}
+		record, err := q.GetOrderRecord(ctx, "m1", "o1")
+		if err != nil || record.State != tt.wantState {
+			t.Fatalf("%s: record = %+v, %v", tt.name, record, err)
+		}
+	}
+
+	if stats, err := q.GetStationStats(ctx, "m1", StationBar); err != nil || stats.ProcessedOrders != 1 {
+		t.Fatalf("bar stats = %d, %v", stats.ProcessedOrders, err)
+	}
+	if stats, err := q.GetMerchantStats(ctx, "m1"); err != nil || stats.ProcessedOrders != 1 {
+		t.Fatalf("merchant stats = %d, %v", stats.ProcessedOrders, err)
+	}
+
+	// 取消订单同时移除其未完成的工位小票
+	if err := q.CancelOrder(ctx, "m1", "o2"); err != nil {
+		t.Fatal(err)
+	}
+	if bar, err := q.GetStationQueue(ctx, "m1", StationBar); err != nil || len(bar) != 0 {
+		t.Fatalf("bar queue after cancel = %+v, %v", bar, err)
+	}
+}
+
+func TestReorderStations(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+	orders := []OrderInfo{
+		{MerchantID: "m1", OrderID: "o1", Stations: map[Station]int{StationKitchen: 1, StationBar: 1}},
+		{MerchantID: "m1", OrderID: "o2", Stations: map[Station]int{StationBar: 2}},
+		{MerchantID: "m1", OrderID: "o3", Stations: map[Station]int{StationKitchen: 1, StationBar: 1}},
+		{MerchantID: "m1", OrderID: "o4", NumOfItems: 1},
+	}
+	for _, order := range orders {
+		if err := q.EnqueueOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stationQueue := func(station Station) string {
+		tickets, err := q.GetStationQueue(ctx, "m1", station)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]string, len(tickets))
+		for i, ticket := range tickets {
+			ids[i] = ticket.OrderID
+		}
+		return strings.Join(ids, ",")
+	}
+
+	// 工位队列与主队列保持相同的相对顺序，已完成的小票不会重新加入工位队列
+	tests := []struct {
+		name         string
+		op           func() error
+		kitchen, bar string
+	}{
+		{"front", func() error { return q.MoveToFront(ctx, "m1", "o3", "alice") }, "o3,o1", "o3,o1,o2"},
+		{"before", func() error { return q.MoveBefore(ctx, "m1", "o2", "o3", "alice") }, "o3,o1", "o2,o3,o1"},
+		{"hold", func() error { return q.Hold(ctx, "m1", "o2", "alice") }, "o3,o1", "o3,o1,o2"},
+		{"defer", func() error { return q.Defer(ctx, "m1", "o3", time.Hour, "alice") }, "o1,o3", "o1,o3,o2"},
+		{"release", func() error { return q.Release(ctx, "m1", "o2", "alice") }, "o1,o3", "o2,o1,o3"},
+		{"complete bar", func() error {
+			_, err := q.CompleteStation(ctx, "m1", "o1", StationBar)
+			return err
+		}, "o1,o3", "o2,o3"},
+		{"front after bar", func() error { return q.MoveToFront(ctx, "m1", "o1", "alice") }, "o1,o3", "o2,o3"},
+		{"before no stations", func() error { return q.MoveBefore(ctx, "m1", "o4", "o2", "alice") }, "o1,o3", "o2,o3"},
+	}
+	for _, tt := range tests {
+		if err := tt.op(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if kitchen, bar := stationQueue(StationKitchen), stationQueue(StationBar); kitchen != tt.kitchen || bar != tt.bar {
+			t.Fatalf("%s: kitchen = %s, bar = %s, want %s, %s", tt.name, kitchen, bar, tt.kitchen, tt.bar)
+		}
+	}
+}
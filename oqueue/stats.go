@@ -0,0 +1,224 @@
+package oqueue
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ewmaItemTimeKey = "ewma_item_time"     // 指数加权平均每商品处理时间(毫秒)
+	m2ItemTimeKey   = "m2_item_time"       // 衰减加权平方差和，用于计算方差
+	sampleWeightKey = "sample_weight"      // 衰减后的样本权重
+	rejectedKey     = "rejected_orders"    // 被判定为异常而未计入统计的订单数
+	histField       = "hist"               // 直方图桶 hist:<桶序号>
+	accuracyKey     = "accuracy_weight"    // 衰减后已对比预估的订单数
+	maeKey          = "mae_ms"             // 预估平均绝对误差(毫秒)
+	biasKey         = "bias_ms"            // 预估平均误差(毫秒)，正数表示低估
+	calWeightKey    = "calibration_weight" // 衰减后参与缓冲系数校准的订单数
+	calBufferKey    = "calibrated_buffer"  // 校准后的缓冲系数
+	ewmaAlpha       = 0.2                  // 指数加权平滑系数，越大越偏重近期订单
+	histOverflowMul = 2                    // 溢出桶上界相对最后一个边界的倍数
+)
+
+// itemTimeBuckets 每商品处理时间直方图的桶上界
+// 最后还有一个溢出桶
+var itemTimeBuckets = []time.Duration{
+	10 * time.Second,
+	20 * time.Second,
+	30 * time.Second,
+	45 * time.Second,
+	1 * time.Minute,
+	90 * time.Second,
+	2 * time.Minute,
+	3 * time.Minute,
+	4 * time.Minute,
+	5 * time.Minute,
+	7 * time.Minute,
+	10 * time.Minute,
+	15 * time.Minute,
+	20 * time.Minute,
+	30 * time.Minute,
+}
+
+// StatsPolicy 商家统计策略
+type StatsPolicy struct {
+	HalfLife         time.Duration // 样本权重衰减一半所需的时间
+	MaxOrderDuration time.Duration // 超过该处理时长的订单视为异常(如隔夜未完成)
+	MinItemTime      time.Duration // 低于该每商品时间的订单视为异常(如误操作立即完成)
+	OutlierSigma     float64       // 每商品时间超过 均值+N倍标准差 视为异常，0表示不检查
+	MinSamples       float64       // 样本权重达到该值后才做标准差检查
+}
+
+// defaultStatsPolicy 默认统计策略
+var defaultStatsPolicy = StatsPolicy{
+	HalfLife:         7 * 24 * time.Hour,
+	MaxOrderDuration: 2 * time.Hour,
+	MinItemTime:      time.Second,
+	OutlierSigma:     4,
+	MinSamples:       20,
+}
+
+// StatsParams 出餐时更新商家统计所需的参数，由 QueueSystem 根据 StatsPolicy 生成
+// 时间均为毫秒；Redis 实现以JSON传给脚本
+type StatsParams struct {
+	Hour       int     `json:"hour"`        // 商家所在时区的当前小时，用于分时段统计
+	Alpha      float64 `json:"alpha"`       // 指数加权平滑系数
+	HalfLife   int64   `json:"half_life"`   // 样本权重半衰期
+	MaxOrder   int64   `json:"max_order"`   // 超过该处理时长的订单视为异常
+	MinItem    int64   `json:"min_item"`    // 低于该每商品时间的订单视为异常
+	Sigma      float64 `json:"sigma"`       // 标准差检查倍数，0表示不检查
+	MinSamples float64 `json:"min_samples"` // 做标准差检查所需的样本权重
+	BucketsMs  []int64 `json:"buckets"`     // 直方图桶上界
+}
+
+// statsParams 生成统计参数，now 为商家所在时区的当前时间
+func (q *QueueSystem) statsParams(now time.Time) StatsParams {
+	params := StatsParams{
+		Hour:       now.Hour(),
+		Alpha:      ewmaAlpha,
+		HalfLife:   q.statsPolicy.HalfLife.Milliseconds(),
+		MaxOrder:   q.statsPolicy.MaxOrderDuration.Milliseconds(),
+		MinItem:    q.statsPolicy.MinItemTime.Milliseconds(),
+		Sigma:      q.statsPolicy.OutlierSigma,
+		MinSamples: q.statsPolicy.MinSamples,
+	}
+	for _, b := range itemTimeBuckets {
+		params.BucketsMs = append(params.BucketsMs, b.Milliseconds())
+	}
+	return params
+}
+
+// MerchantStats 商家历史统计
+type MerchantStats struct {
+	AvgItemTime     time.Duration         // 平均每商品处理时间(随时间衰减)
+	ProcessedOrders int64                 // 已处理订单数
+	EWMAItemTime    time.Duration         // 指数加权平均每商品处理时间
+	HourlyItemTime  map[int]time.Duration // 各小时平均每商品处理时间
+	HourlyOrders    map[int]int64         // 各小时已处理订单数
+
+	StdDevItemTime time.Duration // 每商品处理时间标准差
+	P50ItemTime    time.Duration // 每商品处理时间中位数
+	P90ItemTime    time.Duration // 每商品处理时间P90
+	SampleWeight   float64       // 衰减后的有效样本数
+	RejectedOrders int64         // 被判定为异常的订单数
+	Histogram      []float64     // 每商品处理时间直方图(衰减后权重)，桶上界见 ItemTimeBuckets
+
+	EstimatedOrders   float64       // 衰减后已对比预估与实际等待时间的订单数
+	MeanAbsError      time.Duration // 入队预估与实际等待时间的平均绝对误差
+	Bias              time.Duration // 平均误差(实际-预估)，正数表示整体低估
+	CalibrationWeight float64       // 衰减后参与缓冲系数校准的订单数
+	CalibratedBuffer  float64       // 使预估无偏的缓冲系数
+}
+
+// ItemTimeBuckets 每商品处理时间直方图的桶上界，最后一个桶为溢出桶
+func ItemTimeBuckets() []time.Duration {
+	return append([]time.Duration(nil), itemTimeBuckets...)
+}
+
+// Percentile 根据直方图计算每商品处理时间的分位数，p 取值 0~1
+func (s MerchantStats) Percentile(p float64) time.Duration {
+	var total float64
+	for _, w := range s.Histogram {
+		total += w
+	}
+	if total <= 0 {
+		return 0
+	}
+
+	target := p * total
+	var cumulative float64
+	for i, w := range s.Histogram {
+		if w <= 0 {
+			continue
+		}
+		lower, upper := bucketBounds(i)
+		if cumulative+w >= target {
+			// 桶内线性插值
+			frac := (target - cumulative) / w
+			return (lower + time.Duration(frac*float64(upper-lower))).Round(time.Millisecond)
+		}
+		cumulative += w
+	}
+
+	_, upper := bucketBounds(len(s.Histogram) - 1)
+	return upper
+}
+
+// bucketBounds 获取第 i 个桶的上下界
+func bucketBounds(i int) (lower, upper time.Duration) {
+	if i > 0 {
+		lower = itemTimeBuckets[i-1]
+	}
+	if i < len(itemTimeBuckets) {
+		return lower, itemTimeBuckets[i]
+	}
+	return lower, lower * histOverflowMul
+}
+
+// GetMerchantStats 获取商家历史统计数据
+func (q *QueueSystem) GetMerchantStats(ctx context.Context, merchantID string) (MerchantStats, error) {
+	fields, err := q.store.MerchantStats(ctx, merchantID)
+	if err != nil {
+		return MerchantStats{}, err
+	}
+	return parseMerchantStats(fields), nil
+}
+
+// parseMerchantStats 解析商家统计哈希
+func parseMerchantStats(fields map[string]string) MerchantStats {
+	stats := MerchantStats{
+		AvgItemTime:    parseMillis(fields[itemProcessTimeKey]),
+		EWMAItemTime:   parseMillis(fields[ewmaItemTimeKey]),
+		HourlyItemTime: make(map[int]time.Duration),
+		HourlyOrders:   make(map[int]int64),
+		Histogram:      make([]float64, len(itemTimeBuckets)+1),
+	}
+	stats.ProcessedOrders, _ = strconv.ParseInt(fields[orderCountKey], 10, 64)
+	stats.RejectedOrders, _ = strconv.ParseInt(fields[rejectedKey], 10, 64)
+	stats.SampleWeight, _ = strconv.ParseFloat(fields[sampleWeightKey], 64)
+	stats.EstimatedOrders, _ = strconv.ParseFloat(fields[accuracyKey], 64)
+	stats.MeanAbsError = parseMillis(fields[maeKey])
+	stats.Bias = parseMillis(fields[biasKey])
+	stats.CalibrationWeight, _ = strconv.ParseFloat(fields[calWeightKey], 64)
+	stats.CalibratedBuffer, _ = strconv.ParseFloat(fields[calBufferKey], 64)
+
+	if m2, err := strconv.ParseFloat(fields[m2ItemTimeKey], 64); err == nil && stats.SampleWeight > 0 {
+		stats.StdDevItemTime = time.Duration(math.Sqrt(m2/stats.SampleWeight) * float64(time.Millisecond))
+	}
+
+	// 分时段统计字段: avg_item_time:<hour>, processed_orders:<hour>
+	// 直方图字段: hist:<桶序号>，序号从1开始
+	for field, value := range fields {
+		name, suffix, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(suffix)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case itemProcessTimeKey:
+			stats.HourlyItemTime[n] = parseMillis(value)
+		case orderCountKey:
+			stats.HourlyOrders[n], _ = strconv.ParseInt(value, 10, 64)
+		case histField:
+			if n >= 1 && n <= len(stats.Histogram) {
+				stats.Histogram[n-1], _ = strconv.ParseFloat(value, 64)
+			}
+		}
+	}
+
+	stats.P50ItemTime = stats.Percentile(0.5)
+	stats.P90ItemTime = stats.Percentile(0.9)
+	return stats
+}
+
+// parseMillis 解析毫秒数
+func parseMillis(s string) time.Duration {
+	ms, _ := strconv.ParseFloat(s, 64)
+	return time.Duration(ms * float64(time.Millisecond))
+}
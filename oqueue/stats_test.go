@@ -0,0 +1,99 @@
+package oqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	histogram := func(weights map[int]float64) []float64 {
+		h := make([]float64, len(itemTimeBuckets)+1)
+		for i, w := range weights {
+			h[i] = w
+		}
+		return h
+	}
+	tests := []struct {
+		name      string
+		histogram []float64
+		p         float64
+		want      time.Duration
+	}{
+		{"empty", histogram(nil), 0.5, 0},
+		{"single bucket median", histogram(map[int]float64{4: 2}), 0.5, 52500 * time.Millisecond},
+		{"first bucket", histogram(map[int]float64{0: 1, 2: 1}), 0.5, 10 * time.Second},
+		{"interpolated p90", histogram(map[int]float64{0: 1, 2: 1}), 0.9, 28 * time.Second},
+		{"overflow bucket", histogram(map[int]float64{len(itemTimeBuckets): 1}), 0.5, 45 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := (MerchantStats{Histogram: tt.histogram}).Percentile(tt.p); got != tt.want {
+			t.Errorf("%s: Percentile(%v) = %v, want %v", tt.name, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestParseMerchantStats(t *testing.T) {
+	stats := parseMerchantStats(map[string]string{
+		itemProcessTimeKey:        "60000",
+		orderCountKey:             "4",
+		sampleWeightKey:           "4",
+		m2ItemTimeKey:             "3600000000",
+		itemProcessTimeKey + ":9": "30000",
+		orderCountKey + ":9":      "3",
+		histField + ":5":          "4",
+		rejectedKey:               "1",
+	})
+	tests := []struct {
+		name      string
+		got, want time.Duration
+	}{
+		{"avg", stats.AvgItemTime, time.Minute},
+		{"stddev", stats.StdDevItemTime, 30 * time.Second},
+		{"hourly", stats.HourlyItemTime[9], 30 * time.Second},
+		{"p50", stats.P50ItemTime, 52500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+	if stats.ProcessedOrders != 4 || stats.HourlyOrders[9] != 3 || stats.RejectedOrders != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestStatsOutliers(t *testing.T) {
+	ctx := context.Background()
+	policy := StatsPolicy{HalfLife: time.Hour, MaxOrderDuration: time.Hour, MinItemTime: 30 * time.Second}
+	q, _ := newTestQueue(t, WithStatsPolicy(policy))
+
+	tests := []struct {
+		orderID   string
+		items     int
+		took      time.Duration
+		processed int64
+		rejected  int64
+	}{
+		{"normal", 2, 4 * time.Minute, 1, 0},
+		{"too fast", 2, 20 * time.Second, 1, 1},
+		{"overnight", 1, 2 * time.Hour, 1, 2},
+		{"normal again", 1, 2 * time.Minute, 2, 2},
+	}
+	for _, tt := range tests {
+		order := OrderInfo{MerchantID: "m1", OrderID: tt.orderID, NumOfItems: tt.items, EnqueueTime: time.Now().Add(-tt.took)}
+		if err := q.EnqueueOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.CompleteMerchantOrder(ctx, "m1", tt.orderID); err != nil {
+			t.Fatal(err)
+		}
+		stats, err := q.GetMerchantStats(ctx, "m1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.ProcessedOrders != tt.processed || stats.RejectedOrders != tt.rejected {
+			t.Fatalf("%s: processed = %d, rejected = %d", tt.orderID, stats.ProcessedOrders, stats.RejectedOrders)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package oqueue
+
+import (
+	"context"
+	"time"
+)
+
+// Store 队列存储
+// 队列数据按商家、营业日(2006-01-02)划分；订单状态与统计以字段表保存，
+// 字段名与 Redis 实现中的哈希字段一致，由 QueueSystem 统一解析。
+// Enqueue、Transition、Reorder、CompleteStation 须原子执行，所有方法须可并发调用
+// Reorder 须同时调整订单在各工位队列中尚未完成的小票，使工位顺序与主队列一致
+type Store interface {
+	// GetConfig 获取商家配置，未配置时返回零值
+	GetConfig(ctx context.Context, merchantID string) (MerchantConfig, error)
+	// SetConfig 保存商家配置
+	SetConfig(ctx context.Context, merchantID string, cfg MerchantConfig) error
+
+	// Enqueue 批量入队，结果与 reqs 一一对应；订单当天已存在时返回对应的状态错误，指定的取餐号已被占用时返回 ErrTicketTaken
+	Enqueue(ctx context.Context, reqs []EnqueueRequest) ([]EnqueueResult, error)
+	// Transition 批量流转订单状态，结果与 reqs 一一对应
+	Transition(ctx context.Context, reqs []TransitionRequest) ([]TransitionResult, error)
+	// Reorder 人工调整订单顺序并记录审计
+	Reorder(ctx context.Context, req ReorderRequest) error
+	// CompleteStation 完成订单某工位的小票，返回订单当前状态及尚未完成的工位数
+	CompleteStation(ctx context.Context, req StationRequest) (OrderState, int, error)
+
+	// LocateOrders 按 days 的顺序查找订单所在的营业日，找不到的订单不包含在返回值中
+	LocateOrders(ctx context.Context, merchantID string, days []string, orderIDs []string) (map[string]string, error)
+	// OrderRecords 批量获取订单记录，不存在的订单会被跳过
+	OrderRecords(ctx context.Context, merchantID, day string, orderIDs []string) ([]*OrderRecord, error)
+	// QueuePosition 获取订单在队列中的位置，订单不在队列中时返回 ErrOrderNotFound
+	QueuePosition(ctx context.Context, merchantID, day, orderID string) (int64, *OrderInfo, error)
+	// QueueOrders 按队列顺序获取区间 [start, stop] 内的订单，stop 为 -1 表示到队尾
+	QueueOrders(ctx context.Context, merchantID, day string, start, stop int64) ([]OrderInfo, error)
+	// StateOrders 按进入状态的先后获取处于某状态的订单ID，until 非零时只返回在此之前进入该状态的订单
+	StateOrders(ctx context.Context, merchantID, day string, state OrderState, until time.Time) ([]string, error)
+	// Snapshot 原子读取商家某营业日的队列看板数据，since 为统计出餐速率的起始时间
+	Snapshot(ctx context.Context, merchantID, day string, since time.Time) (*SnapshotData, error)
+	// SetEnqueueEstimates 批量记录订单入队时的位置与预估等待时间
+	SetEnqueueEstimates(ctx context.Context, merchantID, day string, estimates []EnqueueEstimate) error
+
+	// LaneStats 获取当天各通道的到达统计(since、count:<通道>、items:<通道>)
+	LaneStats(ctx context.Context, merchantID, day string) (map[string]string, error)
+	// MerchantStats 获取商家统计字段
+	MerchantStats(ctx context.Context, merchantID string) (map[string]string, error)
+	// StationStats 获取商家某工位的统计字段
+	StationStats(ctx context.Context, merchantID string, station Station) (map[string]string, error)
+
+	// TicketOrder 通过取餐号查找订单ID，找不到时返回 ErrOrderNotFound
+	TicketOrder(ctx context.Context, merchantID, day, ticket string) (string, error)
+	// NowServing 获取各前缀最近叫到的取餐号
+	NowServing(ctx context.Context, merchantID, day string) (map[string]string, error)
+	// StationQueue 按顺序获取某工位尚未完成的订单ID
+	StationQueue(ctx context.Context, merchantID, day string, station Station) ([]string, error)
+	// RemoveStationTickets 从工位队列中移除小票，tickets 为 订单ID -> 工位
+	RemoveStationTickets(ctx context.Context, merchantID, day string, tickets map[string][]Station) error
+
+	// ArchiveOrders 追加清空队列时归档的订单
+	ArchiveOrders(ctx context.Context, merchantID, day string, orders []ArchivedOrder) error
+	// ArchivedOrders 获取归档的订单
+	ArchivedOrders(ctx context.Context, merchantID, day string) ([]ArchivedOrder, error)
+	// MoveRecords 获取人工调整顺序的审计记录
+	MoveRecords(ctx context.Context, merchantID, day string) ([]MoveRecord, error)
+
+	// OrderMerchant 通过全局索引查找订单所属的商家，找不到时返回 ErrOrderNotFound
+	OrderMerchant(ctx context.Context, orderID string) (string, error)
+	// SetOrderMerchants 写入订单所属商家的全局索引
+	SetOrderMerchants(ctx context.Context, orders []OrderInfo) error
+	// ReleaseOrderMerchants 删除订单所属商家的全局索引，订单ID已被其他商家复用时保留
+	ReleaseOrderMerchants(ctx context.Context, merchantID string, orderIDs []string) error
+	// Schedule 保存预约订单，订单已预约时返回 ErrOrderAlreadyScheduled
+	Schedule(ctx context.Context, order ScheduledOrder) error
+	// ScheduledOrders 按放入时间顺序获取 until 之前放入的预约订单，until 为零时返回全部
+	ScheduledOrders(ctx context.Context, merchantID string, until time.Time) ([]ScheduledOrder, error)
+	// Unschedule 移除预约订单，订单不存在时返回 ErrOrderNotFound
+	Unschedule(ctx context.Context, merchantID, orderID string) error
+	// ScheduledMerchants 获取最晚放入时间在 since 之后的商家，并移除更早的商家
+	ScheduledMerchants(ctx context.Context, since time.Time) ([]string, error)
+
+	// MarkActive 记录商家最近的入队时间
+	MarkActive(ctx context.Context, merchantIDs []string, at time.Time) error
+	// ActiveMerchants 获取 since 之后有订单入队的商家，并移除更早的商家
+	ActiveMerchants(ctx context.Context, since time.Time) ([]string, error)
+
+	// Publish 发布商家队列事件
+	Publish(ctx context.Context, merchantID string, events []QueueEvent) error
+	// Subscribe 订阅商家队列事件，返回时订阅已生效
+	Subscribe(ctx context.Context, merchantID string) (Subscription, error)
+}
+
+// Subscription 队列事件订阅
+type Subscription interface {
+	// Events 事件通道，订阅关闭后通道关闭
+	Events() <-chan QueueEvent
+	// Close 取消订阅
+	Close() error
+}
+
+// EnqueueRequest 入队请求，商家为 Order.MerchantID
+type EnqueueRequest struct {
+	Day          string
+	Order        OrderInfo // 已填充默认值；Ticket 非空时沿用该取餐号
+	Score        int64     // 队列分数，见 laneScore
+	TicketPrefix string    // 取餐号前缀，为空时不分配
+	Stations     []Station // 订单拆分到的工位，按名称排序
+	Now          time.Time
+}
+
+// EnqueueResult 入队结果
+type EnqueueResult struct {
+	Ticket   string // 分配或沿用的取餐号
+	Position int64  // 入队后在队列中的位置
+	Err      error
+}
+
+// TransitionRequest 状态流转请求
+type TransitionRequest struct {
+	MerchantID string
+	Day        string
+	OrderID    string
+	Target     OrderState
+	Allowed    []OrderState // 允许的来源状态
+	Now        time.Time
+	Stats      StatsParams // 流转到 ready 时更新统计的参数
+}
+
+// TransitionResult 状态流转结果
+type TransitionResult struct {
+	Previous OrderState // 流转前的状态
+	Pending  []Station  // 离开队列时尚未完成的工位
+	Position int64      // 离开队列时的位置，未离开队列或不在队列中时为-1
+	Err      error
+}
+
+// EnqueueEstimate 订单入队时的位置与预估等待时间
+type EnqueueEstimate struct {
+	OrderID  string
+	Position int64
+	Estimate WaitEstimate
+}
+
+// ReorderRequest 调整顺序请求
+type ReorderRequest struct {
+	MerchantID string
+	Day        string
+	OrderID    string
+	Action     MoveAction
+	OtherID    string        // MoveActionBefore 的参照订单
+	Defer      time.Duration // MoveActionDefer 延后的时长
+	Operator   string
+	Now        time.Time
+}
+
+// StationRequest 完成工位小票请求
+type StationRequest struct {
+	MerchantID string
+	Day        string
+	OrderID    string
+	Station    Station
+	Now        time.Time
+	Stats      StatsParams
+}
+
+// SnapshotData 队列看板所需的原始数据
+type SnapshotData struct {
+	Orders       []*OrderRecord    // 队列中的订单，按队列顺序
+	Completed    int               // 已出餐(含已取餐)的订单数
+	RecentOrders int               // since 之后出餐的订单数
+	RecentItems  int               // since 之后出餐的商品数
+	Stats        map[string]string // 商家统计字段
+	Lanes        map[string]string // 当天各通道的到达统计
+	Scheduled    []ScheduledOrder  // 尚未放入队列的预约订单，按放入时间排序
+}
@@ -0,0 +1,1171 @@
+package oqueue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/open4go/log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const memoryEventBuffer = 100 // 内存订阅的事件缓冲，写满后丢弃新事件
+
+// MemoryStore 基于内存的队列存储，适用于测试、本地开发和单实例部署
+// 数据不持久化，也不能在多个进程间共享；行为与 RedisStore 一致，
+// 营业日数据与统计同样在 defaultExpiration、statsExpiration 后过期
+type MemoryStore struct {
+	mu       sync.Mutex
+	configs  map[string]MerchantConfig
+	days     map[memoryDayKey]*memoryDay
+	archives map[memoryDayKey]*memoryArchive
+	stats    map[string]*memoryStats // 商家统计，工位统计的key为 <merchantID>:station:<工位>
+	active   map[string]time.Time
+	subs     map[string]map[*memorySubscription]struct{}
+	lookups  map[string]*memoryLookup // 订单ID -> 所属商家的全局索引
+
+	scheduled          map[string]map[string]ScheduledOrder // 商家 -> 订单ID -> 预约订单
+	scheduledMerchants map[string]time.Time                 // 商家 -> 最晚放入时间
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		configs:  make(map[string]MerchantConfig),
+		days:     make(map[memoryDayKey]*memoryDay),
+		archives: make(map[memoryDayKey]*memoryArchive),
+		stats:    make(map[string]*memoryStats),
+		active:   make(map[string]time.Time),
+		subs:     make(map[string]map[*memorySubscription]struct{}),
+		lookups:  make(map[string]*memoryLookup),
+
+		scheduled:          make(map[string]map[string]ScheduledOrder),
+		scheduledMerchants: make(map[string]time.Time),
+	}
+}
+
+// memoryDayKey 商家营业日
+type memoryDayKey struct {
+	merchantID string
+	day        string
+}
+
+// memoryDay 商家某营业日的队列数据，对应 Redis 中同一营业日的各个key
+type memoryDay struct {
+	queue         map[string]float64 // 队列中的订单ID -> 分数
+	orders        map[string]*memoryOrder
+	states        map[OrderState]map[string]int64 // 状态 -> 订单ID -> 进入该状态的时间(毫秒)
+	lanes         map[string]string               // 通道到达统计，字段同 Redis
+	tickets       map[string]int64                // 各前缀的发号序列
+	serving       map[string]string               // 各前缀最近叫到的取餐号
+	ticketIndex   map[string]string               // 取餐号 -> 订单ID
+	stationQueues map[Station]map[string]float64
+	moves         []MoveRecord
+	expireAt      time.Time
+}
+
+// memoryOrder 订单信息及状态字段，字段同 Redis 订单哈希
+type memoryOrder struct {
+	info   OrderInfo
+	fields map[string]string
+}
+
+// memoryArchive 清空队列时归档的订单，与统计一样保留 statsExpiration
+type memoryArchive struct {
+	orders   []ArchivedOrder
+	expireAt time.Time
+}
+
+// memoryStats 统计字段，字段同 Redis 统计哈希
+type memoryStats struct {
+	fields   map[string]string
+	expireAt time.Time
+}
+
+// memoryLookup 订单所属商家的全局索引，与 Redis 一样保留 defaultExpiration
+type memoryLookup struct {
+	merchantID string
+	expireAt   time.Time
+}
+
+// newMemoryDay 创建营业日数据
+func newMemoryDay() *memoryDay {
+	return &memoryDay{
+		queue:         make(map[string]float64),
+		orders:        make(map[string]*memoryOrder),
+		states:        make(map[OrderState]map[string]int64),
+		lanes:         make(map[string]string),
+		tickets:       make(map[string]int64),
+		serving:       make(map[string]string),
+		ticketIndex:   make(map[string]string),
+		stationQueues: make(map[Station]map[string]float64),
+	}
+}
+
+// day 获取营业日数据，不存在时返回 nil
+func (s *MemoryStore) day(merchantID, day string) *memoryDay {
+	return s.days[memoryDayKey{merchantID, day}]
+}
+
+// writeDay 获取营业日数据用于写入，不存在时创建，并刷新过期时间
+func (s *MemoryStore) writeDay(merchantID, day string, now time.Time) *memoryDay {
+	key := memoryDayKey{merchantID, day}
+	d, ok := s.days[key]
+	if !ok {
+		d = newMemoryDay()
+		s.days[key] = d
+	}
+	d.expireAt = now.Add(defaultExpiration)
+	return d
+}
+
+// writeStats 获取统计字段用于写入，并刷新过期时间
+func (s *MemoryStore) writeStats(key string, now time.Time) map[string]string {
+	st, ok := s.stats[key]
+	if !ok {
+		st = &memoryStats{fields: make(map[string]string)}
+		s.stats[key] = st
+	}
+	st.expireAt = now.Add(statsExpiration)
+	return st.fields
+}
+
+// readStats 复制统计字段
+func (s *MemoryStore) readStats(key string) map[string]string {
+	fields := make(map[string]string)
+	if st, ok := s.stats[key]; ok {
+		for k, v := range st.fields {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// stationStatsKey 工位统计的key
+func stationStatsKey(merchantID string, station Station) string {
+	return merchantID + ":station:" + string(station)
+}
+
+// expire 删除已过期的数据
+func (s *MemoryStore) expire(now time.Time) {
+	for key, d := range s.days {
+		if now.After(d.expireAt) {
+			delete(s.days, key)
+		}
+	}
+	for key, a := range s.archives {
+		if now.After(a.expireAt) {
+			delete(s.archives, key)
+		}
+	}
+	for key, st := range s.stats {
+		if now.After(st.expireAt) {
+			delete(s.stats, key)
+		}
+	}
+	for orderID, l := range s.lookups {
+		if now.After(l.expireAt) {
+			delete(s.lookups, orderID)
+		}
+	}
+}
+
+// state 订单当前状态，没有状态字段时视为排队中
+func (o *memoryOrder) state() OrderState {
+	if state, ok := o.fields["state"]; ok {
+		return OrderState(state)
+	}
+	return StateQueued
+}
+
+// ranked 按分数排序的订单ID，分数相同时按订单ID排序
+func ranked(scores map[string]float64) []string {
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] < scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// rank 订单在队列中的位置
+func rank(scores map[string]float64, orderID string) (int64, bool) {
+	if _, ok := scores[orderID]; !ok {
+		return 0, false
+	}
+	for i, id := range ranked(scores) {
+		if id == orderID {
+			return int64(i), true
+		}
+	}
+	return 0, false
+}
+
+// formatNumber 按 Redis 保存数字的方式格式化
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// parseNumber 解析数字字段，字段不存在或无效时 ok 为 false
+func parseNumber(fields map[string]string, field string) (float64, bool) {
+	v, err := strconv.ParseFloat(fields[field], 64)
+	return v, err == nil
+}
+
+// cloneOrderInfo 复制订单信息，避免调用方修改存储中的数据
+func cloneOrderInfo(info OrderInfo) OrderInfo {
+	if info.Stations != nil {
+		stations := make(map[Station]int, len(info.Stations))
+		for station, n := range info.Stations {
+			stations[station] = n
+		}
+		info.Stations = stations
+	}
+	return info
+}
+
+// GetConfig 获取商家配置，未配置时返回零值
+func (s *MemoryStore) GetConfig(ctx context.Context, merchantID string) (MerchantConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.configs[merchantID], nil
+}
+
+// SetConfig 保存商家配置，以JSON复制一份，避免与调用方共享 map
+func (s *MemoryStore) SetConfig(ctx context.Context, merchantID string, cfg MerchantConfig) error {
+	payload, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to encode merchant config: %v", err)
+	}
+	var saved MerchantConfig
+	if err := json.Unmarshal(payload, &saved); err != nil {
+		return fmt.Errorf("invalid merchant config: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configs[merchantID] = saved
+	return nil
+}
+
+// Enqueue 批量入队，每个订单的入队与 Redis 脚本一样原子执行
+func (s *MemoryStore) Enqueue(ctx context.Context, reqs []EnqueueRequest) ([]EnqueueResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]EnqueueResult, len(reqs))
+	for i, req := range reqs {
+		s.expire(req.Now)
+		results[i] = s.enqueue(req)
+	}
+	return results, nil
+}
+
+// enqueue 入队单个订单，返回分配的取餐号及入队后的位置
+func (s *MemoryStore) enqueue(req EnqueueRequest) EnqueueResult {
+	order := cloneOrderInfo(req.Order)
+	if d := s.day(order.MerchantID, req.Day); d != nil {
+		if existing, ok := d.orders[order.OrderID]; ok {
+			return EnqueueResult{Err: stateError(existing.state(), StateQueued)}
+		}
+	}
+
+	d := s.writeDay(order.MerchantID, req.Day, req.Now)
+	if _, ok := d.ticketIndex[order.Ticket]; order.Ticket != "" && ok {
+		return EnqueueResult{Err: ErrTicketTaken}
+	}
+	now := req.Now.UnixMilli()
+	nowStr := strconv.FormatInt(now, 10)
+
+	// 自动分配时跳过已被指定占用的取餐号
+	for taken := req.TicketPrefix != ""; taken; {
+		d.tickets[req.TicketPrefix]++
+		order.Ticket = fmt.Sprintf("%s%03d", req.TicketPrefix, d.tickets[req.TicketPrefix])
+		_, taken = d.ticketIndex[order.Ticket]
+	}
+
+	fields := map[string]string{"state": string(StateQueued), "queued_at": nowStr}
+	d.orders[order.OrderID] = &memoryOrder{info: order, fields: fields}
+	d.queue[order.OrderID] = float64(req.Score)
+	d.setState(order.OrderID, StateQueued, now)
+
+	lane := string(order.Lane)
+	count, _ := strconv.ParseInt(d.lanes["count:"+lane], 10, 64)
+	items, _ := strconv.ParseInt(d.lanes["items:"+lane], 10, 64)
+	d.lanes["count:"+lane] = strconv.FormatInt(count+1, 10)
+	d.lanes["items:"+lane] = strconv.FormatInt(items+int64(order.NumOfItems), 10)
+	if _, ok := d.lanes["since"]; !ok {
+		d.lanes["since"] = nowStr
+	}
+
+	if order.Ticket != "" {
+		fields["ticket"] = order.Ticket
+		d.ticketIndex[order.Ticket] = order.OrderID
+	}
+	for _, station := range req.Stations {
+		if d.stationQueues[station] == nil {
+			d.stationQueues[station] = make(map[string]float64)
+		}
+		d.stationQueues[station][order.OrderID] = float64(req.Score)
+		fields[stationField(station)] = "pending"
+	}
+	position, _ := rank(d.queue, order.OrderID)
+	return EnqueueResult{Ticket: order.Ticket, Position: position}
+}
+
+// setState 将订单加入状态集合
+func (d *memoryDay) setState(orderID string, state OrderState, at int64) {
+	if d.states[state] == nil {
+		d.states[state] = make(map[string]int64)
+	}
+	d.states[state][orderID] = at
+}
+
+// Transition 批量流转订单状态，每个订单的流转与 Redis 脚本一样原子执行
+func (s *MemoryStore) Transition(ctx context.Context, reqs []TransitionRequest) ([]TransitionResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]TransitionResult, len(reqs))
+	for i, req := range reqs {
+		results[i] = s.transition(req)
+	}
+	return results, nil
+}
+
+// transition 流转单个订单，返回流转前的状态、离开队列时尚未完成的工位及离开时的位置
+func (s *MemoryStore) transition(req TransitionRequest) TransitionResult {
+	d := s.day(req.MerchantID, req.Day)
+	if d == nil || d.orders[req.OrderID] == nil {
+		return TransitionResult{Err: ErrOrderNotFound}
+	}
+	order := d.orders[req.OrderID]
+
+	current := order.state()
+	allowed := false
+	for _, state := range req.Allowed {
+		if state == current {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return TransitionResult{Err: stateError(current, req.Target)}
+	}
+
+	d = s.writeDay(req.MerchantID, req.Day, req.Now)
+	now := req.Now.UnixMilli()
+	result := TransitionResult{Previous: current, Position: -1}
+	if !req.Target.IsLive() {
+		if position, ok := rank(d.queue, req.OrderID); ok {
+			order.fields[finalPositionField] = strconv.FormatInt(position, 10)
+			result.Position = position
+		}
+		delete(d.queue, req.OrderID)
+
+		for station := range order.info.Stations {
+			if order.fields[stationField(station)] == "pending" {
+				result.Pending = append(result.Pending, station)
+			}
+		}
+		sort.Slice(result.Pending, func(i, j int) bool { return result.Pending[i] < result.Pending[j] })
+	}
+	delete(d.states[current], req.OrderID)
+	d.setState(req.OrderID, req.Target, now)
+	order.fields["state"] = string(req.Target)
+	order.fields[string(req.Target)+"_at"] = strconv.FormatInt(now, 10)
+
+	if req.Target == StateReady {
+		stats := s.writeStats(req.MerchantID, req.Now)
+		if recordSample(stats, order.info.NumOfItems, order.info.EnqueueTime, now, req.Stats) {
+			updateAccuracy(stats, order.fields, now, req.Stats)
+		}
+
+		// 取餐号去掉末尾的序号即为前缀
+		if ticket := order.fields["ticket"]; ticket != "" {
+			prefix := strings.TrimRight(ticket, "0123456789")
+			if prefix != ticket {
+				d.serving[prefix] = ticket
+			}
+		}
+	}
+	return result
+}
+
+// recordSample 记录一个处理时间样本，与 Redis 脚本中的 record_sample 一致
+// 异常样本只计入 rejected_orders；返回样本是否被计入
+func recordSample(fields map[string]string, items int, enqueueTime time.Time, now int64, params StatsParams) bool {
+	if items <= 0 || enqueueTime.IsZero() {
+		return false
+	}
+
+	duration := now - enqueueTime.UnixMilli()
+	if duration < 0 {
+		duration = 0
+	}
+	itemTime := float64(duration / int64(items))
+
+	weight, _ := parseNumber(fields, sampleWeightKey)
+	mean, _ := parseNumber(fields, "mean_item_time")
+	m2, _ := parseNumber(fields, m2ItemTimeKey)
+	decayAt, hasDecay := parseNumber(fields, "decay_at")
+
+	// 异常样本不计入统计
+	reject := float64(duration) > float64(params.MaxOrder) || itemTime < float64(params.MinItem)
+	if !reject && params.Sigma > 0 && weight >= params.MinSamples {
+		sd := math.Sqrt(m2 / weight)
+		if sd > 0 && itemTime > mean+params.Sigma*sd {
+			reject = true
+		}
+	}
+	if reject {
+		rejected, _ := strconv.ParseInt(fields[rejectedKey], 10, 64)
+		fields[rejectedKey] = strconv.FormatInt(rejected+1, 10)
+		return false
+	}
+
+	// 按距上次更新的时间衰减旧样本
+	factor := 1.0
+	if hasDecay && float64(now) > decayAt && params.HalfLife > 0 {
+		factor = math.Pow(0.5, (float64(now)-decayAt)/float64(params.HalfLife))
+	}
+	weight *= factor
+	m2 *= factor
+
+	bucket := len(params.BucketsMs) + 1
+	for i, bound := range params.BucketsMs {
+		if itemTime <= float64(bound) {
+			bucket = i + 1
+			break
+		}
+	}
+	for i := 1; i <= len(params.BucketsMs)+1; i++ {
+		field := histField + ":" + strconv.Itoa(i)
+		w, _ := parseNumber(fields, field)
+		w *= factor
+		if i == bucket {
+			w++
+		}
+		if w > 0 {
+			fields[field] = formatNumber(w)
+		}
+	}
+
+	// 加权 Welford 算法更新均值与方差
+	weight++
+	delta := itemTime - mean
+	mean += delta / weight
+	m2 += delta * (itemTime - mean)
+
+	count, _ := parseNumber(fields, orderCountKey)
+	fields[sampleWeightKey] = formatNumber(weight)
+	fields["mean_item_time"] = formatNumber(mean)
+	fields[m2ItemTimeKey] = formatNumber(m2)
+	fields["decay_at"] = strconv.FormatInt(now, 10)
+	fields[itemProcessTimeKey] = formatNumber(math.Floor(mean))
+	fields[orderCountKey] = formatNumber(count + 1)
+
+	// 当前小时的平均值
+	avgField := itemProcessTimeKey + ":" + strconv.Itoa(params.Hour)
+	countField := orderCountKey + ":" + strconv.Itoa(params.Hour)
+	avg, _ := parseNumber(fields, avgField)
+	hourCount, _ := parseNumber(fields, countField)
+	newAvg := itemTime
+	if hourCount > 0 {
+		newAvg = math.Floor((avg*hourCount + itemTime) / (hourCount + 1))
+	}
+	fields[avgField] = formatNumber(newAvg)
+	fields[countField] = formatNumber(hourCount + 1)
+
+	ewma, ok := parseNumber(fields, ewmaItemTimeKey)
+	if ok {
+		ewma = math.Floor(params.Alpha*itemTime + (1-params.Alpha)*ewma)
+	} else {
+		ewma = itemTime
+	}
+	fields[ewmaItemTimeKey] = formatNumber(ewma)
+	return true
+}
+
+// updateAccuracy 对比入队时的预估与实际等待时间，与 Redis 脚本中的 update_accuracy 一致
+func updateAccuracy(fields, order map[string]string, now int64, params StatsParams) {
+	estimate, ok := parseNumber(order, estimateField)
+	queuedAt, queued := parseNumber(order, "queued_at")
+	if !ok || estimate <= 0 || !queued {
+		return
+	}
+	actual := float64(now) - queuedAt
+	diff := actual - estimate
+
+	weight, _ := parseNumber(fields, accuracyKey)
+	mae, _ := parseNumber(fields, maeKey)
+	bias, _ := parseNumber(fields, biasKey)
+	calWeight, _ := parseNumber(fields, calWeightKey)
+	calBuffer, _ := parseNumber(fields, calBufferKey)
+	decayAt, hasDecay := parseNumber(fields, "accuracy_decay_at")
+
+	factor := 1.0
+	if hasDecay && float64(now) > decayAt && params.HalfLife > 0 {
+		factor = math.Pow(0.5, (float64(now)-decayAt)/float64(params.HalfLife))
+	}
+
+	weight = weight*factor + 1
+	mae += (math.Abs(diff) - mae) / weight
+	bias += (diff - bias) / weight
+	fields[accuracyKey] = formatNumber(weight)
+	fields[maeKey] = formatNumber(mae)
+	fields[biasKey] = formatNumber(bias)
+	fields["accuracy_decay_at"] = strconv.FormatInt(now, 10)
+
+	// 使本单预估恰好准确的缓冲系数
+	if buffer, ok := parseNumber(order, bufferField); ok && buffer > 0 {
+		calWeight = calWeight*factor + 1
+		calBuffer += (buffer*actual/estimate - calBuffer) / calWeight
+		fields[calWeightKey] = formatNumber(calWeight)
+		fields[calBufferKey] = formatNumber(calBuffer)
+	}
+}
+
+// Reorder 调整订单的队列分数并记录审计，规则与 Redis 脚本一致
+func (s *MemoryStore) Reorder(ctx context.Context, req ReorderRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.day(req.MerchantID, req.Day)
+	if d == nil || d.orders[req.OrderID] == nil {
+		return ErrOrderNotFound
+	}
+	order := d.orders[req.OrderID]
+	if order.state() != StateQueued {
+		return ErrOrderNotQueued
+	}
+	score, ok := d.queue[req.OrderID]
+	if !ok {
+		return ErrOrderNotFound
+	}
+
+	held, isHeld := order.fields[heldScoreField]
+	if req.Action == MoveActionRelease {
+		if !isHeld {
+			return ErrOrderNotHeld
+		}
+	} else if isHeld {
+		return ErrOrderHeld
+	}
+
+	ids := ranked(d.queue)
+	from, _ := rank(d.queue, req.OrderID)
+	now := req.Now.UnixMilli()
+	switch req.Action {
+	case MoveActionFront:
+		if ids[0] != req.OrderID {
+			score = d.queue[ids[0]] - 1e6
+		}
+	case MoveActionBefore:
+		other, ok := d.orders[req.OtherID]
+		otherScore, queued := d.queue[req.OtherID]
+		if !ok || !queued {
+			return ErrOrderNotFound
+		}
+		if _, ok := other.fields[heldScoreField]; ok {
+			return ErrOrderHeld
+		}
+		otherRank, _ := rank(d.queue, req.OtherID)
+		if otherRank == 0 {
+			score = otherScore - 1e6
+		} else if prev := ids[otherRank-1]; prev != req.OrderID {
+			prevScore := d.queue[prev]
+			score = (prevScore + otherScore) / 2
+			if score <= prevScore || score >= otherScore {
+				return ErrNoRoom
+			}
+		}
+	case MoveActionDefer:
+		score += float64(req.Defer.Milliseconds()) * 1e6
+	case MoveActionHold:
+		order.fields[heldScoreField] = formatNumber(score)
+		order.fields[heldAtField] = strconv.FormatInt(now, 10)
+		score += 1e18
+	case MoveActionRelease:
+		score, _ = strconv.ParseFloat(held, 64)
+		delete(order.fields, heldScoreField)
+		delete(order.fields, heldAtField)
+	}
+
+	d = s.writeDay(req.MerchantID, req.Day, req.Now)
+	d.queue[req.OrderID] = score
+	// 已完成的小票不在工位队列中，只更新尚未完成的小票
+	for station := range order.info.Stations {
+		if _, ok := d.stationQueues[station][req.OrderID]; ok {
+			d.stationQueues[station][req.OrderID] = score
+		}
+	}
+	to, _ := rank(d.queue, req.OrderID)
+	d.moves = append(d.moves, MoveRecord{
+		Action:     req.Action,
+		OrderID:    req.OrderID,
+		OtherID:    req.OtherID,
+		DeferredMs: req.Defer.Milliseconds(),
+		Operator:   req.Operator,
+		From:       from,
+		To:         to,
+		Time:       now,
+	})
+	return nil
+}
+
+// CompleteStation 完成订单某工位的小票，并以该工位的商品数更新工位统计
+func (s *MemoryStore) CompleteStation(ctx context.Context, req StationRequest) (OrderState, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.day(req.MerchantID, req.Day)
+	if d == nil || d.orders[req.OrderID] == nil {
+		return "", 0, ErrOrderNotFound
+	}
+	order := d.orders[req.OrderID]
+	state := order.state()
+	status, ok := order.fields[stationField(req.Station)]
+	if !ok {
+		return "", 0, ErrOrderNotFound
+	}
+	if !state.IsLive() {
+		return "", 0, stateError(state, StateReady)
+	}
+	if status != "pending" {
+		return "", 0, ErrStationAlreadyCompleted
+	}
+
+	now := req.Now.UnixMilli()
+	order.fields[stationField(req.Station)] = strconv.FormatInt(now, 10)
+	delete(d.stationQueues[req.Station], req.OrderID)
+
+	stats := s.writeStats(stationStatsKey(req.MerchantID, req.Station), req.Now)
+	recordSample(stats, order.info.Stations[req.Station], order.info.EnqueueTime, now, req.Stats)
+
+	var remaining int
+	for station := range order.info.Stations {
+		if order.fields[stationField(station)] == "pending" {
+			remaining++
+		}
+	}
+	return state, remaining, nil
+}
+
+// LocateOrders 按 days 的顺序查找订单所在的营业日
+func (s *MemoryStore) LocateOrders(ctx context.Context, merchantID string, days []string, orderIDs []string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	located := make(map[string]string, len(orderIDs))
+	for _, day := range days {
+		d := s.day(merchantID, day)
+		if d == nil {
+			continue
+		}
+		for _, orderID := range orderIDs {
+			if _, found := located[orderID]; !found && d.orders[orderID] != nil {
+				located[orderID] = day
+			}
+		}
+	}
+	return located, nil
+}
+
+// OrderRecords 批量获取订单记录
+func (s *MemoryStore) OrderRecords(ctx context.Context, merchantID, day string, orderIDs []string) ([]*OrderRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.day(merchantID, day)
+	if d == nil || len(orderIDs) == 0 {
+		return nil, nil
+	}
+	records := make([]*OrderRecord, 0, len(orderIDs))
+	for _, orderID := range orderIDs {
+		if order, ok := d.orders[orderID]; ok {
+			records = append(records, newOrderRecord(cloneOrderInfo(order.info), order.fields))
+		}
+	}
+	return records, nil
+}
+
+// QueuePosition 获取订单在队列中的位置
+func (s *MemoryStore) QueuePosition(ctx context.Context, merchantID, day, orderID string) (int64, *OrderInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.day(merchantID, day)
+	if d == nil || d.orders[orderID] == nil {
+		return 0, nil, ErrOrderNotFound
+	}
+	position, ok := rank(d.queue, orderID)
+	if !ok {
+		return 0, nil, ErrOrderNotFound
+	}
+	info := cloneOrderInfo(d.orders[orderID].info)
+	return position, &info, nil
+}
+
+// QueueOrders 按队列顺序获取区间内的订单，下标规则与 ZRANGE 一致
+func (s *MemoryStore) QueueOrders(ctx context.Context, merchantID, day string, start, stop int64) ([]OrderInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.day(merchantID, day)
+	if d == nil {
+		return []OrderInfo{}, nil
+	}
+	ids := ranked(d.queue)
+	n := int64(len(ids))
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+
+	orders := make([]OrderInfo, 0)
+	for i := start; i <= stop; i++ {
+		orders = append(orders, cloneOrderInfo(d.orders[ids[i]].info))
+	}
+	return orders, nil
+}
+
+// StateOrders 按进入状态的时间获取状态集合中的订单
+func (s *MemoryStore) StateOrders(ctx context.Context, merchantID, day string, state OrderState, until time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.day(merchantID, day)
+	if d == nil {
+		return []string{}, nil
+	}
+	scores := make(map[string]float64, len(d.states[state]))
+	for orderID, at := range d.states[state] {
+		if until.IsZero() || at <= until.UnixMilli() {
+			scores[orderID] = float64(at)
+		}
+	}
+	return ranked(scores), nil
+}
+
+// Snapshot 读取队列看板数据
+func (s *MemoryStore) Snapshot(ctx context.Context, merchantID, day string, since time.Time) (*SnapshotData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := &SnapshotData{
+		Orders: make([]*OrderRecord, 0),
+		Stats:  s.readStats(merchantID),
+		Lanes:  make(map[string]string),
+
+		Scheduled: s.scheduledOrders(merchantID, time.Time{}),
+	}
+	d := s.day(merchantID, day)
+	if d == nil {
+		return data, nil
+	}
+	for _, orderID := range ranked(d.queue) {
+		order := d.orders[orderID]
+		data.Orders = append(data.Orders, newOrderRecord(cloneOrderInfo(order.info), order.fields))
+	}
+	for _, state := range []OrderState{StateReady, StatePickedUp} {
+		data.Completed += len(d.states[state])
+		for orderID := range d.states[state] {
+			order := d.orders[orderID]
+			if readyAt, ok := parseNumber(order.fields, string(StateReady)+"_at"); ok && readyAt >= float64(since.UnixMilli()) {
+				data.RecentOrders++
+				data.RecentItems += order.info.NumOfItems
+			}
+		}
+	}
+	for k, v := range d.lanes {
+		data.Lanes[k] = v
+	}
+	return data, nil
+}
+
+// SetEnqueueEstimates 记录订单入队时的位置及预估等待时间，不存在的订单会被跳过
+func (s *MemoryStore) SetEnqueueEstimates(ctx context.Context, merchantID, day string, estimates []EnqueueEstimate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.day(merchantID, day)
+	if d == nil {
+		return nil
+	}
+	for _, e := range estimates {
+		order := d.orders[e.OrderID]
+		if order == nil {
+			continue
+		}
+		order.fields[positionField] = strconv.FormatInt(e.Position, 10)
+		order.fields[estimateField] = strconv.FormatInt(e.Estimate.Expected.Milliseconds(), 10)
+		order.fields[p90Field] = strconv.FormatInt(e.Estimate.P90.Milliseconds(), 10)
+		order.fields[bufferField] = formatNumber(e.Estimate.buffer)
+	}
+	return nil
+}
+
+// LaneStats 获取当天各通道的到达统计
+func (s *MemoryStore) LaneStats(ctx context.Context, merchantID, day string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[string]string)
+	if d := s.day(merchantID, day); d != nil {
+		for k, v := range d.lanes {
+			stats[k] = v
+		}
+	}
+	return stats, nil
+}
+
+// MerchantStats 获取商家统计字段
+func (s *MemoryStore) MerchantStats(ctx context.Context, merchantID string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readStats(merchantID), nil
+}
+
+// StationStats 获取商家某工位的统计字段
+func (s *MemoryStore) StationStats(ctx context.Context, merchantID string, station Station) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readStats(stationStatsKey(merchantID, station)), nil
+}
+
+// TicketOrder 通过取餐号查找订单ID
+func (s *MemoryStore) TicketOrder(ctx context.Context, merchantID, day, ticket string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.day(merchantID, day)
+	if d == nil {
+		return "", ErrOrderNotFound
+	}
+	orderID, ok := d.ticketIndex[ticket]
+	if !ok {
+		return "", ErrOrderNotFound
+	}
+	return orderID, nil
+}
+
+// NowServing 获取各前缀最近叫到的取餐号
+func (s *MemoryStore) NowServing(ctx context.Context, merchantID, day string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	serving := make(map[string]string)
+	if d := s.day(merchantID, day); d != nil {
+		for prefix, ticket := range d.serving {
+			serving[prefix] = ticket
+		}
+	}
+	return serving, nil
+}
+
+// StationQueue 按顺序获取工位队列中的订单ID
+func (s *MemoryStore) StationQueue(ctx context.Context, merchantID, day string, station Station) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.day(merchantID, day)
+	if d == nil {
+		return []string{}, nil
+	}
+	return ranked(d.stationQueues[station]), nil
+}
+
+// RemoveStationTickets 从工位队列中移除小票
+func (s *MemoryStore) RemoveStationTickets(ctx context.Context, merchantID, day string, tickets map[string][]Station) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.day(merchantID, day)
+	if d == nil {
+		return nil
+	}
+	for orderID, stations := range tickets {
+		for _, station := range stations {
+			delete(d.stationQueues[station], orderID)
+		}
+	}
+	return nil
+}
+
+// ArchiveOrders 追加归档的订单
+func (s *MemoryStore) ArchiveOrders(ctx context.Context, merchantID, day string, orders []ArchivedOrder) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memoryDayKey{merchantID, day}
+	archive, ok := s.archives[key]
+	if !ok {
+		archive = &memoryArchive{}
+		s.archives[key] = archive
+	}
+	archive.orders = append(archive.orders, orders...)
+	// 按归档时间过期，与队列系统使用的时钟一致
+	archive.expireAt = orders[len(orders)-1].ArchivedAt.Add(statsExpiration)
+	return nil
+}
+
+// ArchivedOrders 获取归档的订单
+func (s *MemoryStore) ArchivedOrders(ctx context.Context, merchantID, day string) ([]ArchivedOrder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orders := make([]ArchivedOrder, 0)
+	if archive, ok := s.archives[memoryDayKey{merchantID, day}]; ok {
+		orders = append(orders, archive.orders...)
+	}
+	return orders, nil
+}
+
+// MoveRecords 获取人工调整顺序的审计记录
+func (s *MemoryStore) MoveRecords(ctx context.Context, merchantID, day string) ([]MoveRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]MoveRecord, 0)
+	if d := s.day(merchantID, day); d != nil {
+		records = append(records, d.moves...)
+	}
+	return records, nil
+}
+
+// OrderMerchant 查找订单所属的商家
+func (s *MemoryStore) OrderMerchant(ctx context.Context, orderID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.lookups[orderID]
+	if !ok || time.Now().After(l.expireAt) {
+		return "", ErrOrderNotFound
+	}
+	return l.merchantID, nil
+}
+
+// SetOrderMerchants 写入订单所属商家的全局索引
+func (s *MemoryStore) SetOrderMerchants(ctx context.Context, orders []OrderInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expireAt := time.Now().Add(defaultExpiration)
+	for _, order := range orders {
+		s.lookups[order.OrderID] = &memoryLookup{merchantID: order.MerchantID, expireAt: expireAt}
+	}
+	return nil
+}
+
+// ReleaseOrderMerchants 删除仍指向该商家的全局索引
+func (s *MemoryStore) ReleaseOrderMerchants(ctx context.Context, merchantID string, orderIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, orderID := range orderIDs {
+		if l, ok := s.lookups[orderID]; ok && l.merchantID == merchantID {
+			delete(s.lookups, orderID)
+		}
+	}
+	return nil
+}
+
+// Schedule 保存预约订单并记录商家最晚的放入时间
+func (s *MemoryStore) Schedule(ctx context.Context, order ScheduledOrder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	merchantID := order.Order.MerchantID
+	orders, ok := s.scheduled[merchantID]
+	if !ok {
+		orders = make(map[string]ScheduledOrder)
+		s.scheduled[merchantID] = orders
+	}
+	if _, ok := orders[order.Order.OrderID]; ok {
+		return ErrOrderAlreadyScheduled
+	}
+	order.Order = cloneOrderInfo(order.Order)
+	orders[order.Order.OrderID] = order
+
+	if at, ok := s.scheduledMerchants[merchantID]; !ok || order.ReleaseAt.After(at) {
+		s.scheduledMerchants[merchantID] = order.ReleaseAt
+	}
+	return nil
+}
+
+// ScheduledOrders 按放入时间顺序获取 until 之前放入的预约订单
+func (s *MemoryStore) ScheduledOrders(ctx context.Context, merchantID string, until time.Time) ([]ScheduledOrder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scheduledOrders(merchantID, until), nil
+}
+
+// scheduledOrders 按放入时间(毫秒)与订单ID排序，与 Redis 有序集合一致
+func (s *MemoryStore) scheduledOrders(merchantID string, until time.Time) []ScheduledOrder {
+	orders := s.scheduled[merchantID]
+	scores := make(map[string]float64, len(orders))
+	for orderID, order := range orders {
+		if until.IsZero() || order.ReleaseAt.UnixMilli() <= until.UnixMilli() {
+			scores[orderID] = float64(order.ReleaseAt.UnixMilli())
+		}
+	}
+
+	result := make([]ScheduledOrder, 0, len(scores))
+	for _, orderID := range ranked(scores) {
+		order := orders[orderID]
+		order.Order = cloneOrderInfo(order.Order)
+		result = append(result, order)
+	}
+	return result
+}
+
+// Unschedule 移除预约订单
+func (s *MemoryStore) Unschedule(ctx context.Context, merchantID, orderID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.scheduled[merchantID][orderID]; !ok {
+		return ErrOrderNotFound
+	}
+	delete(s.scheduled[merchantID], orderID)
+	if len(s.scheduled[merchantID]) == 0 {
+		delete(s.scheduled, merchantID)
+	}
+	return nil
+}
+
+// ScheduledMerchants 获取最晚放入时间在 since 之后的商家，按最晚放入时间排序
+func (s *MemoryStore) ScheduledMerchants(ctx context.Context, since time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scores := make(map[string]float64, len(s.scheduledMerchants))
+	for merchantID, at := range s.scheduledMerchants {
+		if at.Before(since) {
+			delete(s.scheduledMerchants, merchantID)
+			continue
+		}
+		scores[merchantID] = float64(at.UnixMilli())
+	}
+	return ranked(scores), nil
+}
+
+// MarkActive 记录商家最近的入队时间
+func (s *MemoryStore) MarkActive(ctx context.Context, merchantIDs []string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, merchantID := range merchantIDs {
+		s.active[merchantID] = at
+	}
+	return nil
+}
+
+// ActiveMerchants 获取 since 之后有订单入队的商家，按最近入队时间排序
+func (s *MemoryStore) ActiveMerchants(ctx context.Context, since time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scores := make(map[string]float64, len(s.active))
+	for merchantID, at := range s.active {
+		if at.Before(since) {
+			delete(s.active, merchantID)
+			continue
+		}
+		scores[merchantID] = float64(at.UnixMilli())
+	}
+	return ranked(scores), nil
+}
+
+// Publish 将事件发送给商家的所有订阅，订阅的缓冲写满时丢弃事件并记录日志
+func (s *MemoryStore) Publish(ctx context.Context, merchantID string, events []QueueEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sub := range s.subs[merchantID] {
+		for _, event := range events {
+			select {
+			case sub.events <- event:
+			default:
+				log.Log(ctx).WithField("merchant", merchantID).Printf("[oqueue] drop queue event %s of %s", event.Type, event.OrderID)
+			}
+		}
+	}
+	return nil
+}
+
+// Subscribe 订阅商家队列事件，ctx 取消时自动关闭
+func (s *MemoryStore) Subscribe(ctx context.Context, merchantID string) (Subscription, error) {
+	sub := &memorySubscription{
+		store:      s,
+		merchantID: merchantID,
+		events:     make(chan QueueEvent, memoryEventBuffer),
+		done:       make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	if s.subs[merchantID] == nil {
+		s.subs[merchantID] = make(map[*memorySubscription]struct{})
+	}
+	s.subs[merchantID][sub] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			sub.Close()
+		case <-sub.done:
+		}
+	}()
+	return sub, nil
+}
+
+// memorySubscription 内存存储的事件订阅
+type memorySubscription struct {
+	store      *MemoryStore
+	merchantID string
+	events     chan QueueEvent
+	done       chan struct{}
+	once       sync.Once
+}
+
+// Events 事件通道
+func (s *memorySubscription) Events() <-chan QueueEvent {
+	return s.events
+}
+
+// Close 取消订阅并关闭事件通道
+func (s *memorySubscription) Close() error {
+	s.once.Do(func() {
+		s.store.mu.Lock()
+		delete(s.store.subs[s.merchantID], s)
+		if len(s.store.subs[s.merchantID]) == 0 {
+			delete(s.store.subs, s.merchantID)
+		}
+		close(s.events)
+		s.store.mu.Unlock()
+		close(s.done)
+	})
+	return nil
+}
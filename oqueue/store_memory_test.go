@@ -0,0 +1,13 @@
+package oqueue_test
+
+import (
+	"github.com/open4go/p7/oqueue"
+	"github.com/open4go/p7/oqueue/oqueuetest"
+	"testing"
+)
+
+func TestMemoryStoreConformance(t *testing.T) {
+	oqueuetest.RunStoreConformance(t, func(t *testing.T) oqueue.Store {
+		return oqueue.NewMemoryStore()
+	})
+}
@@ -0,0 +1,991 @@
+package oqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/open4go/log"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 商家相关的key以 {merchantID} 作为哈希标签，同一商家的key在 Redis Cluster 中位于同一slot，
+// 因此操作多个key的脚本在集群中同样可以原子执行
+const (
+	queueKeyFormat        = "queue:{%s}:%s"                  // queue:{<merchantID>}:<date>
+	indexKeyFormat        = "queue_index:{%s}:%s"            // 订单ID -> 队列成员 的索引
+	statsKeyFormat        = "merchant_stats:{%s}"            // 商家统计
+	orderKeyFormat        = "queue_order:{%s}:%s:%s"         // 单个订单的状态及各状态时间(毫秒)
+	stateKeyFormat        = "queue_state:{%s}:%s:%s"         // 商家当天某状态的订单集合，score为进入该状态的时间
+	laneKeyFormat         = "queue_lanes:{%s}:%s"            // 商家当天各通道到达统计
+	ticketKeyFormat       = "queue_tickets:{%s}:%s"          // 商家当天各前缀的发号序列(seq:<前缀>)与叫号(serving:<前缀>)
+	ticketIndexKeyFormat  = "queue_ticket_index:{%s}:%s"     // 取餐号 -> 订单ID
+	archiveKeyFormat      = "queue_archive:{%s}:%s"          // 清空队列时归档的订单列表
+	moveKeyFormat         = "queue_moves:{%s}:%s"            // 商家当天人工调整顺序的审计记录
+	stationQueueKeyFormat = "queue_station:{%s}:%s:%s"       // 商家当天某工位的队列，成员为订单ID，分数与主队列相同
+	stationStatsKeyFormat = "merchant_stats:{%s}:station:%s" // 商家某工位的统计
+	confKeyFormat         = "queue_conf:%s"                  // 商家队列配置
+	eventChannelFormat    = "queue_events:%s"                // 商家队列变化事件频道
+	activeMerchantsKey    = "queue_merchants"                // 活跃商家集合，score为最近入队时间(毫秒)
+	orderMerchantFormat   = "order_merchant:%s"              // 订单ID -> 商家ID 的全局索引
+	scheduledKeyFormat    = "queue_scheduled:{%s}"           // 商家的预约订单集合，score为放入时间(毫秒)
+	scheduledOrderFormat  = "queue_scheduled_orders:{%s}"    // 预约订单ID -> 预约订单JSON
+	scheduledMerchantsKey = "queue_scheduled_merchants"      // 有预约订单的商家集合，score为最晚放入时间(毫秒)
+)
+
+// RedisStore 基于 Redis 的队列存储，支持单机、哨兵与集群模式
+type RedisStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisStore 创建 Redis 存储
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// getQueueKey 获取商家某营业日的队列key
+func (s *RedisStore) getQueueKey(merchantID, day string) string {
+	return fmt.Sprintf(queueKeyFormat, merchantID, day)
+}
+
+// getIndexKey 获取商家某营业日的订单索引key
+func (s *RedisStore) getIndexKey(merchantID, day string) string {
+	return fmt.Sprintf(indexKeyFormat, merchantID, day)
+}
+
+// getStatsKey 获取商家统计key
+func (s *RedisStore) getStatsKey(merchantID string) string {
+	return fmt.Sprintf(statsKeyFormat, merchantID)
+}
+
+// getOrderKey 获取订单状态key
+func (s *RedisStore) getOrderKey(merchantID, day, orderID string) string {
+	return fmt.Sprintf(orderKeyFormat, merchantID, day, orderID)
+}
+
+// getStateKey 获取商家某营业日某状态的订单集合key
+func (s *RedisStore) getStateKey(merchantID, day string, state OrderState) string {
+	return fmt.Sprintf(stateKeyFormat, merchantID, day, state)
+}
+
+// getLaneKey 获取商家某营业日的通道统计key
+func (s *RedisStore) getLaneKey(merchantID, day string) string {
+	return fmt.Sprintf(laneKeyFormat, merchantID, day)
+}
+
+// getTicketKey 获取商家某营业日的发号key
+func (s *RedisStore) getTicketKey(merchantID, day string) string {
+	return fmt.Sprintf(ticketKeyFormat, merchantID, day)
+}
+
+// getTicketIndexKey 获取商家某营业日的取餐号索引key
+func (s *RedisStore) getTicketIndexKey(merchantID, day string) string {
+	return fmt.Sprintf(ticketIndexKeyFormat, merchantID, day)
+}
+
+// getArchiveKey 获取商家某营业日的归档key
+func (s *RedisStore) getArchiveKey(merchantID, day string) string {
+	return fmt.Sprintf(archiveKeyFormat, merchantID, day)
+}
+
+// getMoveKey 获取商家某营业日的调整顺序审计key
+func (s *RedisStore) getMoveKey(merchantID, day string) string {
+	return fmt.Sprintf(moveKeyFormat, merchantID, day)
+}
+
+// getStationQueueKey 获取商家某营业日某工位的队列key
+func (s *RedisStore) getStationQueueKey(merchantID, day string, station Station) string {
+	return fmt.Sprintf(stationQueueKeyFormat, merchantID, day, station)
+}
+
+// getStationStatsKey 获取商家某工位的统计key
+func (s *RedisStore) getStationStatsKey(merchantID string, station Station) string {
+	return fmt.Sprintf(stationStatsKeyFormat, merchantID, station)
+}
+
+// getScheduledKey 获取商家的预约订单集合key
+func (s *RedisStore) getScheduledKey(merchantID string) string {
+	return fmt.Sprintf(scheduledKeyFormat, merchantID)
+}
+
+// getScheduledOrderKey 获取商家的预约订单哈希key
+func (s *RedisStore) getScheduledOrderKey(merchantID string) string {
+	return fmt.Sprintf(scheduledOrderFormat, merchantID)
+}
+
+// getConfKey 获取商家配置key
+func (s *RedisStore) getConfKey(merchantID string) string {
+	return fmt.Sprintf(confKeyFormat, merchantID)
+}
+
+// getOrderMerchantKey 获取订单所属商家的全局索引key
+func (s *RedisStore) getOrderMerchantKey(orderID string) string {
+	return fmt.Sprintf(orderMerchantFormat, orderID)
+}
+
+// getEventChannel 获取商家队列事件频道
+func (s *RedisStore) getEventChannel(merchantID string) string {
+	return fmt.Sprintf(eventChannelFormat, merchantID)
+}
+
+// GetConfig 获取商家配置，未配置时返回零值
+func (s *RedisStore) GetConfig(ctx context.Context, merchantID string) (MerchantConfig, error) {
+	var cfg MerchantConfig
+
+	payload, err := s.client.Get(ctx, s.getConfKey(merchantID)).Bytes()
+	if err == redis.Nil {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("failed to get merchant config: %v", err)
+	}
+
+	if err := json.Unmarshal(payload, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid merchant config: %v", err)
+	}
+	return cfg, nil
+}
+
+// SetConfig 保存商家配置
+func (s *RedisStore) SetConfig(ctx context.Context, merchantID string, cfg MerchantConfig) error {
+	payload, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to encode merchant config: %v", err)
+	}
+
+	if err := s.client.Set(ctx, s.getConfKey(merchantID), payload, 0).Err(); err != nil {
+		return fmt.Errorf("failed to save merchant config: %v", err)
+	}
+	return nil
+}
+
+// runBatch 在一个管道中批量执行同一脚本，返回各调用的结果
+// 脚本先加载到服务端，管道中使用 EVALSHA 避免重复发送脚本内容；单个调用的错误在其结果中返回
+func (s *RedisStore) runBatch(ctx context.Context, script *redis.Script, calls []scriptCall) ([]*redis.Cmd, error) {
+	switch len(calls) {
+	case 0:
+		return nil, nil
+	case 1:
+		return []*redis.Cmd{script.Run(ctx, s.client, calls[0].keys, calls[0].args...)}, nil
+	}
+	if err := script.Load(ctx, s.client).Err(); err != nil {
+		return nil, fmt.Errorf("failed to load script: %v", err)
+	}
+
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.Cmd, len(calls))
+	for i, call := range calls {
+		cmds[i] = script.EvalSha(ctx, pipe, call.keys, call.args...)
+	}
+	_, _ = pipe.Exec(ctx)
+	return cmds, nil
+}
+
+// Enqueue 批量入队，所有订单的入队脚本在一个管道中执行
+func (s *RedisStore) Enqueue(ctx context.Context, reqs []EnqueueRequest) ([]EnqueueResult, error) {
+	results := make([]EnqueueResult, len(reqs))
+	calls := make([]scriptCall, 0, len(reqs))
+	index := make([]int, 0, len(reqs)) // 各调用对应的请求下标
+	for i, req := range reqs {
+		call, err := s.enqueueCall(req)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		calls = append(calls, call)
+		index = append(index, i)
+	}
+
+	cmds, err := s.runBatch(ctx, enqueueScript, calls)
+	if err != nil {
+		return nil, err
+	}
+	for j, cmd := range cmds {
+		i := index[j]
+		res, err := cmd.Slice()
+		if err != nil {
+			results[i].Err = fmt.Errorf("failed to enqueue order: %v", err)
+			continue
+		}
+		results[i].Ticket, results[i].Position, results[i].Err = enqueueResult(res)
+	}
+	return results, nil
+}
+
+// enqueueCall 生成入队脚本调用
+func (s *RedisStore) enqueueCall(req EnqueueRequest) (scriptCall, error) {
+	order := req.Order
+	value, err := encodeOrderInfo(order)
+	if err != nil {
+		return scriptCall{}, fmt.Errorf("failed to encode order: %v", err)
+	}
+
+	call := scriptCall{
+		keys: []string{
+			s.getQueueKey(order.MerchantID, req.Day),
+			s.getIndexKey(order.MerchantID, req.Day),
+			s.getOrderKey(order.MerchantID, req.Day, order.OrderID),
+			s.getLaneKey(order.MerchantID, req.Day),
+			s.getStateKey(order.MerchantID, req.Day, StateQueued),
+			s.getTicketKey(order.MerchantID, req.Day),
+			s.getTicketIndexKey(order.MerchantID, req.Day),
+		},
+		args: []interface{}{
+			order.OrderID, value, req.Score, int64(defaultExpiration.Seconds()),
+			string(order.Lane), order.NumOfItems, req.Now.UnixMilli(),
+			req.TicketPrefix, order.Ticket,
+		},
+	}
+	for _, station := range req.Stations {
+		call.keys = append(call.keys, s.getStationQueueKey(order.MerchantID, req.Day, station))
+		call.args = append(call.args, string(station))
+	}
+	return call, nil
+}
+
+// enqueueResult 解析入队脚本返回值，返回分配的取餐号及入队后的位置
+func enqueueResult(res []interface{}) (string, int64, error) {
+	if len(res) > 0 && res[0] == int64(resultTicket) {
+		return "", 0, ErrTicketTaken
+	}
+	if err := scriptResult(res, StateQueued); err != nil {
+		return "", 0, err
+	}
+	ticket, _ := res[2].(string)
+	position, _ := res[3].(int64)
+	return ticket, position, nil
+}
+
+// Transition 批量流转订单状态，所有订单的流转脚本在一个管道中执行
+func (s *RedisStore) Transition(ctx context.Context, reqs []TransitionRequest) ([]TransitionResult, error) {
+	calls := make([]scriptCall, len(reqs))
+	for i, req := range reqs {
+		call, err := s.transitionCall(req)
+		if err != nil {
+			return nil, err
+		}
+		calls[i] = call
+	}
+
+	cmds, err := s.runBatch(ctx, transitionScript, calls)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]TransitionResult, len(reqs))
+	for i, cmd := range cmds {
+		res, err := cmd.Slice()
+		if err != nil {
+			results[i].Err = fmt.Errorf("failed to transition order: %v", err)
+			continue
+		}
+		results[i] = transitionResult(res, reqs[i].Target)
+	}
+	return results, nil
+}
+
+// transitionKeys 状态流转脚本所需的key
+// queue, index, order, stats, 之后依次为 orderStates 对应的状态集合, 最后为 tickets
+func (s *RedisStore) transitionKeys(merchantID, day, orderID string) []string {
+	keys := []string{
+		s.getQueueKey(merchantID, day),
+		s.getIndexKey(merchantID, day),
+		s.getOrderKey(merchantID, day, orderID),
+		s.getStatsKey(merchantID),
+	}
+	for _, state := range orderStates {
+		keys = append(keys, s.getStateKey(merchantID, day, state))
+	}
+	keys = append(keys, s.getTicketKey(merchantID, day))
+	return keys
+}
+
+// transitionCall 生成状态流转脚本调用
+func (s *RedisStore) transitionCall(req TransitionRequest) (scriptCall, error) {
+	from := make([]string, len(req.Allowed))
+	for i, state := range req.Allowed {
+		from[i] = string(state)
+	}
+	params, err := json.Marshal(req.Stats)
+	if err != nil {
+		return scriptCall{}, fmt.Errorf("failed to encode stats params: %v", err)
+	}
+
+	return scriptCall{
+		keys: s.transitionKeys(req.MerchantID, req.Day, req.OrderID),
+		args: []interface{}{
+			req.OrderID,
+			string(req.Target),
+			strings.Join(from, ","),
+			req.Now.UnixMilli(),
+			int64(defaultExpiration.Seconds()),
+			int64(statsExpiration.Seconds()),
+			string(params),
+		},
+	}, nil
+}
+
+// transitionResult 解析状态流转脚本返回值，成功时返回流转前的状态、离开队列时尚未完成的工位及离开时的位置
+func transitionResult(res []interface{}, target OrderState) TransitionResult {
+	if err := scriptResult(res, target); err != nil {
+		return TransitionResult{Err: err}
+	}
+	previous, _ := res[1].(string)
+	result := TransitionResult{Previous: OrderState(previous), Position: -1}
+	if len(res) > 2 {
+		if pending, _ := res[2].(string); pending != "" {
+			for _, station := range strings.Split(pending, ",") {
+				result.Pending = append(result.Pending, Station(station))
+			}
+		}
+	}
+	if len(res) > 3 {
+		if position, ok := res[3].(int64); ok {
+			result.Position = position
+		}
+	}
+	return result
+}
+
+// Reorder 执行调整顺序脚本
+// 工位队列需作为 KEYS 传入脚本，因此先通过索引读取订单拆分到的工位；工位在入队后不会改变
+func (s *RedisStore) Reorder(ctx context.Context, req ReorderRequest) error {
+	var stations []Station
+	member, err := s.client.HGet(ctx, s.getIndexKey(req.MerchantID, req.Day), req.OrderID).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to get order index: %v", err)
+	}
+	if member != "" {
+		info, err := parseOrderInfo(member)
+		if err != nil {
+			return fmt.Errorf("failed to parse order: %v", err)
+		}
+		if stations, err = info.stationList(); err != nil {
+			return err
+		}
+	}
+
+	orderKey := s.getOrderKey(req.MerchantID, req.Day, req.OrderID)
+	otherKey := orderKey
+	if req.OtherID != "" {
+		otherKey = s.getOrderKey(req.MerchantID, req.Day, req.OtherID)
+	}
+	keys := []string{
+		s.getQueueKey(req.MerchantID, req.Day),
+		s.getIndexKey(req.MerchantID, req.Day),
+		orderKey,
+		s.getMoveKey(req.MerchantID, req.Day),
+		otherKey,
+	}
+	for _, station := range stations {
+		keys = append(keys, s.getStationQueueKey(req.MerchantID, req.Day, station))
+	}
+	res, err := reorderScript.Run(ctx, s.client, keys,
+		req.OrderID, string(req.Action), req.OtherID, req.Defer.Milliseconds(), req.Operator,
+		req.Now.UnixMilli(), int64(defaultExpiration.Seconds()),
+	).Slice()
+	if err != nil {
+		return fmt.Errorf("failed to reorder order: %v", err)
+	}
+	return reorderResult(res)
+}
+
+// CompleteStation 执行完成工位小票脚本
+func (s *RedisStore) CompleteStation(ctx context.Context, req StationRequest) (OrderState, int, error) {
+	params, err := json.Marshal(req.Stats)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to encode stats params: %v", err)
+	}
+	keys := []string{
+		s.getIndexKey(req.MerchantID, req.Day),
+		s.getOrderKey(req.MerchantID, req.Day, req.OrderID),
+		s.getStationQueueKey(req.MerchantID, req.Day, req.Station),
+		s.getStationStatsKey(req.MerchantID, req.Station),
+	}
+	res, err := stationScript.Run(ctx, s.client, keys,
+		req.OrderID, string(req.Station), req.Now.UnixMilli(),
+		int64(statsExpiration.Seconds()), string(params),
+	).Slice()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to complete station: %v", err)
+	}
+	if len(res) > 0 {
+		if code, _ := res[0].(int64); code == resultDone {
+			return "", 0, ErrStationAlreadyCompleted
+		}
+	}
+	if err := scriptResult(res, StateReady); err != nil {
+		return "", 0, err
+	}
+	state, _ := res[1].(string)
+	var remaining int64
+	if len(res) > 2 {
+		remaining, _ = res[2].(int64)
+	}
+	return OrderState(state), int(remaining), nil
+}
+
+// LocateOrders 在一个管道中查找各营业日的订单索引，排在前面的营业日优先
+func (s *RedisStore) LocateOrders(ctx context.Context, merchantID string, days []string, orderIDs []string) (map[string]string, error) {
+	located := make(map[string]string, len(orderIDs))
+	if len(orderIDs) == 0 {
+		return located, nil
+	}
+
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(days))
+	for i, day := range days {
+		cmds[i] = pipe.HMGet(ctx, s.getIndexKey(merchantID, day), orderIDs...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to locate order: %v", err)
+	}
+
+	for i, day := range days {
+		for j, member := range cmds[i].Val() {
+			if _, found := located[orderIDs[j]]; member != nil && !found {
+				located[orderIDs[j]] = day
+			}
+		}
+	}
+	return located, nil
+}
+
+// OrderRecords 在一个管道中读取订单索引与状态哈希
+func (s *RedisStore) OrderRecords(ctx context.Context, merchantID, day string, orderIDs []string) ([]*OrderRecord, error) {
+	if len(orderIDs) == 0 {
+		return nil, nil
+	}
+
+	pipe := s.client.Pipeline()
+	members := pipe.HMGet(ctx, s.getIndexKey(merchantID, day), orderIDs...)
+	states := make([]*redis.MapStringStringCmd, len(orderIDs))
+	for i, orderID := range orderIDs {
+		states[i] = pipe.HGetAll(ctx, s.getOrderKey(merchantID, day, orderID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get orders: %v", err)
+	}
+
+	records := make([]*OrderRecord, 0, len(orderIDs))
+	for i, member := range members.Val() {
+		value, ok := member.(string)
+		if !ok {
+			continue
+		}
+		info, err := parseOrderInfo(value)
+		if err != nil {
+			continue
+		}
+		records = append(records, newOrderRecord(*info, states[i].Val()))
+	}
+	return records, nil
+}
+
+// QueuePosition 通过索引查找队列成员并获取其排名
+func (s *RedisStore) QueuePosition(ctx context.Context, merchantID, day, orderID string) (int64, *OrderInfo, error) {
+	member, err := s.client.HGet(ctx, s.getIndexKey(merchantID, day), orderID).Result()
+	if err == redis.Nil {
+		return 0, nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get order index: %v", err)
+	}
+
+	info, err := parseOrderInfo(member)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to parse order: %v", err)
+	}
+
+	position, err := s.client.ZRank(ctx, s.getQueueKey(merchantID, day), member).Result()
+	if err == redis.Nil {
+		return 0, nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get position: %v", err)
+	}
+	return position, info, nil
+}
+
+// QueueOrders 按队列顺序获取区间内的订单，无法解析的成员会被跳过
+func (s *RedisStore) QueueOrders(ctx context.Context, merchantID, day string, start, stop int64) ([]OrderInfo, error) {
+	members, err := s.client.ZRange(ctx, s.getQueueKey(merchantID, day), start, stop).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue: %v", err)
+	}
+
+	orders := make([]OrderInfo, 0, len(members))
+	for _, member := range members {
+		info, err := parseOrderInfo(member)
+		if err != nil {
+			log.Log(ctx).Printf("Failed to parse order %v: %v", member, err)
+			continue
+		}
+		orders = append(orders, *info)
+	}
+	return orders, nil
+}
+
+// StateOrders 按进入状态的时间获取状态集合中的订单
+func (s *RedisStore) StateOrders(ctx context.Context, merchantID, day string, state OrderState, until time.Time) ([]string, error) {
+	max := "+inf"
+	if !until.IsZero() {
+		max = strconv.FormatInt(until.UnixMilli(), 10)
+	}
+	orderIDs, err := s.client.ZRangeByScore(ctx, s.getStateKey(merchantID, day, state), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: max,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orders: %v", err)
+	}
+	return orderIDs, nil
+}
+
+// Snapshot 执行快照脚本，队列、订单哈希、出餐数与统计数据在同一次 EVAL 中读取，保证彼此一致
+func (s *RedisStore) Snapshot(ctx context.Context, merchantID, day string, since time.Time) (*SnapshotData, error) {
+	keys := []string{
+		s.getQueueKey(merchantID, day),
+		s.getIndexKey(merchantID, day),
+		s.getStateKey(merchantID, day, StateReady),
+		s.getStateKey(merchantID, day, StatePickedUp),
+		s.getStatsKey(merchantID),
+		s.getLaneKey(merchantID, day),
+		s.getScheduledKey(merchantID),
+		s.getScheduledOrderKey(merchantID),
+	}
+	res, err := snapshotScript.Run(ctx, s.client, keys, s.getOrderKey(merchantID, day, ""), since.UnixMilli()).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue snapshot: %v", err)
+	}
+	if len(res) < 8 {
+		return nil, errors.New("unexpected script result")
+	}
+
+	members, _ := res[0].([]interface{})
+	fields, _ := res[1].([]interface{})
+	data := &SnapshotData{
+		Orders:    make([]*OrderRecord, 0, len(members)),
+		Stats:     scriptHash(res[5]),
+		Lanes:     scriptHash(res[6]),
+		Scheduled: decodeScheduledOrders(ctx, res[7]),
+	}
+	completed, _ := res[2].(int64)
+	recentOrders, _ := res[3].(int64)
+	recentItems, _ := res[4].(int64)
+	data.Completed, data.RecentOrders, data.RecentItems = int(completed), int(recentOrders), int(recentItems)
+
+	for i, member := range members {
+		value, _ := member.(string)
+		info, err := parseOrderInfo(value)
+		if err != nil {
+			log.Log(ctx).Printf("Failed to parse order %v: %v", value, err)
+			continue
+		}
+		var state map[string]string
+		if i < len(fields) {
+			state = scriptHash(fields[i])
+		}
+		data.Orders = append(data.Orders, newOrderRecord(*info, state))
+	}
+	return data, nil
+}
+
+// scriptHash 将脚本返回的 HGETALL 结果转换为字段表
+func scriptHash(v interface{}) map[string]string {
+	items, _ := v.([]interface{})
+	fields := make(map[string]string, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		field, _ := items[i].(string)
+		value, _ := items[i+1].(string)
+		fields[field] = value
+	}
+	return fields
+}
+
+// SetEnqueueEstimates 在一个管道中将入队时的位置及预估等待时间写入各订单哈希
+func (s *RedisStore) SetEnqueueEstimates(ctx context.Context, merchantID, day string, estimates []EnqueueEstimate) error {
+	pipe := s.client.Pipeline()
+	for _, e := range estimates {
+		pipe.HSet(ctx, s.getOrderKey(merchantID, day, e.OrderID),
+			positionField, e.Position,
+			estimateField, e.Estimate.Expected.Milliseconds(),
+			p90Field, e.Estimate.P90.Milliseconds(),
+			bufferField, e.Estimate.buffer,
+		)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save enqueue estimates: %v", err)
+	}
+	return nil
+}
+
+// LaneStats 获取当天各通道的到达统计
+func (s *RedisStore) LaneStats(ctx context.Context, merchantID, day string) (map[string]string, error) {
+	stats, err := s.client.HGetAll(ctx, s.getLaneKey(merchantID, day)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lane stats: %v", err)
+	}
+	return stats, nil
+}
+
+// MerchantStats 获取商家统计哈希
+func (s *RedisStore) MerchantStats(ctx context.Context, merchantID string) (map[string]string, error) {
+	fields, err := s.client.HGetAll(ctx, s.getStatsKey(merchantID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get merchant stats: %v", err)
+	}
+	return fields, nil
+}
+
+// StationStats 获取商家某工位的统计哈希
+func (s *RedisStore) StationStats(ctx context.Context, merchantID string, station Station) (map[string]string, error) {
+	fields, err := s.client.HGetAll(ctx, s.getStationStatsKey(merchantID, station)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get station stats: %v", err)
+	}
+	return fields, nil
+}
+
+// TicketOrder 通过取餐号索引查找订单ID
+func (s *RedisStore) TicketOrder(ctx context.Context, merchantID, day, ticket string) (string, error) {
+	orderID, err := s.client.HGet(ctx, s.getTicketIndexKey(merchantID, day), ticket).Result()
+	if err == redis.Nil {
+		return "", ErrOrderNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get ticket: %v", err)
+	}
+	return orderID, nil
+}
+
+// NowServing 读取发号哈希中的 serving:<前缀> 字段
+func (s *RedisStore) NowServing(ctx context.Context, merchantID, day string) (map[string]string, error) {
+	fields, err := s.client.HGetAll(ctx, s.getTicketKey(merchantID, day)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tickets: %v", err)
+	}
+
+	serving := make(map[string]string)
+	for field, ticket := range fields {
+		if prefix, ok := strings.CutPrefix(field, "serving:"); ok {
+			serving[prefix] = ticket
+		}
+	}
+	return serving, nil
+}
+
+// StationQueue 按顺序获取工位队列中的订单ID
+func (s *RedisStore) StationQueue(ctx context.Context, merchantID, day string, station Station) ([]string, error) {
+	orderIDs, err := s.client.ZRange(ctx, s.getStationQueueKey(merchantID, day, station), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get station queue: %v", err)
+	}
+	return orderIDs, nil
+}
+
+// RemoveStationTickets 在一个管道中从工位队列移除小票
+func (s *RedisStore) RemoveStationTickets(ctx context.Context, merchantID, day string, tickets map[string][]Station) error {
+	pipe := s.client.Pipeline()
+	for orderID, stations := range tickets {
+		for _, station := range stations {
+			pipe.ZRem(ctx, s.getStationQueueKey(merchantID, day, station), orderID)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to remove station tickets: %v", err)
+	}
+	return nil
+}
+
+// ArchiveOrders 以JSON追加到 queue_archive:{<merchantID>}:<营业日>
+func (s *RedisStore) ArchiveOrders(ctx context.Context, merchantID, day string, orders []ArchivedOrder) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	archive := make([]interface{}, 0, len(orders))
+	for _, order := range orders {
+		payload, err := json.Marshal(order)
+		if err != nil {
+			return fmt.Errorf("failed to encode archived order: %v", err)
+		}
+		archive = append(archive, payload)
+	}
+
+	archiveKey := s.getArchiveKey(merchantID, day)
+	pipe := s.client.TxPipeline()
+	pipe.RPush(ctx, archiveKey, archive...)
+	pipe.Expire(ctx, archiveKey, statsExpiration)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to archive orders: %v", err)
+	}
+	return nil
+}
+
+// ArchivedOrders 读取归档列表
+func (s *RedisStore) ArchivedOrders(ctx context.Context, merchantID, day string) ([]ArchivedOrder, error) {
+	items, err := s.client.LRange(ctx, s.getArchiveKey(merchantID, day), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get archived orders: %v", err)
+	}
+
+	orders := make([]ArchivedOrder, 0, len(items))
+	for _, item := range items {
+		var order ArchivedOrder
+		if err := json.Unmarshal([]byte(item), &order); err != nil {
+			return nil, fmt.Errorf("invalid archived order: %v", err)
+		}
+		order.EnqueueTime = time.Unix(0, order.EnqueueAt)
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+// MoveRecords 读取调整顺序审计列表
+func (s *RedisStore) MoveRecords(ctx context.Context, merchantID, day string) ([]MoveRecord, error) {
+	items, err := s.client.LRange(ctx, s.getMoveKey(merchantID, day), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get move records: %v", err)
+	}
+
+	records := make([]MoveRecord, 0, len(items))
+	for _, item := range items {
+		var record MoveRecord
+		if err := json.Unmarshal([]byte(item), &record); err != nil {
+			return nil, fmt.Errorf("invalid move record: %v", err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// OrderMerchant 读取订单所属商家的全局索引
+func (s *RedisStore) OrderMerchant(ctx context.Context, orderID string) (string, error) {
+	merchantID, err := s.client.Get(ctx, s.getOrderMerchantKey(orderID)).Result()
+	if err == redis.Nil {
+		return "", ErrOrderNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get order merchant: %v", err)
+	}
+	return merchantID, nil
+}
+
+// SetOrderMerchants 在一个管道中写入订单所属商家的全局索引
+// 全局索引不带商家哈希标签，集群中不能与商家key在同一脚本中操作，因此在入队后单独写入
+func (s *RedisStore) SetOrderMerchants(ctx context.Context, orders []OrderInfo) error {
+	pipe := s.client.Pipeline()
+	for _, order := range orders {
+		pipe.Set(ctx, s.getOrderMerchantKey(order.OrderID), order.MerchantID, defaultExpiration)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to set order merchants: %v", err)
+	}
+	return nil
+}
+
+// ReleaseOrderMerchants 批量执行脚本删除仍指向该商家的全局索引
+func (s *RedisStore) ReleaseOrderMerchants(ctx context.Context, merchantID string, orderIDs []string) error {
+	calls := make([]scriptCall, len(orderIDs))
+	for i, orderID := range orderIDs {
+		calls[i] = scriptCall{keys: []string{s.getOrderMerchantKey(orderID)}, args: []interface{}{merchantID}}
+	}
+	cmds, err := s.runBatch(ctx, releaseMerchantScript, calls)
+	if err != nil {
+		return err
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			return fmt.Errorf("failed to release order merchant: %v", err)
+		}
+	}
+	return nil
+}
+
+// Schedule 执行预约脚本，并将商家写入有预约订单的商家集合
+// 商家集合是全局key，与 MarkActive 一样在脚本之外单独写入，分数只增不减
+func (s *RedisStore) Schedule(ctx context.Context, order ScheduledOrder) error {
+	merchantID := order.Order.MerchantID
+	payload, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("failed to encode scheduled order: %v", err)
+	}
+
+	keys := []string{s.getScheduledKey(merchantID), s.getScheduledOrderKey(merchantID)}
+	code, err := scheduleScript.Run(ctx, s.client, keys, order.Order.OrderID, order.ReleaseAt.UnixMilli(), payload).Int64()
+	if err != nil {
+		return fmt.Errorf("failed to schedule order: %v", err)
+	}
+	if code == resultConflict {
+		return ErrOrderAlreadyScheduled
+	}
+
+	member := redis.Z{Score: float64(order.ReleaseAt.UnixMilli()), Member: merchantID}
+	if err := s.client.ZAddGT(ctx, scheduledMerchantsKey, member).Err(); err != nil {
+		return fmt.Errorf("failed to mark scheduled merchant: %v", err)
+	}
+	return nil
+}
+
+// ScheduledOrders 执行脚本读取预约集合中 until 之前放入的订单
+func (s *RedisStore) ScheduledOrders(ctx context.Context, merchantID string, until time.Time) ([]ScheduledOrder, error) {
+	max := "+inf"
+	if !until.IsZero() {
+		max = strconv.FormatInt(until.UnixMilli(), 10)
+	}
+	keys := []string{s.getScheduledKey(merchantID), s.getScheduledOrderKey(merchantID)}
+	res, err := scheduledOrdersScript.Run(ctx, s.client, keys, max).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled orders: %v", err)
+	}
+	return decodeScheduledOrders(ctx, res), nil
+}
+
+// Unschedule 执行脚本移除预约订单
+func (s *RedisStore) Unschedule(ctx context.Context, merchantID, orderID string) error {
+	keys := []string{s.getScheduledKey(merchantID), s.getScheduledOrderKey(merchantID)}
+	code, err := unscheduleScript.Run(ctx, s.client, keys, orderID).Int64()
+	if err != nil {
+		return fmt.Errorf("failed to unschedule order: %v", err)
+	}
+	if code == resultNotFound {
+		return ErrOrderNotFound
+	}
+	return nil
+}
+
+// ScheduledMerchants 读取有预约订单的商家集合，顺便移除最晚放入时间早于 since 的商家
+func (s *RedisStore) ScheduledMerchants(ctx context.Context, since time.Time) ([]string, error) {
+	pipe := s.client.Pipeline()
+	pipe.ZRemRangeByScore(ctx, scheduledMerchantsKey, "-inf", "("+strconv.FormatInt(since.UnixMilli(), 10))
+	merchants := pipe.ZRange(ctx, scheduledMerchantsKey, 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get scheduled merchants: %v", err)
+	}
+	return merchants.Val(), nil
+}
+
+// decodeScheduledOrders 解析脚本返回的预约订单JSON列表，无法解析的记录会被跳过
+func decodeScheduledOrders(ctx context.Context, v interface{}) []ScheduledOrder {
+	values, _ := v.([]interface{})
+	orders := make([]ScheduledOrder, 0, len(values))
+	for _, value := range values {
+		payload, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var order ScheduledOrder
+		if err := json.Unmarshal([]byte(payload), &order); err != nil {
+			log.Log(ctx).Printf("Failed to parse scheduled order %v: %v", payload, err)
+			continue
+		}
+		orders = append(orders, order)
+	}
+	return orders
+}
+
+// MarkActive 写入活跃商家集合
+// 活跃商家集合是全局key，不能与商家key在同一脚本中操作，因此在入队后单独写入
+func (s *RedisStore) MarkActive(ctx context.Context, merchantIDs []string, at time.Time) error {
+	if len(merchantIDs) == 0 {
+		return nil
+	}
+	score := float64(at.UnixMilli())
+	members := make([]redis.Z, len(merchantIDs))
+	for i, merchantID := range merchantIDs {
+		members[i] = redis.Z{Score: score, Member: merchantID}
+	}
+	if err := s.client.ZAdd(ctx, activeMerchantsKey, members...).Err(); err != nil {
+		return fmt.Errorf("failed to mark merchant active: %v", err)
+	}
+	return nil
+}
+
+// ActiveMerchants 读取活跃商家集合，顺便移除长时间没有订单的商家
+func (s *RedisStore) ActiveMerchants(ctx context.Context, since time.Time) ([]string, error) {
+	pipe := s.client.Pipeline()
+	pipe.ZRemRangeByScore(ctx, activeMerchantsKey, "-inf", "("+strconv.FormatInt(since.UnixMilli(), 10))
+	merchants := pipe.ZRange(ctx, activeMerchantsKey, 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get active merchants: %v", err)
+	}
+	return merchants.Val(), nil
+}
+
+// Publish 以JSON发布到 queue_events:<merchantID> 频道
+func (s *RedisStore) Publish(ctx context.Context, merchantID string, events []QueueEvent) error {
+	channel := s.getEventChannel(merchantID)
+
+	pipe := s.client.Pipeline()
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode queue event: %v", err)
+		}
+		pipe.Publish(ctx, channel, payload)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to publish queue events: %v", err)
+	}
+	return nil
+}
+
+// Subscribe 订阅 queue_events:<merchantID> 频道
+func (s *RedisStore) Subscribe(ctx context.Context, merchantID string) (Subscription, error) {
+	pubsub := s.client.Subscribe(ctx, s.getEventChannel(merchantID))
+	// 等待订阅生效后再返回，避免调用方漏掉其后的事件
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe queue events: %v", err)
+	}
+
+	sub := &redisSubscription{
+		pubsub: pubsub,
+		events: make(chan QueueEvent),
+		done:   make(chan struct{}),
+	}
+	go sub.run(ctx)
+	return sub, nil
+}
+
+// redisSubscription 解析频道消息并转发为队列事件
+type redisSubscription struct {
+	pubsub *redis.PubSub
+	events chan QueueEvent
+	done   chan struct{}
+	once   sync.Once
+}
+
+// run 转发消息，订阅关闭或 ctx 取消时关闭事件通道
+func (s *redisSubscription) run(ctx context.Context) {
+	defer close(s.events)
+
+	for msg := range s.pubsub.Channel() {
+		var event QueueEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			log.Log(ctx).Printf("Failed to parse queue event %v: %v", msg.Payload, err)
+			continue
+		}
+		select {
+		case s.events <- event:
+		case <-s.done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Events 事件通道
+func (s *redisSubscription) Events() <-chan QueueEvent {
+	return s.events
+}
+
+// Close 取消订阅
+func (s *redisSubscription) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return s.pubsub.Close()
+}
@@ -0,0 +1,25 @@
+package oqueue_test
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/open4go/p7/oqueue"
+	"github.com/open4go/p7/oqueue/oqueuetest"
+	"github.com/redis/go-redis/v9"
+	"testing"
+)
+
+// newRedis 为每个测试启动独立的 miniredis
+func newRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, client
+}
+
+func TestRedisStoreConformance(t *testing.T) {
+	oqueuetest.RunStoreConformance(t, func(t *testing.T) oqueue.Store {
+		_, client := newRedis(t)
+		return oqueue.NewRedisStore(client)
+	})
+}
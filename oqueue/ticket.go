@@ -0,0 +1,86 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"unicode"
+)
+
+const defaultTicketPrefix = "A"
+
+// ErrTicketTaken 指定的取餐号当天已被其他订单使用
+var ErrTicketTaken = errors.New("ticket already taken")
+
+// Channel 订单来源渠道
+type Channel string
+
+const (
+	ChannelDineIn   Channel = "dine_in"  // 堂食
+	ChannelTakeaway Channel = "takeaway" // 自取/打包
+	ChannelDelivery Channel = "delivery" // 外卖配送
+)
+
+// defaultTicketPrefixes 默认各渠道的取餐号前缀
+var defaultTicketPrefixes = map[string]string{
+	string(ChannelDineIn):   "A",
+	string(ChannelTakeaway): "B",
+	string(ChannelDelivery): "C",
+}
+
+// ticketPrefix 获取订单的取餐号前缀
+// 依次按渠道、通道查找商家配置，未配置时使用渠道默认前缀
+func (c MerchantConfig) ticketPrefix(order OrderInfo) string {
+	if prefix, ok := c.TicketPrefixes[string(order.Channel)]; ok && order.Channel != "" {
+		return prefix
+	}
+	if prefix, ok := c.TicketPrefixes[string(order.Lane)]; ok && order.Lane != "" {
+		return prefix
+	}
+	if prefix, ok := defaultTicketPrefixes[string(order.Channel)]; ok {
+		return prefix
+	}
+	return defaultTicketPrefix
+}
+
+// validTicketPrefix 前缀不能为空且不能以数字结尾，否则无法从取餐号中区分前缀与序号
+func validTicketPrefix(prefix string) bool {
+	if prefix == "" {
+		return false
+	}
+	last := []rune(prefix)[len([]rune(prefix))-1]
+	return !unicode.IsDigit(last)
+}
+
+// GetOrderByTicket 通过取餐号查找商家当前营业日的订单
+func (q *QueueSystem) GetOrderByTicket(ctx context.Context, merchantID, ticket string) (*OrderRecord, error) {
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	day := q.currentDay(cfg)
+
+	orderID, err := q.store.TicketOrder(ctx, merchantID, day, ticket)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := q.store.OrderRecords(ctx, merchantID, day, []string{orderID})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrOrderNotFound
+	}
+	return records[0], nil
+}
+
+// GetNowServing 获取商家当前营业日各前缀最近叫到(已出餐)的取餐号
+// 返回 前缀 -> 取餐号，当天尚未叫号的前缀不包含在内
+func (q *QueueSystem) GetNowServing(ctx context.Context, merchantID string) (map[string]string, error) {
+	cfg, err := q.GetMerchantConfig(ctx, merchantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.store.NowServing(ctx, merchantID, q.currentDay(cfg))
+}
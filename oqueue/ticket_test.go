@@ -0,0 +1,113 @@
+package oqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTicketPrefix(t *testing.T) {
+	cfg := MerchantConfig{TicketPrefixes: map[string]string{"delivery": "W", "vip": "V"}}
+	tests := []struct {
+		name  string
+		cfg   MerchantConfig
+		order OrderInfo
+		want  string
+	}{
+		{"default", MerchantConfig{}, OrderInfo{}, "A"},
+		{"channel default", MerchantConfig{}, OrderInfo{Channel: ChannelTakeaway}, "B"},
+		{"channel configured", cfg, OrderInfo{Channel: ChannelDelivery}, "W"},
+		{"lane configured", cfg, OrderInfo{Lane: LaneVIP}, "V"},
+		{"channel before lane", cfg, OrderInfo{Channel: ChannelDelivery, Lane: LaneVIP}, "W"},
+		{"unknown channel", cfg, OrderInfo{Channel: "kiosk"}, "A"},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.ticketPrefix(tt.order); got != tt.want {
+			t.Errorf("%s: ticketPrefix = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidTicketPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   bool
+	}{
+		{"", false},
+		{"A", true},
+		{"VIP", true},
+		{"A1", false},
+		{"外", true},
+	}
+	for _, tt := range tests {
+		if got := validTicketPrefix(tt.prefix); got != tt.want {
+			t.Errorf("validTicketPrefix(%q) = %v, want %v", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestTickets(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+	enqueue := func(order OrderInfo) string {
+		t.Helper()
+		order.MerchantID = "m1"
+		order.NumOfItems = 1
+		ticket, err := q.EnqueueOrderWithTicket(ctx, order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ticket
+	}
+	tickets := []string{
+		enqueue(OrderInfo{OrderID: "o1"}),
+		enqueue(OrderInfo{OrderID: "o2", Channel: ChannelTakeaway}),
+		enqueue(OrderInfo{OrderID: "o3"}),
+		enqueue(OrderInfo{OrderID: "o4", Ticket: "VIP9"}),
+	}
+	want := []string{"A001", "B001", "A002", "VIP9"}
+	for i := range want {
+		if tickets[i] != want[i] {
+			t.Fatalf("tickets = %v, want %v", tickets, want)
+		}
+	}
+
+	// 指定的取餐号已被占用时拒绝入队，自动分配时跳过已被指定的取餐号
+	_, err := q.EnqueueOrderWithTicket(ctx, OrderInfo{MerchantID: "m1", OrderID: "o5", NumOfItems: 1, Ticket: "VIP9"})
+	if !errors.Is(err, ErrTicketTaken) {
+		t.Fatalf("duplicate ticket: %v", err)
+	}
+	if _, err := q.GetOrderRecord(ctx, "m1", "o5"); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("rejected order: %v", err)
+	}
+	if ticket := enqueue(OrderInfo{OrderID: "o5", Ticket: "A003"}); ticket != "A003" {
+		t.Fatalf("ticket = %s", ticket)
+	}
+	if ticket := enqueue(OrderInfo{OrderID: "o6"}); ticket != "A004" {
+		t.Fatalf("ticket after specified A003 = %s", ticket)
+	}
+
+	record, err := q.GetOrderByTicket(ctx, "m1", "A002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.OrderID != "o3" || record.Ticket != "A002" {
+		t.Fatalf("record = %+v", record)
+	}
+	if _, err := q.GetOrderByTicket(ctx, "m1", "A999"); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("missing ticket: %v", err)
+	}
+
+	for _, id := range []string{"o1", "o3", "o2"} {
+		if err := q.CompleteMerchantOrder(ctx, "m1", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	serving, err := q.GetNowServing(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serving) != 2 || serving["A"] != "A002" || serving["B"] != "B001" {
+		t.Fatalf("now serving = %v", serving)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/open4go/log"
+	"github.com/open4go/p7/clock"
+	"github.com/redis/go-redis/v9"
 	"strconv"
 	"time"
 )
@@ -139,23 +141,49 @@ func validateHead(head []string) error {
 	return nil
 }
 
+// ChartOption 图表数据配置项
+type ChartOption func(*ChartData)
+
+// WithClock 设置时钟，按其当前时间所在时区的日期统计，默认使用系统时间
+func WithClock(c clock.Clock) ChartOption {
+	return func(d *ChartData) {
+		if c != nil {
+			d.clock = c
+		}
+	}
+}
+
+// WithClient 设置 Redis 客户端，默认使用 cache 连接池
+func WithClient(client redis.Cmdable) ChartOption {
+	return func(d *ChartData) {
+		if client != nil {
+			d.client = client
+		}
+	}
+}
+
 // NewChart
 // 根据业务需求输入source
 // 根据实际需要展示的数据维度，输入head
-func NewChart(ctx context.Context, source DataSourceType, head []string) (*ChartData, error) {
+func NewChart(ctx context.Context, source DataSourceType, head []string, opts ...ChartOption) (*ChartData, error) {
 
 	if err := validateHead(head); err != nil {
 		return nil, err
 	}
 
-	return &ChartData{
+	d := &ChartData{
 		// 默认
 		Expire:     7 * 24 * time.Hour,
 		DataSource: source,
 		Ctx:        ctx,
 		// 数据类型，例如：订单数据，分为虚拟订单，线上订单，线下订单等
-		Head: head,
-	}, nil
+		Head:  head,
+		clock: clock.System,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d, nil
 }
 
 type ChartData struct {
@@ -163,6 +191,24 @@ type ChartData struct {
 	Ctx        context.Context
 	Expire     time.Duration
 	Head       []string
+	clock      clock.Clock   // 为空时使用系统时间
+	client     redis.Cmdable // 为空时使用 cache 连接池
+}
+
+// now 获取当前时间
+func (d *ChartData) now() time.Time {
+	if d.clock == nil {
+		return time.Now()
+	}
+	return d.clock.Now()
+}
+
+// redis 获取 Redis 客户端
+func (d *ChartData) redis(ctx context.Context) redis.Cmdable {
+	if d.client != nil {
+		return d.client
+	}
+	return GetRedisCacheHandler(ctx)
 }
 
 func (d *ChartData) GetKey(t string) string {
@@ -174,7 +220,7 @@ func (d *ChartData) GetKey(t string) string {
 // vals 是默认的递增幅度，如果没有指定默认就是1，例如用户注册成功就增加1
 // 对于订单销售额则可以指定金额，这里就不能输入小数点的数据了，需要取整
 func (d *ChartData) Push(t string, vals ...int64) {
-	today := time.Now().Format("2006-01-02")
+	today := d.now().Format("2006-01-02")
 	key := d.GetKey(t)
 
 	// 设置默认值
@@ -192,17 +238,17 @@ func (d *ChartData) Push(t string, vals ...int64) {
 
 // push 用户数据存储
 func (d *ChartData) push(ctx context.Context, today, key string, val int64) error {
-	err := GetRedisCacheHandler(ctx).HIncrBy(ctx, key, today, val).Err()
+	err := d.redis(ctx).HIncrBy(ctx, key, today, val).Err()
 	if err != nil {
 		return err
 	}
 
 	// 设置过期时间为 7 天
-	GetRedisCacheHandler(ctx).Expire(ctx, key, d.Expire)
+	d.redis(ctx).Expire(ctx, key, d.Expire)
 
 	// 删除一个月前的数据
-	oneMonthAgo := time.Now().AddDate(0, -1, 0).Format("2006-01-02")
-	GetRedisCacheHandler(ctx).HDel(ctx, key, oneMonthAgo)
+	oneMonthAgo := d.now().AddDate(0, -1, 0).Format("2006-01-02")
+	d.redis(ctx).HDel(ctx, key, oneMonthAgo)
 
 	// 其他用户注册逻辑
 	return nil
@@ -210,7 +256,7 @@ func (d *ChartData) push(ctx context.Context, today, key string, val int64) erro
 
 // Stats 用户数据统计
 func (d *ChartData) Stats(ctx context.Context, days int) ([]ChartItem, error) {
-	today := time.Now()
+	today := d.now()
 	daysData := make([]ChartItem, 0)
 	for i := 0; i < days; i++ {
 		date := today.AddDate(0, 0, -i).Format("2006-01-02")
@@ -220,7 +266,7 @@ func (d *ChartData) Stats(ctx context.Context, days int) ([]ChartItem, error) {
 		for _, t := range d.Head {
 			key := d.GetKey(t)
 			log.Log(ctx).WithField("key", key).WithField("date", date).Debug("inside Stats loop")
-			count, err := GetRedisCacheHandler(ctx).HGet(ctx, key, date).Result()
+			count, err := d.redis(ctx).HGet(ctx, key, date).Result()
 			if err != nil {
 				continue
 			} else {
@@ -239,17 +285,14 @@ func (d *ChartData) CurrentMonthly(ctx context.Context) ([]ChartItem, error) {
 	daysData := make([]ChartItem, 0)
 
 	// 遍历从本月的第一天到今天的每一天
-	days, err := CurrentMonthlyDays(ctx)
-	if err != nil {
-		return daysData, err
-	}
+	days := monthlyDays(d.now())
 	for _, dateStr := range days {
 		// 每次重新初始化，避免数据污染
 		t2v := make(map[string]int)
 		for _, t := range d.Head {
 			key := d.GetKey(t)
 			log.Log(ctx).WithField("key", key).WithField("date", dateStr).Debug("inside Stats loop")
-			count, err := GetRedisCacheHandler(ctx).HGet(ctx, key, dateStr).Result()
+			count, err := d.redis(ctx).HGet(ctx, key, dateStr).Result()
 			if err != nil {
 				continue
 			}
@@ -287,8 +330,13 @@ func (d *ChartData) CurrentMonthlySummary(ctx context.Context) (map[string]int,
 	return m, nil
 }
 
+// CurrentMonthlyDays 按系统时间获取本月第一天到今天的日期
 func CurrentMonthlyDays(ctx context.Context) ([]string, error) {
-	today := time.Now()
+	return monthlyDays(time.Now()), nil
+}
+
+// monthlyDays 获取 today 所在月第一天到 today 的日期
+func monthlyDays(today time.Time) []string {
 	startOfMonth := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location())
 	days := make([]string, 0)
 
@@ -298,5 +346,5 @@ func CurrentMonthlyDays(ctx context.Context) ([]string, error) {
 		days = append(days, dateStr)
 		fmt.Println("dateStr key", dateStr)
 	}
-	return days, nil
+	return days
 }
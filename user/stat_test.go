@@ -0,0 +1,148 @@
+package user
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/open4go/p7/clock"
+	"github.com/redis/go-redis/v9"
+	"testing"
+	"time"
+)
+
+var (
+	east8 = time.FixedZone("UTC+8", 8*60*60)  // 无夏令时的东八区
+	west5 = time.FixedZone("UTC-5", -5*60*60) // 无夏令时的西五区
+)
+
+// newClient 创建连接到 miniredis 的客户端
+func newClient(t *testing.T) redis.Cmdable {
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// newChart 创建使用 fake 时钟的订单图表
+func newChart(t *testing.T, client redis.Cmdable, fake *clock.Fake) *ChartData {
+	t.Helper()
+	chart, err := NewChart(context.Background(), OrderCount, []string{"a", "b"}, WithClient(client), WithClock(fake))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chart
+}
+
+// assertStats 校验最近几天的日期与 a 维度的数据，按日期倒序
+func assertStats(t *testing.T, chart *ChartData, want ...ChartItem) {
+	t.Helper()
+	items, err := chart.Stats(context.Background(), len(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range want {
+		if items[i].Name != want[i].Name || items[i].A != want[i].A {
+			t.Fatalf("stats = %+v, want %+v", items, want)
+		}
+	}
+}
+
+func TestMonthlyDays(t *testing.T) {
+	tests := []struct {
+		today       time.Time
+		first, last string
+		n           int
+	}{
+		{time.Date(2026, 3, 1, 0, 0, 0, 0, east8), "2026-03-01", "2026-03-01", 1},
+		{time.Date(2026, 2, 28, 23, 59, 0, 0, east8), "2026-02-01", "2026-02-28", 28},
+		{time.Date(2028, 2, 29, 12, 0, 0, 0, east8), "2028-02-01", "2028-02-29", 29},
+	}
+	for _, tt := range tests {
+		days := monthlyDays(tt.today)
+		if len(days) != tt.n || days[0] != tt.first || days[len(days)-1] != tt.last {
+			t.Errorf("monthlyDays(%v) = %v", tt.today, days)
+		}
+	}
+}
+
+// TestChartMidnight 零点后的数据记录到新的日期
+func TestChartMidnight(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 10, 23, 59, 59, 0, east8))
+	chart := newChart(t, newClient(t), fake)
+
+	chart.Push("a")
+	chart.Push("a", 2)
+	fake.Advance(time.Second)
+	chart.Push("a", 5)
+	assertStats(t, chart,
+		ChartItem{Name: "2026-03-11", A: 5},
+		ChartItem{Name: "2026-03-10", A: 3},
+	)
+}
+
+// TestChartMonthBoundary 按月统计从当月1日开始，写入时清理一个月前的数据
+func TestChartMonthBoundary(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t)
+	fake := clock.NewFake(time.Date(2026, 3, 1, 0, 0, 0, 0, east8))
+	chart := newChart(t, client, fake)
+
+	chart.Push("a")
+	assertStats(t, chart,
+		ChartItem{Name: "2026-03-01", A: 1},
+		ChartItem{Name: "2026-02-28"},
+		ChartItem{Name: "2026-02-27"},
+	)
+	monthly, err := chart.CurrentMonthly(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(monthly) != 1 || monthly[0].Name != "2026-03-01" || monthly[0].A != 1 {
+		t.Fatalf("monthly = %+v", monthly)
+	}
+
+	// 写入时删除一个月前同一天的数据
+	key := chart.GetKey("a")
+	if err := client.HSet(ctx, key, "2026-02-15", 1, "2026-03-03", 1).Err(); err != nil {
+		t.Fatal(err)
+	}
+	fake.Set(time.Date(2026, 3, 15, 12, 0, 0, 0, east8))
+	chart.Push("a")
+	fields, err := client.HKeys(ctx, key).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		kept[field] = true
+	}
+	if kept["2026-02-15"] || !kept["2026-03-03"] || !kept["2026-03-15"] {
+		t.Fatalf("fields = %v", fields)
+	}
+	summary, err := chart.CurrentMonthlySummary(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary["a"] != 3 {
+		t.Fatalf("summary = %v", summary)
+	}
+	if monthly, err = chart.CurrentMonthly(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(monthly) != 15 || monthly[14].Name != "2026-03-15" {
+		t.Fatalf("monthly days = %d", len(monthly))
+	}
+}
+
+// TestChartZones 同一时刻按时钟所在时区的日期记录
+func TestChartZones(t *testing.T) {
+	client := newClient(t)
+	instant := time.Date(2026, 3, 31, 20, 0, 0, 0, time.UTC)
+	east := newChart(t, client, clock.NewFake(instant.In(east8)))
+	east.Push("a")
+	assertStats(t, east, ChartItem{Name: "2026-04-01", A: 1})
+
+	west := newChart(t, client, clock.NewFake(instant.In(west5)))
+	assertStats(t, west, ChartItem{Name: "2026-03-31"})
+	west.Push("a")
+	assertStats(t, west, ChartItem{Name: "2026-03-31", A: 1}, ChartItem{Name: "2026-03-30"})
+}